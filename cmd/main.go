@@ -1,10 +1,16 @@
 package main
 
 import (
+	"context"
 	"github.com/Lenstack/lensaas-app/internal/core/applications"
+	"github.com/Lenstack/lensaas-app/internal/core/billing"
 	"github.com/Lenstack/lensaas-app/internal/core/services"
 	"github.com/Lenstack/lensaas-app/internal/infrastructure"
+	"github.com/Lenstack/lensaas-app/internal/utils"
 	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"os"
+	"time"
 )
 
 func main() {
@@ -27,24 +33,162 @@ func main() {
 		MailEmail            = viper.Get("MAIL_EMAIL").(string)
 		MailPass             = viper.Get("MAIL_PASSWORD").(string)
 		StripeSecretKey      = viper.Get("STRIPE_SECRET_KEY").(string)
+		StripeApiUrl         = viper.Get("STRIPE_API_URL").(string)
+		StripeWebhookSecret  = viper.Get("STRIPE_WEBHOOK_SECRET").(string)
+		BillingProvider      = viper.Get("BILLING_PROVIDER").(string)
+		PayPalClientId       = viper.Get("PAYPAL_CLIENT_ID").(string)
+		PayPalClientSecret   = viper.Get("PAYPAL_CLIENT_SECRET").(string)
+		PayPalWebhookId      = viper.Get("PAYPAL_WEBHOOK_ID").(string)
+		PayPalApiUrl         = viper.Get("PAYPAL_API_URL").(string)
+		FakeWebhookSecret    = viper.Get("BILLING_FAKE_WEBHOOK_SECRET").(string)
+		PlanPrices           = viper.Get("PLAN_PRICES").(string)
+		EntitlementCacheTTL  = viper.Get("ENTITLEMENT_CACHE_TTL").(string)
+		MeteredPriceId       = viper.Get("STRIPE_METERED_PRICE_ID").(string)
+		UsageReportInterval  = viper.Get("USAGE_REPORT_INTERVAL").(string)
+		CheckoutSuccessUrl   = viper.Get("CHECKOUT_SUCCESS_URL").(string)
+		CheckoutCancelUrl    = viper.Get("CHECKOUT_CANCEL_URL").(string)
+		CheckoutTrialDays    = viper.Get("CHECKOUT_TRIAL_DAYS").(string)
+		PortalReturnUrl      = viper.Get("BILLING_PORTAL_RETURN_URL").(string)
+		DunningGracePeriod   = viper.Get("DUNNING_GRACE_PERIOD").(string)
+		DunningReminders     = viper.Get("DUNNING_REMINDERS").(string)
+		SeatProration        = viper.Get("SEAT_PRORATION").(string)
+		TrialPlan            = viper.Get("TRIAL_PLAN").(string)
+		TrialLength          = viper.Get("TRIAL_LENGTH").(string)
+		TrialReminders       = viper.Get("TRIAL_REMINDERS").(string)
 		JwtSecret            = viper.Get("JWT_SECRET").(string)
 		JwtExpirationAccess  = viper.Get("JWT_EXPIRATION_ACCESS").(string)
 		JwtExpirationRefresh = viper.Get("JWT_EXPIRATION_REFRESH").(string)
+		JwtExpirationReauth  = viper.Get("JWT_EXPIRATION_REAUTH").(string)
+		JwtExpirationClient  = viper.Get("JWT_EXPIRATION_CLIENT").(string)
+		JwtImpersonation     = viper.Get("JWT_EXPIRATION_IMPERSONATION").(string)
+		OtelServiceName      = viper.Get("OTEL_SERVICE_NAME").(string)
+		OtelExporter         = viper.Get("OTEL_EXPORTER").(string)
+		OtelEndpoint         = viper.Get("OTEL_EXPORTER_OTLP_ENDPOINT").(string)
+		ErrorReporter        = viper.Get("ERROR_REPORTER").(string)
+		ErrorReporterPath    = viper.Get("ERROR_REPORTER_PATH").(string)
+		RateLimitPolicies    = viper.Get("RATE_LIMIT_POLICIES").(string)
+		RateLimitAllowlist   = viper.Get("RATE_LIMIT_ALLOWLIST").(string)
+		TrustedProxies       = viper.Get("TRUSTED_PROXIES").(string)
+		LockoutThreshold     = viper.Get("LOCKOUT_THRESHOLD").(string)
+		LockoutMaxAttempts   = viper.Get("LOCKOUT_MAX_ATTEMPTS").(string)
+		LockoutBaseDelay     = viper.Get("LOCKOUT_BASE_DELAY").(string)
+		LockoutDuration      = viper.Get("LOCKOUT_DURATION").(string)
+		PasswordMinLength    = viper.Get("PASSWORD_MIN_LENGTH").(string)
+		PasswordMaxLength    = viper.Get("PASSWORD_MAX_LENGTH").(string)
+		PasswordClasses      = viper.Get("PASSWORD_REQUIRED_CLASSES").(string)
+		PasswordMinStrength  = viper.Get("PASSWORD_MIN_STRENGTH").(string)
+		BreachedChecker      = viper.Get("PASSWORD_BREACHED_CHECKER").(string)
+		BreachedDataset      = viper.Get("PASSWORD_BREACHED_DATASET").(string)
+		BreachedRangeUrl     = viper.Get("PASSWORD_BREACHED_RANGE_URL").(string)
+		HashAlgorithm        = viper.Get("PASSWORD_HASH_ALGORITHM").(string)
+		Argon2Memory         = viper.Get("ARGON2_MEMORY").(string)
+		Argon2Iterations     = viper.Get("ARGON2_ITERATIONS").(string)
+		Argon2Parallelism    = viper.Get("ARGON2_PARALLELISM").(string)
+		BcryptCost           = viper.Get("BCRYPT_COST").(string)
+		PasswordPepper       = viper.Get("PASSWORD_PEPPER").(string)
+		AccountGracePeriod   = viper.Get("ACCOUNT_DELETION_GRACE_PERIOD").(string)
+		AccountDeletionMode  = viper.Get("ACCOUNT_DELETION_MODE").(string)
+		AuditLogRetention    = viper.Get("AUDIT_LOG_RETENTION").(string)
+		AuditLogExportDir    = viper.Get("AUDIT_LOG_EXPORT_DIR").(string)
 	)
 
 	logger := infrastructure.NewLogger(AppEnvironment)
+	tracing := infrastructure.NewTracing(AppEnvironment, OtelServiceName, OtelExporter, OtelEndpoint, logger.Log)
+	defer func() {
+		_ = tracing.Shutdown(context.Background())
+	}()
 	postgres := infrastructure.NewPostgres(DBHost, DBPort, DBUser, DBPassword, DBName, logger.Log)
+	if postgres == nil {
+		logger.Log.Fatal("unable to connect to postgres")
+	}
 	redis := infrastructure.NewRedis(RedisHost, RedisPort, RedisPassword, RedisDB, logger.Log)
-	infrastructure.NewStripe(AppEnvironment, StripeSecretKey)
+	if redis == nil {
+		logger.Log.Fatal("unable to connect to redis")
+	}
+	billingProviders := []billing.Provider{infrastructure.NewStripe(AppEnvironment, StripeSecretKey, StripeApiUrl, StripeWebhookSecret)}
+	if PayPalClientId != "" {
+		billingProviders = append(billingProviders, infrastructure.NewPayPal(AppEnvironment, PayPalClientId, PayPalClientSecret, PayPalWebhookId, PayPalApiUrl))
+	}
+	// The in memory provider never charges anyone, it is only available for development and tests.
+	if AppEnvironment == "development" {
+		billingProviders = append(billingProviders, billing.NewFake(FakeWebhookSecret))
+	}
 
 	// Register common services
-	emailService := services.NewEmailService(MailHost, MailPort, MailEmail, MailPass)
-	tokenService := services.NewTokenService(JwtSecret, JwtExpirationAccess, JwtExpirationRefresh)
-	stripeService := services.NewStripeService()
+	metricsService := services.NewMetricsService()
+	metricsService.RegisterDatabase(postgres.DB)
+	metricsService.RegisterRedis(redis.Client)
+	emailService := services.NewEmailService(MailHost, MailPort, MailEmail, MailPass, *metricsService)
+	tokenService := services.NewTokenService(JwtSecret, JwtExpirationAccess, JwtExpirationRefresh, JwtExpirationReauth, JwtImpersonation)
+	errorReporter, err := services.NewErrorReporter(ErrorReporter, ErrorReporterPath)
+	if err != nil {
+		logger.Log.Fatal("unable to create error reporter", zap.Error(err))
+	}
+	rateLimitService, err := services.NewRateLimitService(redis.Client, RateLimitPolicies, RateLimitAllowlist, TrustedProxies)
+	if err != nil {
+		logger.Log.Fatal("unable to create rate limit service", zap.Error(err))
+	}
+	lockoutPolicy := services.NewLockoutPolicy(LockoutThreshold, LockoutMaxAttempts, LockoutBaseDelay, LockoutDuration)
+	breachedPasswordChecker := services.NewBreachedPasswordChecker(BreachedChecker, BreachedDataset, BreachedRangeUrl)
+	passwordPolicyService := services.NewPasswordPolicyService(PasswordMinLength, PasswordMaxLength, PasswordClasses, PasswordMinStrength, breachedPasswordChecker)
+	passwordHasher := utils.NewPasswordHasher(HashAlgorithm, Argon2Memory, Argon2Iterations, Argon2Parallelism, BcryptCost, PasswordPepper)
+	auditService := services.NewAuditService(postgres.Database, postgres.DB, AuditLogRetention, AuditLogExportDir)
+	billingService := services.NewBillingService(postgres.Database, redis.Client, *auditService, BillingProvider, billingProviders...)
 	// Register all services
-	userService := services.NewUserService(postgres.Database, redis.Client, *tokenService, *emailService)
+	entitlementService, err := services.NewEntitlementService(postgres.Database, redis.Client, PlanPrices, EntitlementCacheTTL)
+	if err != nil {
+		logger.Log.Fatal("unable to create entitlement service", zap.Error(err))
+	}
+	trialService, err := services.NewTrialService(postgres.Database, redis.Client, *emailService, *entitlementService, *auditService, TrialPlan, TrialLength, TrialReminders)
+	if err != nil {
+		logger.Log.Fatal("unable to create trial service", zap.Error(err))
+	}
+	userService := services.NewUserService(postgres.Database, redis.Client, *tokenService, *emailService, *metricsService, *lockoutPolicy, *passwordPolicyService, *passwordHasher, *auditService, *billingService, *trialService)
+	accountService := services.NewAccountService(postgres.Database, redis.Client, *tokenService, *emailService, *auditService, *billingService, *userService, AccountGracePeriod, AccountDeletionMode)
+	apiKeyService := services.NewApiKeyService(postgres.Database, *auditService)
+	oauthClientService := services.NewOAuthClientService(postgres.Database, *tokenService, *auditService, JwtExpirationClient)
+	subscriptionService := services.NewSubscriptionService(postgres.Database, *billingService, *entitlementService, *auditService, MeteredPriceId)
+	usageService := services.NewUsageService(postgres.Database, redis.Client, *billingService, *entitlementService)
+	checkoutService, err := services.NewCheckoutService(*subscriptionService, *auditService, CheckoutSuccessUrl, CheckoutCancelUrl, PortalReturnUrl, CheckoutTrialDays)
+	if err != nil {
+		logger.Log.Fatal("unable to create checkout service", zap.Error(err))
+	}
+	dunningService, err := services.NewDunningService(postgres.Database, redis.Client, *emailService, *entitlementService, *auditService, DunningGracePeriod, DunningReminders)
+	if err != nil {
+		logger.Log.Fatal("unable to create dunning service", zap.Error(err))
+	}
+	seatService, err := services.NewSeatService(postgres.Database, postgres.DB, redis.Client, *subscriptionService, *entitlementService, *emailService, *auditService, SeatProration)
+	if err != nil {
+		logger.Log.Fatal("unable to create seat service", zap.Error(err))
+	}
+	webhookService := services.NewWebhookService(postgres.Database, *subscriptionService, *dunningService)
+
+	// Maintenance commands run against the configured services instead of serving http, e.g. ./app webhooks replay <event_id>
+	if len(os.Args) > 1 {
+		err = infrastructure.NewCommand(*webhookService, logger.Log).Run(os.Args[1:])
+		if err != nil {
+			logger.Log.Fatal("command failed", zap.Error(err))
+		}
+		return
+	}
+
 	// Register all applications
-	microservice := applications.NewMicroservice(*emailService, *tokenService, *userService, *stripeService)
+	microservice := applications.NewMicroservice(*emailService, *tokenService, *userService, *billingService, *subscriptionService, *metricsService, errorReporter, *rateLimitService, *accountService, *apiKeyService, *oauthClientService, *auditService, *webhookService, *entitlementService, *usageService, *checkoutService, *dunningService, *seatService, *trialService, logger.Log)
+
+	// Register scheduled jobs
+	usageReportInterval, err := time.ParseDuration(UsageReportInterval)
+	if err != nil {
+		logger.Log.Fatal("invalid usage report interval", zap.Error(err))
+	}
+	scheduler := infrastructure.NewScheduler(logger.Log)
+	scheduler.Every("purge_deactivated_accounts", time.Hour, accountService.PurgeDeactivatedAccounts)
+	scheduler.Every("export_expired_audit_logs", 24*time.Hour, auditService.ExportExpired)
+	scheduler.Every("process_webhook_events", time.Minute, webhookService.ProcessDue)
+	scheduler.Every("aggregate_usage", time.Minute, usageService.Aggregate)
+	scheduler.Every("report_usage", usageReportInterval, usageService.Report)
+	scheduler.Every("process_dunning", time.Hour, dunningService.ProcessDue)
+	scheduler.Every("process_trials", time.Hour, trialService.ProcessDue)
+	defer scheduler.Stop()
 
 	routes := infrastructure.NewRoutes(*microservice)
 	infrastructure.NewHttpServer(AppPort, routes.Handlers, logger.Log)
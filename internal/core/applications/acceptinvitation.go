@@ -0,0 +1,26 @@
+package applications
+
+import (
+	"encoding/json"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+)
+
+// AcceptInvitation TODO: 1. Get the account id from the url, 2. Call AcceptInvitation method from SeatService, 3. Return the member
+func (m *Microservice) AcceptInvitation(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+
+	member, err := m.SeatService.AcceptInvitation(req.Context(), utils.UserId(req.Context()), chi.URLParam(req, "id"))
+	if err != nil {
+		writeMemberError(wr, err)
+		return
+	}
+
+	wr.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(wr).Encode(&models.AcceptInvitationResponse{Member: toMemberModel(member)})
+	if err != nil {
+		return
+	}
+}
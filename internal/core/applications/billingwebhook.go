@@ -0,0 +1,53 @@
+package applications
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/Lenstack/lensaas-app/internal/core/services"
+	"github.com/go-chi/chi/v5"
+	"io"
+	"net/http"
+)
+
+// billingWebhookMaxBody is the payload size Stripe recommends to accept, PayPal events are smaller.
+const billingWebhookMaxBody = 65536
+
+// BillingWebhook TODO: 1. Read the raw body, signatures are computed over its bytes, 2. Call Receive method from WebhookService with the provider of the url, 3. Acknowledge the event, processing happens in the background
+func (m *Microservice) BillingWebhook(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+
+	payload, err := io.ReadAll(http.MaxBytesReader(wr, req.Body, billingWebhookMaxBody))
+	if err != nil {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	eventId, err := m.WebhookService.Receive(req.Context(), chi.URLParam(req, "provider"), payload, req.Header)
+	if err != nil {
+		// Providers retry on any non 2xx answer, storage failures must not be acknowledged.
+		code := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrInvalidWebhookSignature):
+			code = http.StatusBadRequest
+		case errors.Is(err, services.ErrUnknownProvider):
+			code = http.StatusNotFound
+		}
+		wr.WriteHeader(code)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: code})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	wr.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(wr).Encode(&models.WebhookResponse{EventId: eventId, Received: true})
+	if err != nil {
+		return
+	}
+}
@@ -0,0 +1,35 @@
+package applications
+
+import (
+	"encoding/json"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"net/http"
+)
+
+// CancelSubscription TODO: 1. Get immediately from request, by default the subscription ends with the paid period, 2. Call CancelSubscription method from SubscriptionService, 3. Return the subscription
+func (m *Microservice) CancelSubscription(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+	body := &models.CancelSubscriptionRequest{}
+
+	if err := json.NewDecoder(req.Body).Decode(body); err != nil {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	subscription, err := m.SubscriptionService.CancelSubscription(req.Context(), utils.UserId(req.Context()), body.Immediately)
+	if err != nil {
+		writeSubscriptionError(wr, err)
+		return
+	}
+
+	wr.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(wr).Encode(&models.SubscriptionResponse{Subscription: toSubscriptionModel(subscription)})
+	if err != nil {
+		return
+	}
+}
@@ -0,0 +1,52 @@
+package applications
+
+import (
+	"encoding/json"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"net/http"
+)
+
+// ChangeEmail TODO: 1. Get new email and password from request, 2. Validate request, 3. Call ChangeEmail method from UserService, 4. Return success message
+func (m *Microservice) ChangeEmail(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+	body := &models.ChangeEmailRequest{}
+
+	if err := json.NewDecoder(req.Body).Decode(body); err != nil {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	validateErrors := utils.Validate(body)
+	if len(validateErrors) > 0 {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(validateErrors)
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	message, err := m.UserService.ChangeEmail(req.Context(), utils.UserId(req.Context()), body.Password, body.Email)
+	if writeLockoutError(wr, err) {
+		return
+	}
+	if err != nil {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	wr.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(wr).Encode(&models.ChangeEmailResponse{Message: message})
+	if err != nil {
+		return
+	}
+}
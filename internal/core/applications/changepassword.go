@@ -0,0 +1,53 @@
+package applications
+
+import (
+	"encoding/json"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"net/http"
+	"time"
+)
+
+// ChangePassword TODO: 1. Get current and new password from request, 2. Validate request, 3. Call ChangePassword method from UserService, 4. Return new tokens
+func (m *Microservice) ChangePassword(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+	body := &models.ChangePasswordRequest{}
+
+	if err := json.NewDecoder(req.Body).Decode(body); err != nil {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	validateErrors := utils.Validate(body)
+	if len(validateErrors) > 0 {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(validateErrors)
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	accessToken, refreshToken, expiresIn, err := m.UserService.ChangePassword(req.Context(), utils.UserId(req.Context()), body.CurrentPassword, body.NewPassword)
+	if writeLockoutError(wr, err) {
+		return
+	}
+	if err != nil {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	wr.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(wr).Encode(&models.ChangePasswordResponse{AccessToken: accessToken, RefreshToken: refreshToken, ExpiresIn: time.Now().Add(expiresIn)})
+	if err != nil {
+		return
+	}
+}
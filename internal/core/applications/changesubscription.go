@@ -0,0 +1,45 @@
+package applications
+
+import (
+	"encoding/json"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"net/http"
+)
+
+// ChangeSubscription TODO: 1. Get the new price id and the previewed proration date from request, 2. Validate request, 3. Call ChangePlan method from SubscriptionService, 4. Return the subscription
+func (m *Microservice) ChangeSubscription(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+	body := &models.ChangeSubscriptionRequest{}
+
+	if err := json.NewDecoder(req.Body).Decode(body); err != nil {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	validateErrors := utils.Validate(body)
+	if len(validateErrors) > 0 {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(validateErrors)
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	subscription, err := m.SubscriptionService.ChangePlan(req.Context(), utils.UserId(req.Context()), body.PriceId, body.ProrationDate)
+	if err != nil {
+		writeSubscriptionError(wr, err)
+		return
+	}
+
+	wr.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(wr).Encode(&models.SubscriptionResponse{Subscription: toSubscriptionModel(subscription)})
+	if err != nil {
+		return
+	}
+}
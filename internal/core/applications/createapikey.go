@@ -0,0 +1,49 @@
+package applications
+
+import (
+	"encoding/json"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"net/http"
+)
+
+// CreateApiKey TODO: 1. Get name, scopes and expiry from request, 2. Validate request, 3. Call CreateApiKey method from ApiKeyService, 4. Return the key once
+func (m *Microservice) CreateApiKey(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+	body := &models.CreateApiKeyRequest{}
+
+	if err := json.NewDecoder(req.Body).Decode(body); err != nil {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	validateErrors := utils.Validate(body)
+	if len(validateErrors) > 0 {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(validateErrors)
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	key, apiKey, err := m.ApiKeyService.CreateApiKey(req.Context(), utils.UserId(req.Context()), body.Name, body.Scopes, body.ExpiresAt)
+	if err != nil {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	wr.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(wr).Encode(&models.CreateApiKeyResponse{Key: key, ApiKey: toApiKeyModel(apiKey)})
+	if err != nil {
+		return
+	}
+}
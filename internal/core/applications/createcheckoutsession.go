@@ -0,0 +1,55 @@
+package applications
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/Lenstack/lensaas-app/internal/core/services"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"net/http"
+)
+
+// CreateCheckoutSession TODO: 1. Get price id and promotion code from request, 2. Validate request, 3. Call CreateCheckoutSession method from CheckoutService, 4. Return the url to redirect the user to
+func (m *Microservice) CreateCheckoutSession(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+	body := &models.CreateCheckoutSessionRequest{}
+
+	if err := json.NewDecoder(req.Body).Decode(body); err != nil {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	validateErrors := utils.Validate(body)
+	if len(validateErrors) > 0 {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(validateErrors)
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	sessionId, url, err := m.CheckoutService.CreateCheckoutSession(req.Context(), utils.UserId(req.Context()), body.PriceId, body.PromotionCode)
+	if err != nil {
+		code := http.StatusBadRequest
+		if errors.Is(err, services.ErrSubscriptionExists) {
+			code = http.StatusConflict
+		}
+		wr.WriteHeader(code)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: code})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	wr.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(wr).Encode(&models.CheckoutSessionResponse{SessionId: sessionId, Url: url})
+	if err != nil {
+		return
+	}
+}
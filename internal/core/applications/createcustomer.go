@@ -1,7 +1,52 @@
 package applications
 
-import "net/http"
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"io"
+	"net/http"
+)
 
-func (m *Microservice) CreateCustomer(wr http.ResponseWriter, r *http.Request) {
+// CreateCustomer TODO: 1. Read the optional provider, 2. Call CreateCustomer method from BillingService, it returns the existing customer when there is one, 3. Return the provider and the customer id
+func (m *Microservice) CreateCustomer(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+	body := &models.CreateCustomerRequest{}
 
+	// The body is optional, the account then uses the default provider.
+	if err := json.NewDecoder(req.Body).Decode(body); err != nil && !errors.Is(err, io.EOF) {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	validateErrors := utils.Validate(body)
+	if len(validateErrors) > 0 {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(validateErrors)
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	provider, customerId, err := m.BillingService.CreateCustomer(req.Context(), utils.UserId(req.Context()), body.Provider)
+	if err != nil {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	wr.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(wr).Encode(&models.CreateCustomerResponse{Provider: provider.Name(), CustomerId: customerId})
+	if err != nil {
+		return
+	}
 }
@@ -0,0 +1,49 @@
+package applications
+
+import (
+	"encoding/json"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"net/http"
+)
+
+// CreateOAuthClient TODO: 1. Get name and scopes from request, 2. Validate request, 3. Call CreateClient method from OAuthClientService, 4. Return the secret once
+func (m *Microservice) CreateOAuthClient(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+	body := &models.CreateOAuthClientRequest{}
+
+	if err := json.NewDecoder(req.Body).Decode(body); err != nil {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	validateErrors := utils.Validate(body)
+	if len(validateErrors) > 0 {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(validateErrors)
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	secret, client, err := m.OAuthClientService.CreateClient(req.Context(), body.Name, body.Scopes)
+	if err != nil {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	wr.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(wr).Encode(&models.CreateOAuthClientResponse{ClientSecret: secret, Client: toOAuthClientModel(client)})
+	if err != nil {
+		return
+	}
+}
@@ -0,0 +1,29 @@
+package applications
+
+import (
+	"encoding/json"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"net/http"
+)
+
+// CreatePortalSession TODO: 1. Call CreatePortalSession method from CheckoutService, 2. Return the url of the customer portal
+func (m *Microservice) CreatePortalSession(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+
+	url, err := m.CheckoutService.CreatePortalSession(req.Context(), utils.UserId(req.Context()))
+	if err != nil {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	wr.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(wr).Encode(&models.PortalSessionResponse{Url: url})
+	if err != nil {
+		return
+	}
+}
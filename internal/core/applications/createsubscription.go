@@ -1,7 +1,55 @@
 package applications
 
-import "net/http"
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/Lenstack/lensaas-app/internal/core/services"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"net/http"
+)
 
-func (m *Microservice) CreateSubscription(wr http.ResponseWriter, r *http.Request) {
+// CreateSubscription TODO: 1. Get price id from request, 2. Validate request, 3. Call CreateSubscription method from SubscriptionService, 4. Return the subscription and the client secret of its first payment
+func (m *Microservice) CreateSubscription(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+	body := &models.CreateSubscriptionRequest{}
 
+	if err := json.NewDecoder(req.Body).Decode(body); err != nil {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	validateErrors := utils.Validate(body)
+	if len(validateErrors) > 0 {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(validateErrors)
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	subscription, clientSecret, err := m.SubscriptionService.CreateSubscription(req.Context(), utils.UserId(req.Context()), body.PriceId)
+	if err != nil {
+		code := http.StatusBadRequest
+		if errors.Is(err, services.ErrSubscriptionExists) {
+			code = http.StatusConflict
+		}
+		wr.WriteHeader(code)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: code})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	wr.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(wr).Encode(&models.CreateSubscriptionResponse{Subscription: toSubscriptionModel(subscription), ClientSecret: clientSecret})
+	if err != nil {
+		return
+	}
 }
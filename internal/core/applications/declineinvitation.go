@@ -0,0 +1,26 @@
+package applications
+
+import (
+	"encoding/json"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+)
+
+// DeclineInvitation TODO: 1. Get the account id from the url, 2. Call DeclineInvitation method from SeatService, 3. Return success message
+func (m *Microservice) DeclineInvitation(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+
+	err := m.SeatService.DeclineInvitation(req.Context(), utils.UserId(req.Context()), chi.URLParam(req, "id"))
+	if err != nil {
+		writeMemberError(wr, err)
+		return
+	}
+
+	wr.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(wr).Encode(&models.DeclineInvitationResponse{Message: "invitation declined successfully"})
+	if err != nil {
+		return
+	}
+}
@@ -0,0 +1,69 @@
+package applications
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"net/http"
+)
+
+// ExportAccount TODO: 1. Call ExportAccount method from AccountService, 2. Return the export as a JSON or ZIP download
+func (m *Microservice) ExportAccount(wr http.ResponseWriter, req *http.Request) {
+	export, err := m.AccountService.ExportAccount(req.Context(), utils.UserId(req.Context()))
+	if err != nil {
+		wr.Header().Set("Content-Type", "application/json")
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	if req.URL.Query().Get("format") != "zip" {
+		wr.Header().Set("Content-Type", "application/json")
+		wr.Header().Set("Content-Disposition", `attachment; filename="account-export.json"`)
+		wr.WriteHeader(http.StatusOK)
+		encoder := json.NewEncoder(wr)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(export)
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	wr.Header().Set("Content-Type", "application/zip")
+	wr.Header().Set("Content-Disposition", `attachment; filename="account-export.zip"`)
+	wr.WriteHeader(http.StatusOK)
+
+	archive := zip.NewWriter(wr)
+	files := map[string]interface{}{
+		"profile.json":         export.Profile,
+		"sessions.json":        export.Sessions,
+		"audit_logs.json":      export.AuditLogs,
+		"api_keys.json":        export.ApiKeys,
+		"billing.json":         export.Billing,
+		"usage_records.json":   export.UsageRecords,
+		"account_members.json": export.AccountMembers,
+		"trial.json":           export.Trial,
+	}
+	for name, content := range files {
+		file, err := archive.Create(name)
+		if err != nil {
+			utils.Logger(req.Context()).Error("account export failed")
+			return
+		}
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(content)
+		if err != nil {
+			return
+		}
+	}
+	err = archive.Close()
+	if err != nil {
+		return
+	}
+}
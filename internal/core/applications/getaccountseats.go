@@ -0,0 +1,29 @@
+package applications
+
+import (
+	"encoding/json"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+)
+
+// GetAccountSeats TODO: 1. Get the account id from the url, 2. Call Seats method from SeatService, 3. Return the seat usage and the paid seats
+func (m *Microservice) GetAccountSeats(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+
+	seats, err := m.SeatService.Seats(req.Context(), chi.URLParam(req, "id"))
+	if err != nil {
+		wr.WriteHeader(http.StatusInternalServerError)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusInternalServerError})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	wr.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(wr).Encode(&models.SeatsResponse{Seats: toSeatsModel(seats)})
+	if err != nil {
+		return
+	}
+}
@@ -0,0 +1,48 @@
+package applications
+
+import (
+	"encoding/json"
+	"github.com/Lenstack/lensaas-app/internal/core/entities"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"net/http"
+)
+
+// GetApiKeys TODO: 1. Call ListApiKeys method from ApiKeyService, 2. Return the api keys without their secrets
+func (m *Microservice) GetApiKeys(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+
+	apiKeys, err := m.ApiKeyService.ListApiKeys(req.Context(), utils.UserId(req.Context()))
+	if err != nil {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	response := &models.GetApiKeysResponse{ApiKeys: []models.ApiKey{}}
+	for _, apiKey := range apiKeys {
+		response.ApiKeys = append(response.ApiKeys, toApiKeyModel(apiKey))
+	}
+
+	wr.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(wr).Encode(response)
+	if err != nil {
+		return
+	}
+}
+
+func toApiKeyModel(apiKey entities.ApiKey) models.ApiKey {
+	return models.ApiKey{
+		Id:         apiKey.Id,
+		Name:       apiKey.Name,
+		Prefix:     apiKey.Prefix,
+		Scopes:     apiKey.Scopes,
+		ExpiresAt:  apiKey.ExpiresAt,
+		LastUsedAt: apiKey.LastUsedAt,
+		RevokedAt:  apiKey.RevokedAt,
+		CreatedAt:  apiKey.CreatedAt,
+	}
+}
@@ -0,0 +1,80 @@
+package applications
+
+import (
+	"encoding/json"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/Lenstack/lensaas-app/internal/core/repositories"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// GetAuditLogs TODO: 1. Read filters (actor_id, target_id, action, from, to) and pagination (limit, cursor) from the query, 2. Call Query method from AuditService, 3. Return one page
+func (m *Microservice) GetAuditLogs(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+	query := req.URL.Query()
+
+	filter := repositories.AuditLogFilter{
+		ActorId:  query.Get("actor_id"),
+		TargetId: query.Get("target_id"),
+		Action:   query.Get("action"),
+	}
+	var err error
+	if value := query.Get("from"); value != "" {
+		filter.From, err = time.Parse(time.RFC3339, value)
+	}
+	if value := query.Get("to"); value != "" && err == nil {
+		filter.To, err = time.Parse(time.RFC3339, value)
+	}
+	if value := query.Get("limit"); value != "" && err == nil {
+		filter.Limit, err = strconv.ParseUint(value, 10, 64)
+	}
+	if value := query.Get("cursor"); value != "" && err == nil {
+		filter.BeforeSeq, err = strconv.ParseInt(value, 10, 64)
+	}
+	if err != nil {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	auditLogs, nextCursor, err := m.AuditService.Query(req.Context(), filter)
+	if err != nil {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	response := &models.GetAuditLogsResponse{AuditLogs: []models.AuditLog{}}
+	if nextCursor > 0 {
+		response.NextCursor = strconv.FormatInt(nextCursor, 10)
+	}
+	for _, auditLog := range auditLogs {
+		response.AuditLogs = append(response.AuditLogs, models.AuditLog{
+			Id:        auditLog.Id,
+			Seq:       auditLog.Seq,
+			ActorId:   auditLog.ActorId,
+			TargetId:  auditLog.TargetId,
+			Action:    auditLog.Action,
+			Ip:        auditLog.Ip,
+			UserAgent: auditLog.UserAgent,
+			RequestId: auditLog.RequestId,
+			Metadata:  json.RawMessage(auditLog.Metadata),
+			PrevHash:  auditLog.PrevHash,
+			Hash:      auditLog.Hash,
+			CreatedAt: auditLog.CreatedAt,
+		})
+	}
+
+	wr.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(wr).Encode(response)
+	if err != nil {
+		return
+	}
+}
@@ -0,0 +1,38 @@
+package applications
+
+import (
+	"encoding/json"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"net/http"
+)
+
+// GetBillingStatus TODO: 1. Call Status method from DunningService, 2. Return the plan, the subscription status and the failed payment case
+func (m *Microservice) GetBillingStatus(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+
+	status, err := m.DunningService.Status(req.Context(), utils.UserId(req.Context()))
+	if err != nil {
+		wr.WriteHeader(http.StatusInternalServerError)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusInternalServerError})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	wr.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(wr).Encode(&models.BillingStatusResponse{
+		Status:             status.Status,
+		Plan:               status.Plan,
+		SubscriptionStatus: status.SubscriptionStatus,
+		ReadOnly:           status.ReadOnly,
+		PaymentFailedAt:    status.PaymentFailedAt,
+		GraceEndsAt:        status.GraceEndsAt,
+		RestrictedAt:       status.RestrictedAt,
+		RemindersSent:      status.RemindersSent,
+	})
+	if err != nil {
+		return
+	}
+}
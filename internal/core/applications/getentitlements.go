@@ -0,0 +1,29 @@
+package applications
+
+import (
+	"encoding/json"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"net/http"
+)
+
+// GetEntitlements TODO: 1. Call Entitlements method from EntitlementService, 2. Return the plan, features and limits of the user
+func (m *Microservice) GetEntitlements(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+
+	entitlements, err := m.EntitlementService.Entitlements(req.Context(), utils.UserId(req.Context()))
+	if err != nil {
+		wr.WriteHeader(http.StatusInternalServerError)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusInternalServerError})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	wr.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(wr).Encode(&models.EntitlementsResponse{Plan: entitlements.Plan, Features: entitlements.Features, Limits: entitlements.Limits, ReadOnly: entitlements.ReadOnly, TrialEndsAt: entitlements.TrialEndsAt})
+	if err != nil {
+		return
+	}
+}
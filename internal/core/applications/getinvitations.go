@@ -0,0 +1,39 @@
+package applications
+
+import (
+	"encoding/json"
+	"github.com/Lenstack/lensaas-app/internal/core/entities"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"net/http"
+)
+
+// GetInvitations TODO: 1. Call Invitations method from SeatService, 2. Return the invitations of the user
+func (m *Microservice) GetInvitations(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+
+	invitations, err := m.SeatService.Invitations(req.Context(), utils.UserId(req.Context()))
+	if err != nil {
+		wr.WriteHeader(http.StatusInternalServerError)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusInternalServerError})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	response := models.GetInvitationsResponse{Invitations: []models.Invitation{}}
+	for _, invitation := range invitations {
+		response.Invitations = append(response.Invitations, toInvitationModel(invitation))
+	}
+	wr.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(wr).Encode(&response)
+	if err != nil {
+		return
+	}
+}
+
+func toInvitationModel(invitation entities.AccountInvitation) models.Invitation {
+	return models.Invitation{AccountId: invitation.AccountId, OwnerEmail: invitation.OwnerEmail, OwnerName: invitation.OwnerName,
+		InvitedAt: invitation.CreatedAt, ExpiresAt: invitation.ExpiresAt}
+}
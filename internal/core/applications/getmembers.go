@@ -0,0 +1,53 @@
+package applications
+
+import (
+	"encoding/json"
+	"github.com/Lenstack/lensaas-app/internal/core/entities"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/Lenstack/lensaas-app/internal/core/services"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"net/http"
+)
+
+// GetMembers TODO: 1. Call Members and Seats methods from SeatService, 2. Return the members with the seat usage and the paid seats
+func (m *Microservice) GetMembers(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+	accountId := utils.UserId(req.Context())
+
+	members, err := m.SeatService.Members(req.Context(), accountId)
+	if err != nil {
+		wr.WriteHeader(http.StatusInternalServerError)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusInternalServerError})
+		if err != nil {
+			return
+		}
+		return
+	}
+	seats, err := m.SeatService.Seats(req.Context(), accountId)
+	if err != nil {
+		wr.WriteHeader(http.StatusInternalServerError)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusInternalServerError})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	response := models.GetMembersResponse{Members: []models.Member{}, Seats: toSeatsModel(seats)}
+	for _, member := range members {
+		response.Members = append(response.Members, toMemberModel(member))
+	}
+	wr.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(wr).Encode(&response)
+	if err != nil {
+		return
+	}
+}
+
+func toMemberModel(member entities.AccountMember) models.Member {
+	return models.Member{UserId: member.UserId, Email: member.Email, Name: member.Name, AddedAt: member.CreatedAt}
+}
+
+func toSeatsModel(seats services.Seats) models.Seats {
+	return models.Seats{Used: seats.Used, Paid: seats.Paid, Limit: seats.Limit}
+}
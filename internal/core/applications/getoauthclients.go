@@ -0,0 +1,45 @@
+package applications
+
+import (
+	"encoding/json"
+	"github.com/Lenstack/lensaas-app/internal/core/entities"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"net/http"
+)
+
+// GetOAuthClients TODO: 1. Call ListClients method from OAuthClientService, 2. Return the clients without their secrets
+func (m *Microservice) GetOAuthClients(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+
+	clients, err := m.OAuthClientService.ListClients(req.Context())
+	if err != nil {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	response := &models.GetOAuthClientsResponse{Clients: []models.OAuthClient{}}
+	for _, client := range clients {
+		response.Clients = append(response.Clients, toOAuthClientModel(client))
+	}
+
+	wr.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(wr).Encode(response)
+	if err != nil {
+		return
+	}
+}
+
+func toOAuthClientModel(client entities.OAuthClient) models.OAuthClient {
+	return models.OAuthClient{
+		Id:        client.Id,
+		Name:      client.Name,
+		Scopes:    client.Scopes,
+		CreatedBy: client.CreatedBy,
+		RevokedAt: client.RevokedAt,
+		CreatedAt: client.CreatedAt,
+	}
+}
@@ -0,0 +1,27 @@
+package applications
+
+import (
+	"encoding/json"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"net/http"
+)
+
+// GetPlans TODO: 1. Return the plan catalog with its prices, features and limits
+func (m *Microservice) GetPlans(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+
+	response := &models.GetPlansResponse{Plans: []models.Plan{}}
+	for _, plan := range m.EntitlementService.Catalog {
+		priceIds := plan.PriceIds
+		if priceIds == nil {
+			priceIds = []string{}
+		}
+		response.Plans = append(response.Plans, models.Plan{Name: plan.Name, PriceIds: priceIds, Features: plan.Features, Limits: plan.Limits})
+	}
+
+	wr.WriteHeader(http.StatusOK)
+	err := json.NewEncoder(wr).Encode(response)
+	if err != nil {
+		return
+	}
+}
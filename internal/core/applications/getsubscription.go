@@ -0,0 +1,55 @@
+package applications
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Lenstack/lensaas-app/internal/core/entities"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/Lenstack/lensaas-app/internal/core/services"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"net/http"
+)
+
+// GetSubscription TODO: 1. Call GetSubscription method from SubscriptionService, 2. Return the mirrored subscription
+func (m *Microservice) GetSubscription(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+
+	subscription, err := m.SubscriptionService.GetSubscription(req.Context(), utils.UserId(req.Context()))
+	if err != nil {
+		writeSubscriptionError(wr, err)
+		return
+	}
+
+	wr.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(wr).Encode(&models.SubscriptionResponse{Subscription: toSubscriptionModel(subscription)})
+	if err != nil {
+		return
+	}
+}
+
+// writeSubscriptionError answers 404 when the user has no live subscription and 400 otherwise.
+func writeSubscriptionError(wr http.ResponseWriter, err error) {
+	code := http.StatusBadRequest
+	if errors.Is(err, services.ErrSubscriptionNotFound) {
+		code = http.StatusNotFound
+	}
+	wr.WriteHeader(code)
+	err = json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: code})
+	if err != nil {
+		return
+	}
+}
+
+func toSubscriptionModel(subscription entities.Subscription) models.Subscription {
+	return models.Subscription{
+		Id:                 subscription.Id,
+		PriceId:            subscription.PriceId,
+		Status:             subscription.Status,
+		CancelAtPeriodEnd:  subscription.CancelAtPeriodEnd,
+		CurrentPeriodStart: subscription.CurrentPeriodStart,
+		CurrentPeriodEnd:   subscription.CurrentPeriodEnd,
+		CanceledAt:         subscription.CanceledAt,
+		TrialEnd:           subscription.TrialEnd,
+		CreatedAt:          subscription.CreatedAt,
+	}
+}
@@ -0,0 +1,44 @@
+package applications
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"net/http"
+	"time"
+)
+
+// GetTrial TODO: 1. Call GetTrial method from TrialService, 2. Return the trial, 404 when the user never had one
+func (m *Microservice) GetTrial(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+
+	trial, err := m.TrialService.GetTrial(req.Context(), utils.UserId(req.Context()))
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, sql.ErrNoRows) {
+			code = http.StatusNotFound
+			err = errors.New("trial not found")
+		}
+		wr.WriteHeader(code)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: code})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	wr.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(wr).Encode(&models.TrialResponse{Trial: models.Trial{
+		Plan:        trial.Plan,
+		StartedAt:   trial.StartedAt,
+		EndsAt:      trial.EndsAt,
+		Running:     trial.Running(time.Now()),
+		ConvertedAt: trial.ConvertedAt,
+		ExpiredAt:   trial.ExpiredAt,
+	}})
+	if err != nil {
+		return
+	}
+}
@@ -0,0 +1,40 @@
+package applications
+
+import (
+	"encoding/json"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"net/http"
+)
+
+// GetUsage TODO: 1. Call Summary method from UsageService, 2. Return the usage of the current period with the plan limits, -1 is unlimited
+func (m *Microservice) GetUsage(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+
+	summaries, err := m.UsageService.Summary(req.Context(), utils.UserId(req.Context()))
+	if err != nil {
+		wr.WriteHeader(http.StatusInternalServerError)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusInternalServerError})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	response := &models.GetUsageResponse{Usage: []models.Usage{}}
+	for _, summary := range summaries {
+		response.Usage = append(response.Usage, models.Usage{
+			Metric:      summary.Metric,
+			Quantity:    summary.Quantity,
+			Limit:       summary.Limit,
+			PeriodStart: summary.PeriodStart,
+			PeriodEnd:   summary.PeriodEnd,
+		})
+	}
+
+	wr.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(wr).Encode(response)
+	if err != nil {
+		return
+	}
+}
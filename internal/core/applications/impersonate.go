@@ -0,0 +1,52 @@
+package applications
+
+import (
+	"encoding/json"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"time"
+)
+
+// Impersonate TODO: 1. Get the user id from the url and the reason from request, 2. Validate request, 3. Call Impersonate method from UserService, 4. Return the impersonation token
+func (m *Microservice) Impersonate(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+	body := &models.ImpersonateRequest{}
+
+	if err := json.NewDecoder(req.Body).Decode(body); err != nil {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	validateErrors := utils.Validate(body)
+	if len(validateErrors) > 0 {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(validateErrors)
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	accessToken, expiresIn, err := m.UserService.Impersonate(req.Context(), chi.URLParam(req, "id"), body.Reason)
+	if err != nil {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	wr.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(wr).Encode(&models.ImpersonateResponse{AccessToken: accessToken, ExpiresIn: time.Now().Add(expiresIn), UserId: chi.URLParam(req, "id"),
+		ActorId: utils.UserId(req.Context()), Impersonated: true})
+	if err != nil {
+		return
+	}
+}
@@ -0,0 +1,72 @@
+package applications
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/Lenstack/lensaas-app/internal/core/services"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"net/http"
+)
+
+// InviteMember TODO: 1. Get the email of the user from request, 2. Validate request, 3. Call InviteMember method from SeatService, 4. Return the same message whether the email is registered or not
+func (m *Microservice) InviteMember(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+	body := &models.InviteMemberRequest{}
+
+	if err := json.NewDecoder(req.Body).Decode(body); err != nil {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	validateErrors := utils.Validate(body)
+	if len(validateErrors) > 0 {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(validateErrors)
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	err := m.SeatService.InviteMember(req.Context(), utils.UserId(req.Context()), body.Email)
+	if err != nil {
+		writeMemberError(wr, err)
+		return
+	}
+
+	wr.WriteHeader(http.StatusAccepted)
+	err = json.NewEncoder(wr).Encode(&models.InviteMemberResponse{Message: "the user of the email is invited when registered"})
+	if err != nil {
+		return
+	}
+}
+
+// writeMemberError answers 402 beyond the plan seats, 404 for unknown members and invitations, 409 for users in an
+// account, 400 for the owner and 500 for database and provider failures.
+func writeMemberError(wr http.ResponseWriter, err error) {
+	var entitlementError *services.EntitlementError
+	if errors.As(err, &entitlementError) {
+		writeEntitlementError(wr, err)
+		return
+	}
+
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrMemberNotFound), errors.Is(err, services.ErrInvitationNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, services.ErrMemberExists):
+		code = http.StatusConflict
+	case errors.Is(err, services.ErrMemberIsOwner):
+		code = http.StatusBadRequest
+	}
+	wr.WriteHeader(code)
+	err = json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: code})
+	if err != nil {
+		return
+	}
+}
@@ -0,0 +1,25 @@
+package applications
+
+import (
+	"encoding/json"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"net/http"
+)
+
+// LeaveAccount TODO: 1. Call LeaveAccount method from SeatService, 2. Return success message
+func (m *Microservice) LeaveAccount(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+
+	err := m.SeatService.LeaveAccount(req.Context(), utils.UserId(req.Context()))
+	if err != nil {
+		writeMemberError(wr, err)
+		return
+	}
+
+	wr.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(wr).Encode(&models.LeaveAccountResponse{Message: "account left successfully"})
+	if err != nil {
+		return
+	}
+}
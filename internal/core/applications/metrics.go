@@ -0,0 +1,11 @@
+package applications
+
+import (
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+// Metrics TODO 1. Expose the prometheus registry of the metrics service
+func (m *Microservice) Metrics(wr http.ResponseWriter, req *http.Request) {
+	promhttp.HandlerFor(m.MetricsService.Registry, promhttp.HandlerOpts{}).ServeHTTP(wr, req)
+}
@@ -2,15 +2,32 @@ package applications
 
 import (
 	"github.com/Lenstack/lensaas-app/internal/core/services"
+	"go.uber.org/zap"
 )
 
 type Microservice struct {
-	EmailService  services.EmailService
-	TokenService  services.TokenService
-	UserService   services.UserService
-	StripeService services.StripeService
+	EmailService        services.EmailService
+	TokenService        services.TokenService
+	UserService         services.UserService
+	BillingService      services.BillingService
+	SubscriptionService services.SubscriptionService
+	MetricsService      services.MetricsService
+	ErrorReporter       services.IErrorReporter
+	RateLimitService    services.RateLimitService
+	AccountService      services.AccountService
+	ApiKeyService       services.ApiKeyService
+	OAuthClientService  services.OAuthClientService
+	AuditService        services.AuditService
+	WebhookService      services.WebhookService
+	EntitlementService  services.EntitlementService
+	UsageService        services.UsageService
+	CheckoutService     services.CheckoutService
+	DunningService      services.DunningService
+	SeatService         services.SeatService
+	TrialService        services.TrialService
+	Logger              *zap.Logger
 }
 
-func NewMicroservice(emailService services.EmailService, tokenService services.TokenService, userService services.UserService, stripeService services.StripeService) *Microservice {
-	return &Microservice{EmailService: emailService, TokenService: tokenService, UserService: userService, StripeService: stripeService}
+func NewMicroservice(emailService services.EmailService, tokenService services.TokenService, userService services.UserService, billingService services.BillingService, subscriptionService services.SubscriptionService, metricsService services.MetricsService, errorReporter services.IErrorReporter, rateLimitService services.RateLimitService, accountService services.AccountService, apiKeyService services.ApiKeyService, oauthClientService services.OAuthClientService, auditService services.AuditService, webhookService services.WebhookService, entitlementService services.EntitlementService, usageService services.UsageService, checkoutService services.CheckoutService, dunningService services.DunningService, seatService services.SeatService, trialService services.TrialService, logger *zap.Logger) *Microservice {
+	return &Microservice{EmailService: emailService, TokenService: tokenService, UserService: userService, BillingService: billingService, SubscriptionService: subscriptionService, MetricsService: metricsService, ErrorReporter: errorReporter, RateLimitService: rateLimitService, AccountService: accountService, ApiKeyService: apiKeyService, OAuthClientService: oauthClientService, AuditService: auditService, WebhookService: webhookService, EntitlementService: entitlementService, UsageService: usageService, CheckoutService: checkoutService, DunningService: dunningService, SeatService: seatService, TrialService: trialService, Logger: logger}
 }
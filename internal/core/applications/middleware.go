@@ -1,19 +1,76 @@
 package applications
 
 import (
-	"context"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/Lenstack/lensaas-app/internal/core/services"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"io"
 	"net/http"
+	"runtime/debug"
+	"strconv"
 	"strings"
+	"time"
 )
 
-// MiddlewareAuth TODO 1. Add a middleware to the microservice, 2. Add a middleware to the routes
+const (
+	requestIdHeader = "X-Request-ID"
+	apiKeyHeader    = "X-API-Key"
+
+	impersonatedByHeader = "X-Impersonated-By"
+
+	// upgradeUrl lists the plans and their prices in 402 answers.
+	upgradeUrl = "/v1/billing/plans"
+)
+
+// validRequestId rejects client supplied ids that are empty, oversized or contain non printable characters.
+func validRequestId(requestId string) bool {
+	if requestId == "" || len(requestId) > 128 {
+		return false
+	}
+	for _, character := range requestId {
+		if character < 0x21 || character > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// MiddlewareAuth TODO 1. Authenticate an api key, a user token or a client token, 2. Put the principal in the context
 func (m *Microservice) MiddlewareAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
 		wr.Header().Set("Content-Type", "application/json")
 
+		// Api keys authenticate as their owner, restricted to the scopes of the key.
+		if key := req.Header.Get(apiKeyHeader); key != "" {
+			apiKey, err := m.ApiKeyService.Authenticate(req.Context(), key)
+			if err != nil {
+				wr.WriteHeader(http.StatusUnauthorized)
+				err := json.NewEncoder(wr).Encode(&models.Error{Message: "Unauthorized", Code: http.StatusUnauthorized})
+				if err != nil {
+					return
+				}
+				return
+			}
+
+			ctx := utils.WithUserId(req.Context(), apiKey.UserId)
+			if len(apiKey.Scopes) > 0 {
+				ctx = utils.WithScopes(ctx, apiKey.Scopes)
+			}
+			next.ServeHTTP(wr, req.WithContext(ctx))
+			return
+		}
+
 		token := req.Header.Get("Authorization")
 		if token == "" {
 			wr.WriteHeader(http.StatusUnauthorized)
@@ -36,8 +93,17 @@ func (m *Microservice) MiddlewareAuth(next http.Handler) http.Handler {
 
 		clearedToken := parts[1]
 
-		userId, err := m.TokenService.ValidateToken(clearedToken)
+		userId, authentication, err := m.TokenService.ValidateAccessToken(clearedToken)
 		if err != nil {
+			// Client credentials tokens act as the client itself, always limited to their scopes.
+			clientId, scopes, clientErr := m.TokenService.ValidateClientToken(clearedToken)
+			if clientErr == nil {
+				ctx := utils.WithPrincipal(req.Context(), utils.PrincipalInfo{Type: utils.PrincipalClient, Id: clientId})
+				ctx = utils.WithLogger(ctx, utils.Logger(ctx).With(zap.String("client_id", clientId)))
+				next.ServeHTTP(wr, req.WithContext(utils.WithScopes(ctx, scopes)))
+				return
+			}
+
 			wr.WriteHeader(http.StatusUnauthorized)
 			err := json.NewEncoder(wr).Encode(&models.Error{Message: "Unauthorized", Code: http.StatusUnauthorized})
 			if err != nil {
@@ -47,29 +113,277 @@ func (m *Microservice) MiddlewareAuth(next http.Handler) http.Handler {
 		}
 
 		// Set the userId in the request context
-		ctx := req.Context()
-		ctx = context.WithValue(ctx, "userId", userId)
-		req = req.WithContext(ctx)
+		ctx := utils.WithUserId(req.Context(), userId)
+		if authentication.ActorId != "" {
+			// Impersonated sessions are flagged on every response so clients can show a banner.
+			wr.Header().Set(impersonatedByHeader, authentication.ActorId)
+			ctx = utils.WithLogger(ctx, utils.Logger(ctx).With(zap.String("impersonator_id", authentication.ActorId)))
+		}
+		req = req.WithContext(utils.WithAuthentication(ctx, authentication))
 
 		next.ServeHTTP(wr, req)
 	})
 }
 
-// MiddlewarePermission TODO 1. Add a middleware to the microservice, 2. Add a middleware to the routes
-func (m *Microservice) MiddlewarePermission(next http.Handler) http.Handler {
+// MiddlewareScope TODO 1. Let unrestricted requests through, 2. Return a 403 when the api key lacks the scope
+func (m *Microservice) MiddlewareScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if scopes, restricted := utils.Scopes(r.Context()); restricted && !services.HasScope(scopes, scope) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				err := json.NewEncoder(w).Encode(&models.Error{Message: "missing scope " + scope, Code: http.StatusForbidden})
+				if err != nil {
+					return
+				}
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// MiddlewarePermission TODO 1. Load the role of the authenticated user, 2. Return a 403 when it does not match
+func (m *Microservice) MiddlewarePermission(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			allowed, err := m.UserService.HasRole(r.Context(), utils.UserId(r.Context()), role)
+			if err != nil || !allowed {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				err := json.NewEncoder(w).Encode(&models.Error{Message: "Forbidden", Code: http.StatusForbidden})
+				if err != nil {
+					return
+				}
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// MiddlewareRecentAuth TODO 1. Check the caller authenticated within maxAge, 2. Return a 401 step-up challenge (RFC 9470) pointing to the re-authenticate endpoint otherwise
+func (m *Microservice) MiddlewareRecentAuth(maxAge time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authentication := utils.Authentication(r.Context())
+			if authentication.Time.IsZero() || time.Since(authentication.Time) > maxAge {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_user_authentication", error_description="a more recent authentication is required", max_age=%d`, int(maxAge.Seconds())))
+				w.WriteHeader(http.StatusUnauthorized)
+				err := json.NewEncoder(w).Encode(&models.AuthenticationChallenge{
+					Code:              http.StatusUnauthorized,
+					Message:           "a more recent authentication is required",
+					Error:             "insufficient_user_authentication",
+					MaxAge:            int(maxAge.Seconds()),
+					ReauthenticateUrl: "/v1/me/reauthenticate",
+				})
+				if err != nil {
+					return
+				}
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// MiddlewareNoImpersonation TODO 1. Return a 403 when the request is made through an impersonation token
+func (m *Microservice) MiddlewareNoImpersonation(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Do stuff here
-		// If the user is not authorized, return a 401
+		if utils.Authentication(r.Context()).ActorId != "" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			err := json.NewEncoder(w).Encode(&models.Error{Message: "this operation is not allowed while impersonating", Code: http.StatusForbidden})
+			if err != nil {
+				return
+			}
+			return
+		}
 		next.ServeHTTP(w, r)
 	})
 }
 
-// MiddlewareLogger TODO 1. Add a middleware to the microservice, 2. Add a middleware to the routes
+// MiddlewareEntitlement TODO 1. Check the plan of the user includes the feature, 2. Return a 402 with the plan to upgrade to otherwise
+func (m *Microservice) MiddlewareEntitlement(feature string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			err := m.EntitlementService.RequireFeature(r.Context(), utils.UserId(r.Context()), feature)
+			if err != nil {
+				writeEntitlementError(w, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// MiddlewareWritable TODO 1. Let reads through, 2. Return a 402 for other methods while the account is read-only for a failed payment
+func (m *Microservice) MiddlewareWritable() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				next.ServeHTTP(w, r)
+				return
+			}
+			err := m.EntitlementService.RequireWritable(r.Context(), utils.UserId(r.Context()))
+			if err != nil {
+				writeEntitlementError(w, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// writeEntitlementError answers 402 with an upgrade hint for entitlement errors and 500 for lookup failures.
+func writeEntitlementError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	var entitlementError *services.EntitlementError
+	if !errors.As(err, &entitlementError) {
+		w.WriteHeader(http.StatusInternalServerError)
+		err := json.NewEncoder(w).Encode(&models.Error{Message: err.Error(), Code: http.StatusInternalServerError})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusPaymentRequired)
+	err = json.NewEncoder(w).Encode(&models.UpgradeRequired{
+		Code:        http.StatusPaymentRequired,
+		Message:     entitlementError.Error(),
+		Plan:        entitlementError.Plan,
+		Feature:     entitlementError.Feature,
+		Limit:       entitlementError.Limit,
+		UpgradePlan: entitlementError.UpgradePlan,
+		UpgradeUrl:  upgradeUrl,
+		ReadOnly:    entitlementError.ReadOnly,
+	})
+	if err != nil {
+		return
+	}
+}
+
+// MiddlewareQuota TODO 1. Check the user has not used up the plan limit of the metric this period, 2. Return a 402 with the plan to upgrade to otherwise, impersonated requests are not billed
+func (m *Microservice) MiddlewareQuota(metric string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userId := utils.UserId(r.Context())
+			if userId != "" && utils.Authentication(r.Context()).ActorId == "" {
+				err := m.UsageService.RequireQuota(r.Context(), userId, metric)
+				if err != nil {
+					writeEntitlementError(w, err)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// MiddlewareUsage TODO 1. Serve the request, 2. Meter it for the authenticated user when it succeeded, impersonated requests are not billed
+func (m *Microservice) MiddlewareUsage(metric string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+
+			userId := utils.UserId(r.Context())
+			if userId == "" || utils.Authentication(r.Context()).ActorId != "" || ww.Status() >= http.StatusBadRequest {
+				return
+			}
+			if err := m.UsageService.Record(r.Context(), userId, metric, 1); err != nil {
+				utils.Logger(r.Context()).Warn("usage not recorded", zap.String("metric", metric), zap.Error(err))
+			}
+		})
+	}
+}
+
+// MiddlewareRequestId TODO 1. Propagate the X-Request-ID header or generate a new one, 2. Echo it in the response
+func (m *Microservice) MiddlewareRequestId(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestId := r.Header.Get(requestIdHeader)
+		if !validRequestId(requestId) {
+			requestId = uuid.New().String()
+		}
+		w.Header().Set(requestIdHeader, requestId)
+		ctx := utils.WithRequestId(r.Context(), requestId)
+		ctx = utils.WithClient(ctx, utils.ClientInfo{Ip: m.clientIp(r), UserAgent: r.UserAgent()})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// MiddlewareLogger TODO 1. Attach a request-scoped logger to the context, 2. Write one access log line per request
 func (m *Microservice) MiddlewareLogger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Do stuff here
-		fmt.Println("Request: ", r.Method, r.URL.Path)
-		next.ServeHTTP(w, r)
+		start := time.Now()
+		requestId := utils.RequestId(r.Context())
+		logger := m.Logger.With(zap.String("request_id", requestId))
+		if spanContext := trace.SpanContextFromContext(r.Context()); spanContext.HasTraceID() {
+			logger = logger.With(zap.String("trace_id", spanContext.TraceID().String()))
+		}
+
+		requestLog := &utils.RequestLog{}
+		ctx := utils.WithLogger(r.Context(), logger)
+		ctx = utils.WithRequestLog(ctx, requestLog)
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		logger.Info("request",
+			zap.String("method", r.Method),
+			zap.String("route", chi.RouteContext(r.Context()).RoutePattern()),
+			zap.String("path", r.URL.Path),
+			zap.Int("status", status),
+			zap.Duration("latency", time.Since(start)),
+			zap.Int("bytes", ww.BytesWritten()),
+			zap.String("user_id", requestLog.UserId),
+			zap.String("remote_ip", r.RemoteAddr),
+			zap.String("user_agent", r.UserAgent()),
+		)
+	})
+}
+
+// MiddlewareTracing TODO 1. Name the server span after the chi route pattern, 2. Record the response status
+func (m *Microservice) MiddlewareTracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		span := trace.SpanFromContext(r.Context())
+		if route := chi.RouteContext(r.Context()).RoutePattern(); route != "" {
+			span.SetName(r.Method + " " + route)
+			span.SetAttributes(semconv.HTTPRoute(route))
+		}
+		if ww.Status() >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(ww.Status()))
+		}
+	})
+}
+
+// MiddlewareMetrics TODO 1. Record request count and latency by chi route pattern and status
+func (m *Microservice) MiddlewareMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		// The route pattern is only known once chi has finished routing the request.
+		route := chi.RouteContext(r.Context()).RoutePattern()
+		if route == "" {
+			route = "not_found"
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		m.MetricsService.ObserveRequest(r.Method, route, status, time.Since(start))
 	})
 }
 
@@ -79,8 +393,9 @@ func (m *Microservice) MiddlewareCORS(next http.Handler) http.Handler {
 		// Set CORS headers
 		w.Header().Set("Access-Control-Allow-Origin", "http://localhost:3000")
 		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-API-Key, X-Request-ID")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, X-Impersonated-By")
 		// Stop here for a Preflighted OPTIONS request.
 		if r.Method == "OPTIONS" {
 			return
@@ -89,18 +404,145 @@ func (m *Microservice) MiddlewareCORS(next http.Handler) http.Handler {
 	})
 }
 
-// MiddlewareRecovery TODO 1. Add a middleware to the microservice, 2. Add a middleware to the routes
+// MiddlewareRecovery TODO 1. Recover from panics, 2. Log the stack with the request id, 3. Report the panic, 4. Return a JSON 500
 func (m *Microservice) MiddlewareRecovery(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Do stuff here
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			// http.ErrAbortHandler is the documented way to abort a response, let net/http handle it.
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			stack := debug.Stack()
+			route := chi.RouteContext(r.Context()).RoutePattern()
+			utils.Logger(r.Context()).Error("panic recovered",
+				zap.Any("panic", recovered),
+				zap.String("route", route),
+				zap.ByteString("stack", stack),
+			)
+			m.MetricsService.IncPanic(route)
+
+			if m.ErrorReporter != nil {
+				err := m.ErrorReporter.Report(r.Context(), services.ErrorReport{
+					RequestId: utils.RequestId(r.Context()),
+					UserId:    utils.UserId(r.Context()),
+					Method:    r.Method,
+					Path:      r.URL.Path,
+					Error:     fmt.Sprint(recovered),
+					Stack:     string(stack),
+					Time:      time.Now(),
+				})
+				if err != nil {
+					utils.Logger(r.Context()).Error("error reporter failed", zap.Error(err))
+				}
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			err := json.NewEncoder(w).Encode(&models.Error{Message: http.StatusText(http.StatusInternalServerError), Code: http.StatusInternalServerError})
+			if err != nil {
+				return
+			}
+		}()
 		next.ServeHTTP(w, r)
 	})
 }
 
-// MiddlewareRateLimit TODO 1. Add a middleware to the microservice, 2. Add a middleware to the routes
-func (m *Microservice) MiddlewareRateLimit(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Do stuff here
-		next.ServeHTTP(w, r)
-	})
+// MiddlewareRateLimit TODO 1. Resolve the policy keys (ip, user, email), 2. Check the limits in redis, 3. Set the RateLimit headers
+func (m *Microservice) MiddlewareRateLimit(policyName string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			policy, ok := m.RateLimitService.Policy(policyName)
+			ip := m.clientIp(r)
+			if !ok || m.RateLimitService.Allowlisted(ip) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			keys := map[string]string{
+				services.RateLimitKeyIp:   ip,
+				services.RateLimitKeyUser: utils.Principal(r.Context()).Id,
+			}
+			for _, key := range policy.Keys {
+				if key == services.RateLimitKeyEmail {
+					keys[services.RateLimitKeyEmail] = peekEmail(r)
+				}
+			}
+
+			result, err := m.RateLimitService.Allow(r.Context(), policy, keys)
+			if err != nil {
+				// Fail open: an unavailable redis must not take authentication down with it.
+				utils.Logger(r.Context()).Error("rate limit check failed", zap.Error(err))
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+			if !result.Allowed {
+				m.MetricsService.IncRateLimited(policy.Name)
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusTooManyRequests)
+				err := json.NewEncoder(w).Encode(&models.Error{Message: "Too Many Requests", Code: http.StatusTooManyRequests})
+				if err != nil {
+					return
+				}
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientIp returns the address of the client, X-Forwarded-For is only read behind a trusted proxy.
+func (m *Microservice) clientIp(r *http.Request) string {
+	return m.RateLimitService.ClientIp(r.RemoteAddr, r.Header.Get("X-Forwarded-For"))
+}
+
+// peekEmail reads the email field of a JSON body and restores the body for the handler.
+func peekEmail(r *http.Request) string {
+	if r.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		return ""
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	payload := struct {
+		Email string `json:"email"`
+	}{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(payload.Email))
+}
+
+// writeLockoutError answers 429, or 423 once the account is locked, with Retry-After for lockout errors. It reports
+// whether the error was one.
+func writeLockoutError(w http.ResponseWriter, err error) bool {
+	var lockoutError *services.LockoutError
+	if !errors.As(err, &lockoutError) {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(lockoutError.RetryAfter)))
+	status := http.StatusTooManyRequests
+	if lockoutError.Locked {
+		status = http.StatusLocked
+	}
+	w.WriteHeader(status)
+	// The answer is written either way, an encoding failure leaves nothing else to do.
+	json.NewEncoder(w).Encode(&models.Error{Message: lockoutError.Error(), Code: status})
+	return true
+}
+
+func ceilSeconds(duration time.Duration) int {
+	return int((duration + time.Second - 1) / time.Second)
 }
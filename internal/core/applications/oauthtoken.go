@@ -0,0 +1,73 @@
+package applications
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/Lenstack/lensaas-app/internal/core/services"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// OAuthToken TODO: 1. Read the form and the client credentials (basic auth or body), 2. Call ClientCredentials method from OAuthClientService, 3. Return the token as described by RFC 6749
+func (m *Microservice) OAuthToken(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+	wr.Header().Set("Cache-Control", "no-store")
+	wr.Header().Set("Pragma", "no-cache")
+
+	if err := req.ParseForm(); err != nil {
+		writeOAuthError(wr, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	if grantType := req.PostForm.Get("grant_type"); grantType != services.GrantTypeClientCredentials {
+		writeOAuthError(wr, http.StatusBadRequest, "unsupported_grant_type", "only the client_credentials grant is supported")
+		return
+	}
+
+	// Basic credentials are form-urlencoded before being base64 encoded (RFC 6749 section 2.3.1).
+	clientId, clientSecret, ok := req.BasicAuth()
+	if ok {
+		clientId, _ = url.QueryUnescape(clientId)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientId, clientSecret = req.PostForm.Get("client_id"), req.PostForm.Get("client_secret")
+	}
+	if clientId == "" || clientSecret == "" {
+		writeOAuthError(wr, http.StatusUnauthorized, "invalid_client", "client credentials are required")
+		return
+	}
+
+	token, scopes, expiresIn, err := m.OAuthClientService.ClientCredentials(req.Context(), clientId, clientSecret, req.PostForm.Get("scope"))
+	var oauthError *services.OAuthError
+	if errors.As(err, &oauthError) {
+		status := http.StatusBadRequest
+		if oauthError.Code == "invalid_client" {
+			status = http.StatusUnauthorized
+		}
+		writeOAuthError(wr, status, oauthError.Code, oauthError.Description)
+		return
+	}
+	if err != nil {
+		writeOAuthError(wr, http.StatusInternalServerError, "server_error", "the token could not be issued")
+		return
+	}
+
+	wr.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(wr).Encode(&models.OAuthTokenResponse{AccessToken: token, TokenType: "Bearer", ExpiresIn: int(expiresIn.Seconds()), Scope: strings.Join(scopes, " ")})
+	if err != nil {
+		return
+	}
+}
+
+func writeOAuthError(wr http.ResponseWriter, status int, code string, description string) {
+	if status == http.StatusUnauthorized {
+		wr.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	wr.WriteHeader(status)
+	err := json.NewEncoder(wr).Encode(&models.OAuthError{Error: code, ErrorDescription: description})
+	if err != nil {
+		return
+	}
+}
@@ -0,0 +1,50 @@
+package applications
+
+import (
+	"encoding/json"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"net/http"
+)
+
+// PreviewSubscription TODO: 1. Get the new price id from request, 2. Validate request, 3. Call PreviewChange method from SubscriptionService, 4. Return the prorated amounts and the proration date to confirm with
+func (m *Microservice) PreviewSubscription(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+	body := &models.PreviewSubscriptionRequest{}
+
+	if err := json.NewDecoder(req.Body).Decode(body); err != nil {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	validateErrors := utils.Validate(body)
+	if len(validateErrors) > 0 {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(validateErrors)
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	preview, err := m.SubscriptionService.PreviewChange(req.Context(), utils.UserId(req.Context()), body.PriceId)
+	if err != nil {
+		writeSubscriptionError(wr, err)
+		return
+	}
+
+	wr.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(wr).Encode(&models.PreviewSubscriptionResponse{
+		AmountDue:       preview.AmountDue,
+		ProrationAmount: preview.ProrationAmount,
+		Currency:        preview.Currency,
+		ProrationDate:   preview.ProrationDate,
+	})
+	if err != nil {
+		return
+	}
+}
@@ -0,0 +1,53 @@
+package applications
+
+import (
+	"encoding/json"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"net/http"
+	"time"
+)
+
+// Reauthenticate TODO: 1. Get password from request, 2. Validate request, 3. Call Reauthenticate method from UserService, 4. Return elevated token
+func (m *Microservice) Reauthenticate(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+	body := &models.ReauthenticateRequest{}
+
+	if err := json.NewDecoder(req.Body).Decode(body); err != nil {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	validateErrors := utils.Validate(body)
+	if len(validateErrors) > 0 {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(validateErrors)
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	accessToken, expiresIn, err := m.UserService.Reauthenticate(req.Context(), utils.UserId(req.Context()), body.Password)
+	if writeLockoutError(wr, err) {
+		return
+	}
+	if err != nil {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	wr.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(wr).Encode(&models.ReauthenticateResponse{AccessToken: accessToken, ExpiresIn: time.Now().Add(expiresIn)})
+	if err != nil {
+		return
+	}
+}
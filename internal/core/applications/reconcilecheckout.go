@@ -0,0 +1,66 @@
+package applications
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/Lenstack/lensaas-app/internal/core/services"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"net/http"
+)
+
+// ReconcileCheckout TODO: 1. Get the session id the success url was called with, 2. Validate request, 3. Call ReconcileCheckout method from CheckoutService, sessions of other users are not found, 4. Return the session status and the subscription once it completed
+func (m *Microservice) ReconcileCheckout(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+	body := &models.ReconcileCheckoutRequest{}
+
+	if err := json.NewDecoder(req.Body).Decode(body); err != nil {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	validateErrors := utils.Validate(body)
+	if len(validateErrors) > 0 {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(validateErrors)
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	reconciliation, err := m.CheckoutService.ReconcileCheckout(req.Context(), utils.UserId(req.Context()), body.SessionId)
+	if err != nil {
+		code := http.StatusBadRequest
+		if errors.Is(err, services.ErrCheckoutSessionNotFound) {
+			code = http.StatusNotFound
+		}
+		wr.WriteHeader(code)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: code})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	response := &models.ReconcileCheckoutResponse{Status: reconciliation.Status, PaymentStatus: reconciliation.PaymentStatus}
+	if reconciliation.Subscription != nil {
+		subscription := toSubscriptionModel(*reconciliation.Subscription)
+		response.Subscription = &subscription
+	}
+
+	// The subscription may still be settling, the client polls until it is there.
+	code := http.StatusOK
+	if response.Subscription == nil {
+		code = http.StatusAccepted
+	}
+	wr.WriteHeader(code)
+	err = json.NewEncoder(wr).Encode(response)
+	if err != nil {
+		return
+	}
+}
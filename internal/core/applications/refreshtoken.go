@@ -31,7 +31,7 @@ func (m *Microservice) RefreshToken(wr http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	accessToken, expiresIn, err := m.UserService.RefreshToken(body.RefreshToken)
+	accessToken, expiresIn, err := m.UserService.RefreshToken(req.Context(), body.RefreshToken)
 	if err != nil {
 		wr.WriteHeader(http.StatusBadRequest)
 		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
@@ -0,0 +1,60 @@
+package applications
+
+import (
+	"encoding/json"
+	"github.com/Lenstack/lensaas-app/internal/core/billing"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"net/http"
+)
+
+// RefundPayment TODO: 1. Validate request, 2. Call Refund method from BillingService, the request id keeps retries from refunding twice, 3. Return the refund
+func (m *Microservice) RefundPayment(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+	body := &models.RefundRequest{}
+
+	if err := json.NewDecoder(req.Body).Decode(body); err != nil {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	validateErrors := utils.Validate(body)
+	if len(validateErrors) > 0 {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(validateErrors)
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	params := billing.RefundParams{PaymentId: body.PaymentId, Amount: body.Amount, Currency: body.Currency, Reason: body.Reason}
+	if requestId := utils.RequestId(req.Context()); requestId != "" {
+		params.IdempotencyKey = "refund-" + body.PaymentId + "-" + requestId
+	}
+	refund, err := m.BillingService.Refund(req.Context(), body.Provider, params)
+	if err != nil {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	wr.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(wr).Encode(&models.RefundResponse{
+		Id:        refund.Id,
+		PaymentId: refund.PaymentId,
+		Amount:    refund.Amount,
+		Currency:  refund.Currency,
+		Status:    refund.Status,
+	})
+	if err != nil {
+		return
+	}
+}
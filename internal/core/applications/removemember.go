@@ -0,0 +1,26 @@
+package applications
+
+import (
+	"encoding/json"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+)
+
+// RemoveMember TODO 1. Get the member id from the url, 2. Call RemoveMember method from SeatService, 3. Return success message
+func (m *Microservice) RemoveMember(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+
+	err := m.SeatService.RemoveMember(req.Context(), utils.UserId(req.Context()), chi.URLParam(req, "id"))
+	if err != nil {
+		writeMemberError(wr, err)
+		return
+	}
+
+	wr.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(wr).Encode(&models.RemoveMemberResponse{Message: "member removed successfully"})
+	if err != nil {
+		return
+	}
+}
@@ -0,0 +1,25 @@
+package applications
+
+import (
+	"encoding/json"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"net/http"
+)
+
+// ResumeSubscription TODO: 1. Call ResumeSubscription method from SubscriptionService, 2. Return the subscription
+func (m *Microservice) ResumeSubscription(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+
+	subscription, err := m.SubscriptionService.ResumeSubscription(req.Context(), utils.UserId(req.Context()))
+	if err != nil {
+		writeSubscriptionError(wr, err)
+		return
+	}
+
+	wr.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(wr).Encode(&models.SubscriptionResponse{Subscription: toSubscriptionModel(subscription)})
+	if err != nil {
+		return
+	}
+}
@@ -0,0 +1,30 @@
+package applications
+
+import (
+	"encoding/json"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+)
+
+// RevokeApiKey TODO 1. Get the api key id from the url, 2. Call RevokeApiKey method from ApiKeyService, 3. Return success message
+func (m *Microservice) RevokeApiKey(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+
+	message, err := m.ApiKeyService.RevokeApiKey(req.Context(), utils.UserId(req.Context()), chi.URLParam(req, "id"))
+	if err != nil {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	wr.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(wr).Encode(&models.RevokeApiKeyResponse{Message: message})
+	if err != nil {
+		return
+	}
+}
@@ -32,7 +32,10 @@ func (m *Microservice) SignIn(wr http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	accessToken, refreshToken, expiresIn, err := m.UserService.SignIn(body.Email, body.Password)
+	accessToken, refreshToken, expiresIn, err := m.UserService.SignIn(req.Context(), body.Email, body.Password)
+	if writeLockoutError(wr, err) {
+		return
+	}
 	if err != nil {
 		wr.WriteHeader(http.StatusBadRequest)
 		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
@@ -31,7 +31,7 @@ func (m *Microservice) SignOut(wr http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	message, err := m.UserService.RevokeToken(body.RefreshToken)
+	message, err := m.UserService.RevokeToken(req.Context(), body.RefreshToken)
 	if err != nil {
 		wr.WriteHeader(http.StatusBadRequest)
 		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
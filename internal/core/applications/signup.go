@@ -32,7 +32,7 @@ func (m *Microservice) SignUp(wr http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	message, err := m.UserService.SignUp(entities.User{Name: body.Name, Email: body.Email, Password: body.Password})
+	message, err := m.UserService.SignUp(req.Context(), entities.User{Name: body.Name, Email: body.Email, Password: body.Password})
 	if err != nil {
 		wr.WriteHeader(http.StatusBadRequest)
 		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
@@ -0,0 +1,38 @@
+package applications
+
+import (
+	"encoding/json"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"net/http"
+)
+
+// UnlockAccount TODO 1. Get token from request, 2. Call UnlockAccount method from UserService, 3. Return success message
+func (m *Microservice) UnlockAccount(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+
+	token := req.URL.Query().Get("token")
+	if token == "" {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: "token is required", Code: http.StatusBadRequest})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	message, err := m.UserService.UnlockAccount(req.Context(), token)
+	if err != nil {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	wr.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(wr).Encode(&models.UnlockAccountResponse{Message: message})
+	if err != nil {
+		return
+	}
+}
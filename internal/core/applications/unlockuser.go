@@ -0,0 +1,29 @@
+package applications
+
+import (
+	"encoding/json"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+)
+
+// UnlockUser TODO 1. Get the user id from the url, 2. Call UnlockUser method from UserService, 3. Return success message
+func (m *Microservice) UnlockUser(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+
+	message, err := m.UserService.UnlockUser(req.Context(), chi.URLParam(req, "id"))
+	if err != nil {
+		wr.WriteHeader(http.StatusBadRequest)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	wr.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(wr).Encode(&models.UnlockAccountResponse{Message: message})
+	if err != nil {
+		return
+	}
+}
@@ -42,7 +42,7 @@ func (m *Microservice) VerificationCode(wr http.ResponseWriter, req *http.Reques
 		return
 	}
 
-	message, err := m.UserService.VerifyCode(token, body.Code)
+	message, err := m.UserService.VerifyCode(req.Context(), token, body.Code)
 	if err != nil {
 		wr.WriteHeader(http.StatusBadRequest)
 		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
@@ -20,7 +20,7 @@ func (m *Microservice) VerificationEmail(wr http.ResponseWriter, req *http.Reque
 		return
 	}
 
-	message, err := m.UserService.VerifyEmail(token)
+	message, err := m.UserService.VerifyEmail(req.Context(), token)
 	if err != nil {
 		wr.WriteHeader(http.StatusBadRequest)
 		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusBadRequest})
@@ -0,0 +1,28 @@
+package applications
+
+import (
+	"encoding/json"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"net/http"
+)
+
+// VerifyAuditLogs TODO: 1. Call Verify method from AuditService, 2. Return whether the hash chain is intact
+func (m *Microservice) VerifyAuditLogs(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json")
+
+	verification, err := m.AuditService.Verify(req.Context())
+	if err != nil {
+		wr.WriteHeader(http.StatusInternalServerError)
+		err := json.NewEncoder(wr).Encode(&models.Error{Message: err.Error(), Code: http.StatusInternalServerError})
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	wr.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(wr).Encode(&models.VerifyAuditLogsResponse{Valid: verification.Valid, Checked: verification.Checked, BrokenAt: verification.BrokenAt})
+	if err != nil {
+		return
+	}
+}
@@ -0,0 +1,190 @@
+package billing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+const (
+	ProviderStripe = "stripe"
+	ProviderPayPal = "paypal"
+	ProviderFake   = "fake"
+)
+
+// Event kinds every provider maps its webhook events to, other events are acknowledged without work.
+const (
+	EventSubscriptionChanged = "subscription.changed"
+	EventPaymentSucceeded    = "payment.succeeded"
+	EventPaymentFailed       = "payment.failed"
+	EventCheckoutCompleted   = "checkout.completed"
+	EventIgnored             = "ignored"
+)
+
+// Proration behaviours of quantity changes, named after the Stripe ones.
+const (
+	ProrationCreate  = "create_prorations"
+	ProrationInvoice = "always_invoice"
+	ProrationNone    = "none"
+)
+
+// Checkout session statuses.
+const (
+	CheckoutOpen     = "open"
+	CheckoutComplete = "complete"
+	CheckoutExpired  = "expired"
+)
+
+var (
+	ErrNotSupported         = errors.New("not supported by the billing provider")
+	ErrNotFound             = errors.New("billing resource not found")
+	ErrInvalidSignature     = errors.New("invalid webhook signature")
+	ErrInvalidPromotionCode = errors.New("invalid promotion code")
+)
+
+// Provider is a payment provider. Implementations are the only code allowed to talk to a provider api or sdk.
+type Provider interface {
+	Name() string
+
+	CreateCustomer(ctx context.Context, customer Customer) (customerId string, err error)
+	UpdateCustomer(ctx context.Context, customerId string, customer Customer) error
+	DeleteCustomer(ctx context.Context, customerId string) error
+
+	CreateSubscription(ctx context.Context, params SubscriptionParams) (subscription Subscription, err error)
+	GetSubscription(ctx context.Context, subscriptionId string) (subscription Subscription, err error)
+	PreviewChange(ctx context.Context, params ChangeParams) (preview Preview, err error)
+	ChangeSubscription(ctx context.Context, params ChangeParams) (subscription Subscription, err error)
+	UpdateQuantity(ctx context.Context, params QuantityParams) (subscription Subscription, err error)
+	CancelSubscription(ctx context.Context, subscriptionId string, immediately bool) (subscription Subscription, err error)
+	ResumeSubscription(ctx context.Context, subscriptionId string) (subscription Subscription, err error)
+	ReportUsage(ctx context.Context, params UsageParams) error
+
+	CreateCheckoutSession(ctx context.Context, params CheckoutParams) (session CheckoutSession, err error)
+	GetCheckoutSession(ctx context.Context, sessionId string) (session CheckoutSession, err error)
+	CreatePortalSession(ctx context.Context, customerId string, returnUrl string) (url string, err error)
+
+	// VerifyWebhook authenticates a delivery, DecodeEvent reads an event that was verified before.
+	VerifyWebhook(ctx context.Context, payload []byte, header http.Header) (event Event, err error)
+	DecodeEvent(payload []byte) (event Event, err error)
+
+	Refund(ctx context.Context, params RefundParams) (refund Refund, err error)
+}
+
+type Customer struct {
+	UserId string
+	Name   string
+	Email  string
+}
+
+// Subscription is the provider state of a subscription, Status is one of the entities subscription statuses.
+type Subscription struct {
+	Id                 string
+	CustomerId         string
+	UserId             string
+	Status             string
+	Items              []SubscriptionItem
+	CancelAtPeriodEnd  bool
+	CurrentPeriodStart *time.Time
+	CurrentPeriodEnd   *time.Time
+	CanceledAt         *time.Time
+	TrialEnd           *time.Time
+	CreatedAt          time.Time
+	// ClientSecret confirms the first payment in the browser, empty when nothing is due.
+	ClientSecret string
+}
+
+type SubscriptionItem struct {
+	Id       string
+	PriceId  string
+	Quantity int64
+}
+
+type SubscriptionParams struct {
+	UserId         string
+	CustomerId     string
+	PriceId        string
+	MeteredPriceId string
+	IdempotencyKey string
+}
+
+// ChangeParams swaps the price of the plan item, ProrationDate pins the proration to a previewed one when not zero.
+type ChangeParams struct {
+	SubscriptionId string
+	CustomerId     string
+	ItemId         string
+	PriceId        string
+	ProrationDate  int64
+}
+
+// QuantityParams sets the quantity of the plan item, e.g. the paid seats, Proration is one of the proration behaviours.
+type QuantityParams struct {
+	SubscriptionId string
+	ItemId         string
+	Quantity       int64
+	Proration      string
+	IdempotencyKey string
+}
+
+type Preview struct {
+	AmountDue       int64
+	ProrationAmount int64
+	Currency        string
+	ProrationDate   int64
+}
+
+type UsageParams struct {
+	ItemId         string
+	Quantity       int64
+	Timestamp      time.Time
+	IdempotencyKey string
+}
+
+type CheckoutParams struct {
+	UserId         string
+	CustomerId     string
+	PriceId        string
+	MeteredPriceId string
+	TrialDays      int64
+	PromotionCode  string
+	SuccessUrl     string
+	CancelUrl      string
+	IdempotencyKey string
+}
+
+type CheckoutSession struct {
+	Id             string
+	Url            string
+	UserId         string
+	Status         string
+	PaymentStatus  string
+	SubscriptionId string
+}
+
+// Event is a verified webhook event, Type is the provider event type and Kind the provider agnostic one.
+// CreatedAt orders payment events that arrive out of order.
+type Event struct {
+	Id             string    `json:"id"`
+	Type           string    `json:"type"`
+	Kind           string    `json:"kind"`
+	SubscriptionId string    `json:"subscription_id"`
+	CustomerId     string    `json:"customer_id"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// RefundParams refunds a payment, the whole amount when Amount is zero. Amounts are in the smallest currency unit.
+type RefundParams struct {
+	PaymentId      string
+	Amount         int64
+	Currency       string
+	Reason         string
+	IdempotencyKey string
+}
+
+type Refund struct {
+	Id        string
+	PaymentId string
+	Amount    int64
+	Currency  string
+	Status    string
+}
@@ -0,0 +1,288 @@
+package billing
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"github.com/Lenstack/lensaas-app/internal/core/entities"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// FakeWebhookHeader carries the shared secret of the fake provider webhooks.
+const FakeWebhookHeader = "Fake-Webhook-Secret"
+
+// Fake is an in memory provider for tests and local development. Subscriptions are active as soon as they are created,
+// checkout sessions complete when they are fetched, and webhook events are Event values encoded as json.
+type Fake struct {
+	WebhookSecret string
+	// Usage and Refunds record what was reported and refunded.
+	Usage   []UsageParams
+	Refunds []Refund
+
+	mutex         sync.Mutex
+	sequence      int
+	customers     map[string]Customer
+	subscriptions map[string]Subscription
+	sessions      map[string]CheckoutSession
+}
+
+func NewFake(webhookSecret string) *Fake {
+	return &Fake{
+		WebhookSecret: webhookSecret,
+		customers:     map[string]Customer{},
+		subscriptions: map[string]Subscription{},
+		sessions:      map[string]CheckoutSession{},
+	}
+}
+
+func (f *Fake) Name() string {
+	return ProviderFake
+}
+
+func (f *Fake) CreateCustomer(ctx context.Context, customer Customer) (customerId string, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	customerId = f.id("cus")
+	f.customers[customerId] = customer
+	return customerId, nil
+}
+
+func (f *Fake) UpdateCustomer(ctx context.Context, customerId string, customer Customer) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if _, ok := f.customers[customerId]; !ok {
+		return ErrNotFound
+	}
+	f.customers[customerId] = customer
+	return nil
+}
+
+func (f *Fake) DeleteCustomer(ctx context.Context, customerId string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	delete(f.customers, customerId)
+	now := time.Now()
+	for id, subscription := range f.subscriptions {
+		if subscription.CustomerId == customerId && subscription.Status != entities.SubscriptionCanceled {
+			subscription.Status = entities.SubscriptionCanceled
+			subscription.CanceledAt = &now
+			f.subscriptions[id] = subscription
+		}
+	}
+	return nil
+}
+
+func (f *Fake) CreateSubscription(ctx context.Context, params SubscriptionParams) (subscription Subscription, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.subscribe(params.UserId, params.CustomerId, params.PriceId, params.MeteredPriceId, 0), nil
+}
+
+func (f *Fake) GetSubscription(ctx context.Context, subscriptionId string) (subscription Subscription, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	subscription, ok := f.subscriptions[subscriptionId]
+	if !ok {
+		return Subscription{}, ErrNotFound
+	}
+	return subscription, nil
+}
+
+func (f *Fake) PreviewChange(ctx context.Context, params ChangeParams) (preview Preview, err error) {
+	if _, err := f.GetSubscription(ctx, params.SubscriptionId); err != nil {
+		return Preview{}, err
+	}
+	prorationDate := params.ProrationDate
+	if prorationDate == 0 {
+		prorationDate = time.Now().Unix()
+	}
+	return Preview{Currency: "usd", ProrationDate: prorationDate}, nil
+}
+
+func (f *Fake) ChangeSubscription(ctx context.Context, params ChangeParams) (subscription Subscription, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	subscription, ok := f.subscriptions[params.SubscriptionId]
+	if !ok {
+		return Subscription{}, ErrNotFound
+	}
+	for i := range subscription.Items {
+		if subscription.Items[i].Id == params.ItemId {
+			subscription.Items[i].PriceId = params.PriceId
+		}
+	}
+	f.subscriptions[subscription.Id] = subscription
+	return subscription, nil
+}
+
+func (f *Fake) UpdateQuantity(ctx context.Context, params QuantityParams) (subscription Subscription, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	subscription, ok := f.subscriptions[params.SubscriptionId]
+	if !ok {
+		return Subscription{}, ErrNotFound
+	}
+	for i := range subscription.Items {
+		if subscription.Items[i].Id == params.ItemId {
+			subscription.Items[i].Quantity = params.Quantity
+		}
+	}
+	f.subscriptions[subscription.Id] = subscription
+	return subscription, nil
+}
+
+func (f *Fake) CancelSubscription(ctx context.Context, subscriptionId string, immediately bool) (subscription Subscription, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	subscription, ok := f.subscriptions[subscriptionId]
+	if !ok {
+		return Subscription{}, ErrNotFound
+	}
+	if immediately {
+		now := time.Now()
+		subscription.Status = entities.SubscriptionCanceled
+		subscription.CanceledAt = &now
+	} else {
+		subscription.CancelAtPeriodEnd = true
+	}
+	f.subscriptions[subscriptionId] = subscription
+	return subscription, nil
+}
+
+func (f *Fake) ResumeSubscription(ctx context.Context, subscriptionId string) (subscription Subscription, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	subscription, ok := f.subscriptions[subscriptionId]
+	if !ok {
+		return Subscription{}, ErrNotFound
+	}
+	subscription.CancelAtPeriodEnd = false
+	f.subscriptions[subscriptionId] = subscription
+	return subscription, nil
+}
+
+func (f *Fake) ReportUsage(ctx context.Context, params UsageParams) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.Usage = append(f.Usage, params)
+	return nil
+}
+
+func (f *Fake) CreateCheckoutSession(ctx context.Context, params CheckoutParams) (session CheckoutSession, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if params.PromotionCode != "" {
+		return CheckoutSession{}, ErrInvalidPromotionCode
+	}
+	subscription := f.subscribe(params.UserId, params.CustomerId, params.PriceId, params.MeteredPriceId, params.TrialDays)
+	session = CheckoutSession{
+		Id:             f.id("cs"),
+		UserId:         params.UserId,
+		Status:         CheckoutOpen,
+		PaymentStatus:  "unpaid",
+		SubscriptionId: subscription.Id,
+	}
+	session.Url = params.SuccessUrl + "?session_id=" + session.Id
+	f.sessions[session.Id] = session
+	return session, nil
+}
+
+func (f *Fake) GetCheckoutSession(ctx context.Context, sessionId string) (session CheckoutSession, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	session, ok := f.sessions[sessionId]
+	if !ok {
+		return CheckoutSession{}, ErrNotFound
+	}
+	session.Status = CheckoutComplete
+	session.PaymentStatus = "paid"
+	f.sessions[sessionId] = session
+	return session, nil
+}
+
+func (f *Fake) CreatePortalSession(ctx context.Context, customerId string, returnUrl string) (url string, err error) {
+	return returnUrl, nil
+}
+
+func (f *Fake) VerifyWebhook(ctx context.Context, payload []byte, header http.Header) (event Event, err error) {
+	if f.WebhookSecret == "" || subtle.ConstantTimeCompare([]byte(header.Get(FakeWebhookHeader)), []byte(f.WebhookSecret)) != 1 {
+		return Event{}, ErrInvalidSignature
+	}
+	return f.DecodeEvent(payload)
+}
+
+func (f *Fake) DecodeEvent(payload []byte) (event Event, err error) {
+	err = json.Unmarshal(payload, &event)
+	if err != nil {
+		return Event{}, err
+	}
+	if event.Kind == "" {
+		event.Kind = EventIgnored
+	}
+	return event, nil
+}
+
+func (f *Fake) Refund(ctx context.Context, params RefundParams) (refund Refund, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	refund = Refund{Id: f.id("re"), PaymentId: params.PaymentId, Amount: params.Amount, Currency: params.Currency, Status: "succeeded"}
+	f.Refunds = append(f.Refunds, refund)
+	return refund, nil
+}
+
+// SetStatus changes the status of a subscription, as a provider side event would.
+func (f *Fake) SetStatus(subscriptionId string, status string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if subscription, ok := f.subscriptions[subscriptionId]; ok {
+		subscription.Status = status
+		f.subscriptions[subscriptionId] = subscription
+	}
+}
+
+func (f *Fake) subscribe(userId string, customerId string, priceId string, meteredPriceId string, trialDays int64) Subscription {
+	now := time.Now()
+	periodEnd := now.AddDate(0, 1, 0)
+	subscription := Subscription{
+		Id:                 f.id("sub"),
+		CustomerId:         customerId,
+		UserId:             userId,
+		Status:             entities.SubscriptionActive,
+		Items:              []SubscriptionItem{{Id: f.id("si"), PriceId: priceId, Quantity: 1}},
+		CurrentPeriodStart: &now,
+		CurrentPeriodEnd:   &periodEnd,
+		CreatedAt:          now,
+	}
+	if meteredPriceId != "" {
+		subscription.Items = append(subscription.Items, SubscriptionItem{Id: f.id("si"), PriceId: meteredPriceId})
+	}
+	if trialDays > 0 {
+		trialEnd := now.AddDate(0, 0, int(trialDays))
+		subscription.Status = entities.SubscriptionTrialing
+		subscription.TrialEnd = &trialEnd
+	}
+	f.subscriptions[subscription.Id] = subscription
+	return subscription
+}
+
+func (f *Fake) id(prefix string) string {
+	f.sequence++
+	return fmt.Sprintf("%s_fake_%d", prefix, f.sequence)
+}
@@ -0,0 +1,16 @@
+package entities
+
+import "time"
+
+const AccountInvitationTableName = "account_invitations"
+
+// AccountInvitation offers a user a seat of the account of another user, the user takes it by accepting it before
+// ExpiresAt. OwnerEmail and OwnerName are read from the account owner.
+type AccountInvitation struct {
+	AccountId  string
+	UserId     string
+	OwnerEmail string
+	OwnerName  string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+}
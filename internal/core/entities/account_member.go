@@ -0,0 +1,15 @@
+package entities
+
+import "time"
+
+const AccountMemberTableName = "account_members"
+
+// AccountMember is a user taking a seat of the account of another user, the account owner takes the first seat.
+// A user is a member of one account at most. Email and Name are read from the member user.
+type AccountMember struct {
+	AccountId string
+	UserId    string
+	Email     string
+	Name      string
+	CreatedAt time.Time
+}
@@ -0,0 +1,18 @@
+package entities
+
+import "time"
+
+const ApiKeyTableName = "api_keys"
+
+type ApiKey struct {
+	Id         string
+	UserId     string
+	Name       string
+	Prefix     string
+	Hash       string
+	Scopes     []string
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+}
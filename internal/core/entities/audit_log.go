@@ -0,0 +1,20 @@
+package entities
+
+import "time"
+
+const AuditLogTableName = "audit_logs"
+
+type AuditLog struct {
+	Id        string
+	Seq       int64
+	ActorId   string
+	TargetId  string
+	Action    string
+	Ip        string
+	UserAgent string
+	RequestId string
+	Metadata  string
+	PrevHash  string
+	Hash      string
+	CreatedAt time.Time
+}
@@ -0,0 +1,32 @@
+package entities
+
+import "time"
+
+const DunningTableName = "dunning"
+
+// Dunning statuses, restricted accounts are read-only until the payment is settled.
+const (
+	DunningGrace      = "grace"
+	DunningRestricted = "restricted"
+	DunningResolved   = "resolved"
+)
+
+// Dunning is the failed payment case of a user, only the latest one is kept.
+type Dunning struct {
+	UserId         string
+	Provider       string
+	SubscriptionId string
+	Status         string
+	FailedAt       time.Time
+	GraceEndsAt    time.Time
+	RemindersSent  int
+	LastReminderAt *time.Time
+	RestrictedAt   *time.Time
+	ResolvedAt     *time.Time
+	UpdatedAt      time.Time
+}
+
+// Open reports whether the payment is still due.
+func (d Dunning) Open() bool {
+	return d.Status == DunningGrace || d.Status == DunningRestricted
+}
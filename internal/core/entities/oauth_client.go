@@ -0,0 +1,15 @@
+package entities
+
+import "time"
+
+const OAuthClientTableName = "oauth_clients"
+
+type OAuthClient struct {
+	Id         string
+	Name       string
+	SecretHash string
+	Scopes     []string
+	CreatedBy  string
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+}
@@ -0,0 +1,47 @@
+package entities
+
+import "time"
+
+const SubscriptionTableName = "subscriptions"
+
+// Subscription statuses, billing providers map theirs to these.
+const (
+	SubscriptionIncomplete        = "incomplete"
+	SubscriptionIncompleteExpired = "incomplete_expired"
+	SubscriptionTrialing          = "trialing"
+	SubscriptionActive            = "active"
+	SubscriptionPastDue           = "past_due"
+	SubscriptionCanceled          = "canceled"
+	SubscriptionUnpaid            = "unpaid"
+)
+
+// Subscription mirrors the provider subscription of a user, Id is the provider subscription id.
+type Subscription struct {
+	Id         string
+	Provider   string
+	UserId     string
+	CustomerId string
+	ItemId     string
+	PriceId    string
+	// Quantity is the number of paid seats on the plan item.
+	Quantity int64
+	// MeteredItemId is the item usage is reported to, empty when the subscription has no metered price.
+	MeteredItemId      string
+	Status             string
+	CancelAtPeriodEnd  bool
+	CurrentPeriodStart *time.Time
+	CurrentPeriodEnd   *time.Time
+	CanceledAt         *time.Time
+	TrialEnd           *time.Time
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+}
+
+// Live reports whether the subscription still bills the user, incomplete subscriptions wait for the first payment.
+func (s Subscription) Live() bool {
+	switch s.Status {
+	case SubscriptionIncomplete, SubscriptionTrialing, SubscriptionActive, SubscriptionPastDue, SubscriptionUnpaid:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,23 @@
+package entities
+
+import "time"
+
+const TrialTableName = "trials"
+
+// Trial grants the entitlements of Plan without a payment method until EndsAt, a user gets one trial at most.
+// It ends when a paid subscription converts it or when it expires.
+type Trial struct {
+	UserId         string
+	Plan           string
+	StartedAt      time.Time
+	EndsAt         time.Time
+	RemindersSent  int
+	LastReminderAt *time.Time
+	ConvertedAt    *time.Time
+	ExpiredAt      *time.Time
+}
+
+// Running reports whether the trial still grants its plan.
+func (t Trial) Running(now time.Time) bool {
+	return t.ConvertedAt == nil && t.ExpiredAt == nil && now.Before(t.EndsAt)
+}
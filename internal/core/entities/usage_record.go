@@ -0,0 +1,23 @@
+package entities
+
+import "time"
+
+const (
+	UsageRecordTableName = "usage_records"
+	// UsageFlushTableName marks the counters of the flushing keys already added to usage_records.
+	UsageFlushTableName = "usage_flushes"
+)
+
+// UsageRecord is the usage of a metric by a user over one billing period, ReportedQuantity is the part already sent to the billing provider.
+type UsageRecord struct {
+	Id               string
+	UserId           string
+	Metric           string
+	PeriodStart      time.Time
+	PeriodEnd        time.Time
+	Quantity         int64
+	ReportedQuantity int64
+	ReportedAt       *time.Time
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
@@ -4,15 +4,27 @@ import "time"
 
 const UserTableName = "users"
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type User struct {
 	Id            string
 	Name          string
 	Email         string
 	Password      string
 	Verified      bool
+	Role          string
 	Code          string
 	SendExpiresAt time.Time
 	Token         string
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
+	DeactivatedAt *time.Time
+	// PurgedAt is set once the deactivated account was anonymised, it can not be restored anymore.
+	PurgedAt *time.Time
+	// BillingProvider and BillingCustomerId are empty until the customer is created, after the email is verified.
+	BillingProvider   string
+	BillingCustomerId string
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
 }
@@ -0,0 +1,27 @@
+package entities
+
+import "time"
+
+const WebhookEventTableName = "webhook_events"
+
+// Webhook event statuses, failed events ran out of attempts and wait for a manual replay.
+const (
+	WebhookEventPending    = "pending"
+	WebhookEventProcessing = "processing"
+	WebhookEventProcessed  = "processed"
+	WebhookEventFailed     = "failed"
+)
+
+// WebhookEvent is a billing provider event as received, Id is the provider event id and deduplicates deliveries.
+type WebhookEvent struct {
+	Id            string
+	Provider      string
+	Type          string
+	Payload       string
+	Status        string
+	Attempts      int
+	LastError     *string
+	NextAttemptAt time.Time
+	ProcessedAt   *time.Time
+	CreatedAt     time.Time
+}
@@ -0,0 +1,125 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type DeleteAccountRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
+type DeleteAccountResponse struct {
+	Message string `json:"message"`
+}
+
+type RestoreAccountResponse struct {
+	Message string `json:"message"`
+}
+
+type AccountExport struct {
+	ExportedAt     time.Time                    `json:"exported_at"`
+	Profile        AccountExportProfile         `json:"profile"`
+	Sessions       []AccountExportSession       `json:"sessions"`
+	AuditLogs      []AccountExportAuditLog      `json:"audit_logs"`
+	ApiKeys        []AccountExportApiKey        `json:"api_keys"`
+	Billing        AccountExportBilling         `json:"billing"`
+	UsageRecords   []AccountExportUsageRecord   `json:"usage_records"`
+	AccountMembers []AccountExportAccountMember `json:"account_members"`
+	Trial          *AccountExportTrial          `json:"trial"`
+}
+
+type AccountExportProfile struct {
+	Id            string     `json:"id"`
+	Name          string     `json:"name"`
+	Email         string     `json:"email"`
+	Verified      bool       `json:"verified"`
+	Role          string     `json:"role"`
+	DeactivatedAt *time.Time `json:"deactivated_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+type AccountExportSession struct {
+	Type      string    `json:"type"`
+	Blocked   bool      `json:"blocked"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type AccountExportApiKey struct {
+	Id         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type AccountExportBilling struct {
+	Provider      string                      `json:"provider"`
+	CustomerId    string                      `json:"customer_id"`
+	Subscriptions []AccountExportSubscription `json:"subscriptions"`
+	Dunning       *AccountExportDunning       `json:"dunning"`
+}
+
+type AccountExportSubscription struct {
+	Id                 string     `json:"id"`
+	Provider           string     `json:"provider"`
+	PriceId            string     `json:"price_id"`
+	Quantity           int64      `json:"quantity"`
+	Status             string     `json:"status"`
+	CancelAtPeriodEnd  bool       `json:"cancel_at_period_end"`
+	CurrentPeriodStart *time.Time `json:"current_period_start"`
+	CurrentPeriodEnd   *time.Time `json:"current_period_end"`
+	CanceledAt         *time.Time `json:"canceled_at"`
+	TrialEnd           *time.Time `json:"trial_end"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+type AccountExportDunning struct {
+	SubscriptionId string     `json:"subscription_id"`
+	Status         string     `json:"status"`
+	FailedAt       time.Time  `json:"failed_at"`
+	GraceEndsAt    time.Time  `json:"grace_ends_at"`
+	RemindersSent  int        `json:"reminders_sent"`
+	RestrictedAt   *time.Time `json:"restricted_at"`
+	ResolvedAt     *time.Time `json:"resolved_at"`
+}
+
+type AccountExportUsageRecord struct {
+	Metric           string     `json:"metric"`
+	PeriodStart      time.Time  `json:"period_start"`
+	PeriodEnd        time.Time  `json:"period_end"`
+	Quantity         int64      `json:"quantity"`
+	ReportedQuantity int64      `json:"reported_quantity"`
+	ReportedAt       *time.Time `json:"reported_at"`
+}
+
+// AccountExportAccountMember is a seat of the account of AccountId, the user is either its owner or the member.
+type AccountExportAccountMember struct {
+	AccountId string    `json:"account_id"`
+	UserId    string    `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type AccountExportTrial struct {
+	Plan          string     `json:"plan"`
+	StartedAt     time.Time  `json:"started_at"`
+	EndsAt        time.Time  `json:"ends_at"`
+	RemindersSent int        `json:"reminders_sent"`
+	ConvertedAt   *time.Time `json:"converted_at"`
+	ExpiredAt     *time.Time `json:"expired_at"`
+}
+
+type AccountExportAuditLog struct {
+	Action    string          `json:"action"`
+	ActorId   string          `json:"actor_id"`
+	TargetId  string          `json:"target_id"`
+	Ip        string          `json:"ip"`
+	UserAgent string          `json:"user_agent"`
+	Metadata  json.RawMessage `json:"metadata"`
+	CreatedAt time.Time       `json:"created_at"`
+}
@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+type InviteMemberRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type Member struct {
+	UserId  string    `json:"user_id"`
+	Email   string    `json:"email"`
+	Name    string    `json:"name"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// Seats are taken by the owner and the members, Limit is -1 when the plan does not cap them.
+type Seats struct {
+	Used  int64 `json:"used"`
+	Paid  int64 `json:"paid"`
+	Limit int64 `json:"limit"`
+}
+
+type GetMembersResponse struct {
+	Members []Member `json:"members"`
+	Seats   Seats    `json:"seats"`
+}
+
+type InviteMemberResponse struct {
+	Message string `json:"message"`
+}
+
+type Invitation struct {
+	AccountId  string    `json:"account_id"`
+	OwnerEmail string    `json:"owner_email"`
+	OwnerName  string    `json:"owner_name"`
+	InvitedAt  time.Time `json:"invited_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+type GetInvitationsResponse struct {
+	Invitations []Invitation `json:"invitations"`
+}
+
+type AcceptInvitationResponse struct {
+	Member Member `json:"member"`
+}
+
+type DeclineInvitationResponse struct {
+	Message string `json:"message"`
+}
+
+type LeaveAccountResponse struct {
+	Message string `json:"message"`
+}
+
+type RemoveMemberResponse struct {
+	Message string `json:"message"`
+}
+
+type SeatsResponse struct {
+	Seats Seats `json:"seats"`
+}
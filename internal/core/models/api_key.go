@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+type CreateApiKeyRequest struct {
+	Name      string     `json:"name" validate:"required,max=64"`
+	Scopes    []string   `json:"scopes" validate:"omitempty,dive,required"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type CreateApiKeyResponse struct {
+	Key    string `json:"key"`
+	ApiKey ApiKey `json:"api_key"`
+}
+
+type ApiKey struct {
+	Id         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type GetApiKeysResponse struct {
+	ApiKeys []ApiKey `json:"api_keys"`
+}
+
+type RevokeApiKeyResponse struct {
+	Message string `json:"message"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type AuditLog struct {
+	Id        string          `json:"id"`
+	Seq       int64           `json:"seq"`
+	ActorId   string          `json:"actor_id"`
+	TargetId  string          `json:"target_id"`
+	Action    string          `json:"action"`
+	Ip        string          `json:"ip"`
+	UserAgent string          `json:"user_agent"`
+	RequestId string          `json:"request_id"`
+	Metadata  json.RawMessage `json:"metadata"`
+	PrevHash  string          `json:"prev_hash"`
+	Hash      string          `json:"hash"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type GetAuditLogsResponse struct {
+	AuditLogs  []AuditLog `json:"audit_logs"`
+	NextCursor string     `json:"next_cursor"`
+}
+
+type VerifyAuditLogsResponse struct {
+	Valid    bool   `json:"valid"`
+	Checked  int    `json:"checked"`
+	BrokenAt string `json:"broken_at,omitempty"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// BillingStatusResponse is the billing state of the account, the payment fields are set while a failed payment is due.
+type BillingStatusResponse struct {
+	Status             string     `json:"status"`
+	Plan               string     `json:"plan"`
+	SubscriptionStatus string     `json:"subscription_status,omitempty"`
+	ReadOnly           bool       `json:"read_only"`
+	PaymentFailedAt    *time.Time `json:"payment_failed_at,omitempty"`
+	GraceEndsAt        *time.Time `json:"grace_ends_at,omitempty"`
+	RestrictedAt       *time.Time `json:"restricted_at,omitempty"`
+	RemindersSent      int        `json:"reminders_sent"`
+}
@@ -0,0 +1,14 @@
+package models
+
+type ChangeEmailRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
+
+type ChangeEmailResponse struct {
+	Message string `json:"message"`
+}
+
+type ConfirmEmailChangeResponse struct {
+	Message string `json:"message"`
+}
@@ -0,0 +1,26 @@
+package models
+
+type CreateCheckoutSessionRequest struct {
+	PriceId string `json:"price_id" validate:"required"`
+	// PromotionCode is applied to the session, without one the user can enter a code on the checkout page.
+	PromotionCode string `json:"promotion_code" validate:"omitempty,max=64"`
+}
+
+type CheckoutSessionResponse struct {
+	SessionId string `json:"session_id"`
+	Url       string `json:"url"`
+}
+
+type PortalSessionResponse struct {
+	Url string `json:"url"`
+}
+
+type ReconcileCheckoutRequest struct {
+	SessionId string `json:"session_id" validate:"required"`
+}
+
+type ReconcileCheckoutResponse struct {
+	Status        string        `json:"status"`
+	PaymentStatus string        `json:"payment_status"`
+	Subscription  *Subscription `json:"subscription"`
+}
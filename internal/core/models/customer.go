@@ -0,0 +1,11 @@
+package models
+
+// CreateCustomerRequest picks the billing provider of the account, the default one when empty.
+type CreateCustomerRequest struct {
+	Provider string `json:"provider" validate:"omitempty,oneof=stripe paypal fake"`
+}
+
+type CreateCustomerResponse struct {
+	Provider   string `json:"provider"`
+	CustomerId string `json:"customer_id"`
+}
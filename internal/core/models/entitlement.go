@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+type Plan struct {
+	Name     string           `json:"name"`
+	PriceIds []string         `json:"price_ids"`
+	Features []string         `json:"features"`
+	Limits   map[string]int64 `json:"limits"`
+}
+
+type GetPlansResponse struct {
+	Plans []Plan `json:"plans"`
+}
+
+type EntitlementsResponse struct {
+	Plan     string           `json:"plan"`
+	Features []string         `json:"features"`
+	Limits   map[string]int64 `json:"limits"`
+	ReadOnly bool             `json:"read_only"`
+	// TrialEndsAt is set while the plan is granted by a trial.
+	TrialEndsAt *time.Time `json:"trial_ends_at,omitempty"`
+}
+
+// UpgradeRequired is the body of 402 answers, UpgradePlan is the cheapest plan granting the feature or a higher limit.
+type UpgradeRequired struct {
+	Code        int    `json:"code"`
+	Message     string `json:"message"`
+	Plan        string `json:"plan"`
+	Feature     string `json:"feature,omitempty"`
+	Limit       string `json:"limit,omitempty"`
+	UpgradePlan string `json:"upgrade_plan,omitempty"`
+	UpgradeUrl  string `json:"upgrade_url"`
+	ReadOnly    bool   `json:"read_only,omitempty"`
+}
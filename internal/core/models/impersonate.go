@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+type ImpersonateRequest struct {
+	Reason string `json:"reason" validate:"required,min=10,max=500"`
+}
+
+type ImpersonateResponse struct {
+	AccessToken  string    `json:"access_token"`
+	ExpiresIn    time.Time `json:"expires_in"`
+	UserId       string    `json:"user_id"`
+	ActorId      string    `json:"actor_id"`
+	Impersonated bool      `json:"impersonated"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+type OAuthTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+// OAuthError follows the error response of RFC 6749 section 5.2.
+type OAuthError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+type CreateOAuthClientRequest struct {
+	Name   string   `json:"name" validate:"required,max=64"`
+	Scopes []string `json:"scopes" validate:"omitempty,dive,required"`
+}
+
+type CreateOAuthClientResponse struct {
+	ClientSecret string      `json:"client_secret"`
+	Client       OAuthClient `json:"client"`
+}
+
+type OAuthClient struct {
+	Id        string     `json:"id"`
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	CreatedBy string     `json:"created_by"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type GetOAuthClientsResponse struct {
+	Clients []OAuthClient `json:"clients"`
+}
+
+type RevokeOAuthClientResponse struct {
+	Message string `json:"message"`
+}
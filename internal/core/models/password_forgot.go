@@ -0,0 +1,9 @@
+package models
+
+type PasswordForgotRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type PasswordForgotResponse struct {
+	Message string `json:"message"`
+}
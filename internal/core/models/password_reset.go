@@ -0,0 +1,10 @@
+package models
+
+type PasswordResetRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+type PasswordResetResponse struct {
+	Message string `json:"message"`
+}
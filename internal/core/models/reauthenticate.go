@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+type ReauthenticateRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
+type ReauthenticateResponse struct {
+	AccessToken string    `json:"access_token"`
+	ExpiresIn   time.Time `json:"expires_in"`
+}
+
+// AuthenticationChallenge is returned when an operation needs a more recent authentication than the token carries.
+type AuthenticationChallenge struct {
+	Code              int    `json:"code"`
+	Message           string `json:"message"`
+	Error             string `json:"error"`
+	MaxAge            int    `json:"max_age"`
+	ReauthenticateUrl string `json:"reauthenticate_url"`
+}
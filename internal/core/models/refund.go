@@ -0,0 +1,18 @@
+package models
+
+type RefundRequest struct {
+	Provider  string `json:"provider" validate:"omitempty,oneof=stripe paypal fake"`
+	PaymentId string `json:"payment_id" validate:"required"`
+	// Amount is in the smallest currency unit, zero refunds the whole payment.
+	Amount   int64  `json:"amount" validate:"gte=0"`
+	Currency string `json:"currency" validate:"omitempty,len=3"`
+	Reason   string `json:"reason" validate:"omitempty,max=255"`
+}
+
+type RefundResponse struct {
+	Id        string `json:"id"`
+	PaymentId string `json:"payment_id"`
+	Amount    int64  `json:"amount"`
+	Currency  string `json:"currency"`
+	Status    string `json:"status"`
+}
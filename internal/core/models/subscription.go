@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+type CreateSubscriptionRequest struct {
+	PriceId string `json:"price_id" validate:"required"`
+}
+
+type CreateSubscriptionResponse struct {
+	Subscription Subscription `json:"subscription"`
+	// ClientSecret confirms the first payment with Stripe.js, it is empty when nothing is due.
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+type PreviewSubscriptionRequest struct {
+	PriceId string `json:"price_id" validate:"required"`
+}
+
+type PreviewSubscriptionResponse struct {
+	AmountDue       int64  `json:"amount_due"`
+	ProrationAmount int64  `json:"proration_amount"`
+	Currency        string `json:"currency"`
+	ProrationDate   int64  `json:"proration_date"`
+}
+
+type ChangeSubscriptionRequest struct {
+	PriceId       string `json:"price_id" validate:"required"`
+	ProrationDate int64  `json:"proration_date" validate:"omitempty,gt=0"`
+}
+
+type CancelSubscriptionRequest struct {
+	Immediately bool `json:"immediately"`
+}
+
+type SubscriptionResponse struct {
+	Subscription Subscription `json:"subscription"`
+}
+
+type Subscription struct {
+	Id                 string     `json:"id"`
+	PriceId            string     `json:"price_id"`
+	Status             string     `json:"status"`
+	CancelAtPeriodEnd  bool       `json:"cancel_at_period_end"`
+	CurrentPeriodStart *time.Time `json:"current_period_start"`
+	CurrentPeriodEnd   *time.Time `json:"current_period_end"`
+	CanceledAt         *time.Time `json:"canceled_at"`
+	TrialEnd           *time.Time `json:"trial_end"`
+	CreatedAt          time.Time  `json:"created_at"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+type TrialResponse struct {
+	Trial Trial `json:"trial"`
+}
+
+type Trial struct {
+	Plan        string     `json:"plan"`
+	StartedAt   time.Time  `json:"started_at"`
+	EndsAt      time.Time  `json:"ends_at"`
+	Running     bool       `json:"running"`
+	ConvertedAt *time.Time `json:"converted_at"`
+	ExpiredAt   *time.Time `json:"expired_at"`
+}
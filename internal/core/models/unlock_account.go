@@ -0,0 +1,5 @@
+package models
+
+type UnlockAccountResponse struct {
+	Message string `json:"message"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+type Usage struct {
+	Metric      string    `json:"metric"`
+	Quantity    int64     `json:"quantity"`
+	Limit       int64     `json:"limit"`
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+}
+
+type GetUsageResponse struct {
+	Usage []Usage `json:"usage"`
+}
@@ -0,0 +1,6 @@
+package models
+
+type WebhookResponse struct {
+	EventId  string `json:"event_id"`
+	Received bool   `json:"received"`
+}
@@ -0,0 +1,85 @@
+package repositories
+
+import (
+	"context"
+	"github.com/Lenstack/lensaas-app/internal/core/entities"
+	"github.com/Masterminds/squirrel"
+	"time"
+)
+
+type IAccountInvitationRepository interface {
+	Create(ctx context.Context, invitation entities.AccountInvitation) (message string, err error)
+	Find(ctx context.Context, accountId string, userId string, now time.Time) (invitation entities.AccountInvitation, err error)
+	FindByUser(ctx context.Context, userId string, now time.Time) (invitations []entities.AccountInvitation, err error)
+	Delete(ctx context.Context, accountId string, userId string) (deleted bool, err error)
+}
+
+type AccountInvitationRepository struct {
+	Database squirrel.StatementBuilderType
+}
+
+var accountInvitationColumns = []string{"i.AccountId", "i.UserId", "u.Email", "u.Name", "i.CreatedAt", "i.ExpiresAt"}
+
+func scanAccountInvitation(row squirrel.RowScanner) (invitation entities.AccountInvitation, err error) {
+	err = row.Scan(&invitation.AccountId, &invitation.UserId, &invitation.OwnerEmail, &invitation.OwnerName,
+		&invitation.CreatedAt, &invitation.ExpiresAt)
+	if err != nil {
+		return entities.AccountInvitation{}, err
+	}
+	return invitation, nil
+}
+
+// Create TODO: 1. Insert the invitation, inviting the user again renews it, 2. Return success message
+func (ar *AccountInvitationRepository) Create(ctx context.Context, invitation entities.AccountInvitation) (message string, err error) {
+	_, err = ar.Database.Insert(entities.AccountInvitationTableName).
+		Columns("AccountId", "UserId", "CreatedAt", "ExpiresAt").
+		Values(invitation.AccountId, invitation.UserId, invitation.CreatedAt, invitation.ExpiresAt).
+		Suffix("ON CONFLICT (AccountId, UserId) DO UPDATE SET CreatedAt = EXCLUDED.CreatedAt, ExpiresAt = EXCLUDED.ExpiresAt").
+		ExecContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	return "invitation created successfully", nil
+}
+
+// Find TODO: 1. Find the invitation of the user to the account unless it expired, 2. Return invitation
+func (ar *AccountInvitationRepository) Find(ctx context.Context, accountId string, userId string, now time.Time) (invitation entities.AccountInvitation, err error) {
+	row := ar.Database.Select(accountInvitationColumns...).
+		From(entities.AccountInvitationTableName + " i").
+		Join(entities.UserTableName + " u ON u.Id = i.AccountId").
+		Where(squirrel.Eq{"i.AccountId": accountId, "i.UserId": userId}).
+		Where(squirrel.Gt{"i.ExpiresAt": now}).
+		QueryRowContext(ctx)
+	return scanAccountInvitation(row)
+}
+
+// FindByUser TODO: 1. Find the invitations of the user that did not expire with the account owners, newest first, 2. Return invitations
+func (ar *AccountInvitationRepository) FindByUser(ctx context.Context, userId string, now time.Time) (invitations []entities.AccountInvitation, err error) {
+	rows, err := ar.Database.Select(accountInvitationColumns...).
+		From(entities.AccountInvitationTableName + " i").
+		Join(entities.UserTableName + " u ON u.Id = i.AccountId").
+		Where(squirrel.Eq{"i.UserId": userId}).
+		Where(squirrel.Gt{"i.ExpiresAt": now}).
+		OrderBy("i.CreatedAt DESC").
+		QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		invitation, err := scanAccountInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, invitation)
+	}
+	return invitations, rows.Err()
+}
+
+// Delete TODO: 1. Remove the invitation of the user to the account, 2. Return whether there was one
+func (ar *AccountInvitationRepository) Delete(ctx context.Context, accountId string, userId string) (deleted bool, err error) {
+	return affected(ar.Database.Delete(entities.AccountInvitationTableName).
+		Where(squirrel.Eq{"AccountId": accountId, "UserId": userId}).
+		ExecContext(ctx))
+}
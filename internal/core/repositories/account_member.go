@@ -0,0 +1,118 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"github.com/Lenstack/lensaas-app/internal/core/entities"
+	"github.com/Masterminds/squirrel"
+)
+
+type IAccountMemberRepository interface {
+	Create(ctx context.Context, member entities.AccountMember, allow func(members int64) error) (created bool, members int64, err error)
+	FindByAccount(ctx context.Context, accountId string) (members []entities.AccountMember, err error)
+	FindByUser(ctx context.Context, userId string) (member entities.AccountMember, err error)
+	CountByAccount(ctx context.Context, accountId string) (count int64, err error)
+	Delete(ctx context.Context, accountId string, userId string) (deleted bool, err error)
+}
+
+type AccountMemberRepository struct {
+	Database squirrel.StatementBuilderType
+	// DB is needed for the transaction that serialises the members added to an account.
+	DB *sql.DB
+}
+
+// Create TODO: 1. Lock the account, 2. Count its members and check them with allow, 3. Insert the member, 4. Return whether it was created with the members, users already in an account are left as they are
+func (ar *AccountMemberRepository) Create(ctx context.Context, member entities.AccountMember, allow func(members int64) error) (created bool, members int64, err error) {
+	tx, err := ar.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", member.AccountId)
+	if err != nil {
+		return false, 0, err
+	}
+
+	database := ar.Database.RunWith(tx)
+	err = database.Select("COUNT(*)").
+		From(entities.AccountMemberTableName).
+		Where(squirrel.Eq{"AccountId": member.AccountId}).
+		QueryRowContext(ctx).
+		Scan(&members)
+	if err != nil {
+		return false, 0, err
+	}
+	err = allow(members)
+	if err != nil {
+		return false, members, err
+	}
+
+	created, err = affected(database.Insert(entities.AccountMemberTableName).
+		Columns("AccountId", "UserId", "CreatedAt").
+		Values(member.AccountId, member.UserId, member.CreatedAt).
+		Suffix("ON CONFLICT DO NOTHING").
+		ExecContext(ctx))
+	if err != nil || !created {
+		return false, members, err
+	}
+	return true, members + 1, tx.Commit()
+}
+
+// FindByAccount TODO: 1. Find the members of the account with their email and name, oldest first, 2. Return members
+func (ar *AccountMemberRepository) FindByAccount(ctx context.Context, accountId string) (members []entities.AccountMember, err error) {
+	rows, err := ar.Database.Select("m.AccountId", "m.UserId", "u.Email", "u.Name", "m.CreatedAt").
+		From(entities.AccountMemberTableName + " m").
+		Join(entities.UserTableName + " u ON u.Id = m.UserId").
+		Where(squirrel.Eq{"m.AccountId": accountId}).
+		OrderBy("m.CreatedAt ASC").
+		QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var member entities.AccountMember
+		err = rows.Scan(&member.AccountId, &member.UserId, &member.Email, &member.Name, &member.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+// FindByUser TODO: 1. Find the membership of the user in the account of another user, 2. Return member
+func (ar *AccountMemberRepository) FindByUser(ctx context.Context, userId string) (member entities.AccountMember, err error) {
+	err = ar.Database.Select("m.AccountId", "m.UserId", "u.Email", "u.Name", "m.CreatedAt").
+		From(entities.AccountMemberTableName+" m").
+		Join(entities.UserTableName+" u ON u.Id = m.UserId").
+		Where(squirrel.Eq{"m.UserId": userId}).
+		QueryRowContext(ctx).
+		Scan(&member.AccountId, &member.UserId, &member.Email, &member.Name, &member.CreatedAt)
+	if err != nil {
+		return entities.AccountMember{}, err
+	}
+	return member, nil
+}
+
+// CountByAccount TODO: 1. Count the members of the account, the owner excluded
+func (ar *AccountMemberRepository) CountByAccount(ctx context.Context, accountId string) (count int64, err error) {
+	err = ar.Database.Select("COUNT(*)").
+		From(entities.AccountMemberTableName).
+		Where(squirrel.Eq{"AccountId": accountId}).
+		QueryRowContext(ctx).
+		Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// Delete TODO: 1. Remove the member from the account, 2. Return whether it was a member
+func (ar *AccountMemberRepository) Delete(ctx context.Context, accountId string, userId string) (deleted bool, err error) {
+	return affected(ar.Database.Delete(entities.AccountMemberTableName).
+		Where(squirrel.Eq{"AccountId": accountId, "UserId": userId}).
+		ExecContext(ctx))
+}
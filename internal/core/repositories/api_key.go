@@ -0,0 +1,122 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"github.com/Lenstack/lensaas-app/internal/core/entities"
+	"github.com/Masterminds/squirrel"
+	"github.com/lib/pq"
+	"time"
+)
+
+type IApiKeyRepository interface {
+	Create(ctx context.Context, apiKey entities.ApiKey) (apiKeyId string, err error)
+	FindByPrefix(ctx context.Context, prefix string) (apiKey entities.ApiKey, err error)
+	FindByUser(ctx context.Context, userId string) (apiKeys []entities.ApiKey, err error)
+	Revoke(ctx context.Context, userId string, apiKeyId string) (message string, err error)
+	RevokeByUser(ctx context.Context, userId string) (message string, err error)
+	UpdateLastUsedAt(ctx context.Context, apiKeyId string, lastUsedAt time.Time) (message string, err error)
+}
+
+type ApiKeyRepository struct {
+	Database squirrel.StatementBuilderType
+}
+
+var apiKeyColumns = []string{"Id", "UserId", "Name", "Prefix", "Hash", "Scopes", "ExpiresAt", "LastUsedAt", "RevokedAt", "CreatedAt"}
+
+func scanApiKey(row squirrel.RowScanner) (apiKey entities.ApiKey, err error) {
+	err = row.Scan(&apiKey.Id, &apiKey.UserId, &apiKey.Name, &apiKey.Prefix, &apiKey.Hash, pq.Array(&apiKey.Scopes),
+		&apiKey.ExpiresAt, &apiKey.LastUsedAt, &apiKey.RevokedAt, &apiKey.CreatedAt)
+	if err != nil {
+		return entities.ApiKey{}, err
+	}
+	return apiKey, nil
+}
+
+// Create TODO: 1. Insert the api key, 2. Return api key id
+func (ar *ApiKeyRepository) Create(ctx context.Context, apiKey entities.ApiKey) (apiKeyId string, err error) {
+	qb := ar.Database.Insert(entities.ApiKeyTableName).
+		Columns("Id", "UserId", "Name", "Prefix", "Hash", "Scopes", "ExpiresAt", "CreatedAt").
+		Values(apiKey.Id, apiKey.UserId, apiKey.Name, apiKey.Prefix, apiKey.Hash, pq.Array(apiKey.Scopes),
+			apiKey.ExpiresAt, apiKey.CreatedAt).
+		Suffix("RETURNING Id")
+	err = qb.QueryRowContext(ctx).Scan(&apiKeyId)
+	if err != nil {
+		return "", err
+	}
+	return apiKeyId, nil
+}
+
+// FindByPrefix TODO: 1. Find api key by its lookup prefix, 2. Return api key
+func (ar *ApiKeyRepository) FindByPrefix(ctx context.Context, prefix string) (apiKey entities.ApiKey, err error) {
+	row := ar.Database.Select(apiKeyColumns...).
+		From(entities.ApiKeyTableName).
+		Where(squirrel.Eq{"Prefix": prefix}).
+		QueryRowContext(ctx)
+	return scanApiKey(row)
+}
+
+// FindByUser TODO: 1. Find the api keys of the user, newest first, 2. Return api keys
+func (ar *ApiKeyRepository) FindByUser(ctx context.Context, userId string) (apiKeys []entities.ApiKey, err error) {
+	rows, err := ar.Database.Select(apiKeyColumns...).
+		From(entities.ApiKeyTableName).
+		Where(squirrel.Eq{"UserId": userId}).
+		OrderBy("CreatedAt DESC").
+		QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		apiKey, err := scanApiKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		apiKeys = append(apiKeys, apiKey)
+	}
+	return apiKeys, rows.Err()
+}
+
+// Revoke TODO: 1. Mark the api key of the user as revoked, 2. Return success message
+func (ar *ApiKeyRepository) Revoke(ctx context.Context, userId string, apiKeyId string) (message string, err error) {
+	result, err := ar.Database.Update(entities.ApiKeyTableName).
+		Set("RevokedAt", time.Now()).
+		Where(squirrel.Eq{"Id": apiKeyId, "UserId": userId, "RevokedAt": nil}).
+		ExecContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+	if affected == 0 {
+		return "", errors.New("api key not found")
+	}
+	return "api key revoked successfully", nil
+}
+
+// RevokeByUser TODO: 1. Mark every active api key of the user as revoked, 2. Return success message
+func (ar *ApiKeyRepository) RevokeByUser(ctx context.Context, userId string) (message string, err error) {
+	_, err = ar.Database.Update(entities.ApiKeyTableName).
+		Set("RevokedAt", time.Now()).
+		Where(squirrel.Eq{"UserId": userId, "RevokedAt": nil}).
+		ExecContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	return "api keys revoked successfully", nil
+}
+
+// UpdateLastUsedAt TODO: 1. Update the last use of the api key, 2. Return success message
+func (ar *ApiKeyRepository) UpdateLastUsedAt(ctx context.Context, apiKeyId string, lastUsedAt time.Time) (message string, err error) {
+	_, err = ar.Database.Update(entities.ApiKeyTableName).
+		Set("LastUsedAt", lastUsedAt).
+		Where(squirrel.Eq{"Id": apiKeyId}).
+		ExecContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	return "api key last use updated successfully", nil
+}
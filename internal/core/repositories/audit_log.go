@@ -0,0 +1,172 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/Lenstack/lensaas-app/internal/core/entities"
+	"github.com/Masterminds/squirrel"
+	"time"
+)
+
+type IAuditLogRepository interface {
+	Append(ctx context.Context, auditLog entities.AuditLog, chain func(prevHash string) string) (auditLogId string, err error)
+	FindByUser(ctx context.Context, userId string) (auditLogs []entities.AuditLog, err error)
+	Find(ctx context.Context, filter AuditLogFilter) (auditLogs []entities.AuditLog, err error)
+	FindAfter(ctx context.Context, afterSeq int64, createdBefore time.Time, limit uint64) (auditLogs []entities.AuditLog, err error)
+	DeleteUpTo(ctx context.Context, seq int64) (message string, err error)
+}
+
+type AuditLogRepository struct {
+	Database squirrel.StatementBuilderType
+	// DB is needed for the transaction that serialises writes to the hash chain.
+	DB *sql.DB
+}
+
+// AuditLogFilter narrows Find, zero values are ignored. BeforeSeq is the pagination cursor.
+type AuditLogFilter struct {
+	ActorId   string
+	TargetId  string
+	Action    string
+	From      time.Time
+	To        time.Time
+	BeforeSeq int64
+	Limit     uint64
+}
+
+// auditLogChainLock is the advisory lock key held while appending to the chain.
+const auditLogChainLock = 7428001
+
+var auditLogColumns = []string{"Id", "Seq", "ActorId", "TargetId", "Action", "Ip", "UserAgent", "RequestId", "Metadata", "PrevHash", "Hash", "CreatedAt"}
+
+func scanAuditLog(row squirrel.RowScanner) (auditLog entities.AuditLog, err error) {
+	err = row.Scan(&auditLog.Id, &auditLog.Seq, &auditLog.ActorId, &auditLog.TargetId, &auditLog.Action, &auditLog.Ip,
+		&auditLog.UserAgent, &auditLog.RequestId, &auditLog.Metadata, &auditLog.PrevHash, &auditLog.Hash, &auditLog.CreatedAt)
+	if err != nil {
+		return entities.AuditLog{}, err
+	}
+	return auditLog, nil
+}
+
+func scanAuditLogs(rows *sql.Rows) (auditLogs []entities.AuditLog, err error) {
+	defer rows.Close()
+	for rows.Next() {
+		auditLog, err := scanAuditLog(rows)
+		if err != nil {
+			return nil, err
+		}
+		auditLogs = append(auditLogs, auditLog)
+	}
+	return auditLogs, rows.Err()
+}
+
+// Append TODO: 1. Lock the chain, 2. Read the hash of the last entry, 3. Insert the entry with the hash computed by chain, 4. Return audit log id
+func (ar *AuditLogRepository) Append(ctx context.Context, auditLog entities.AuditLog, chain func(prevHash string) string) (auditLogId string, err error) {
+	tx, err := ar.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", auditLogChainLock)
+	if err != nil {
+		return "", err
+	}
+
+	database := ar.Database.RunWith(tx)
+	err = database.Select("Hash").
+		From(entities.AuditLogTableName).
+		OrderBy("Seq DESC").
+		Limit(1).
+		QueryRowContext(ctx).Scan(&auditLog.PrevHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+	auditLog.Hash = chain(auditLog.PrevHash)
+
+	err = database.Insert(entities.AuditLogTableName).
+		Columns("Id", "ActorId", "TargetId", "Action", "Ip", "UserAgent", "RequestId", "Metadata", "PrevHash", "Hash", "CreatedAt").
+		Values(auditLog.Id, auditLog.ActorId, auditLog.TargetId, auditLog.Action, auditLog.Ip, auditLog.UserAgent,
+			auditLog.RequestId, auditLog.Metadata, auditLog.PrevHash, auditLog.Hash, auditLog.CreatedAt).
+		Suffix("RETURNING Id").
+		QueryRowContext(ctx).Scan(&auditLogId)
+	if err != nil {
+		return "", err
+	}
+
+	return auditLogId, tx.Commit()
+}
+
+// FindByUser TODO: 1. Find audit logs where the user is the actor or the target, 2. Return audit logs
+func (ar *AuditLogRepository) FindByUser(ctx context.Context, userId string) (auditLogs []entities.AuditLog, err error) {
+	rows, err := ar.Database.Select(auditLogColumns...).
+		From(entities.AuditLogTableName).
+		Where(squirrel.Or{squirrel.Eq{"ActorId": userId}, squirrel.Eq{"TargetId": userId}}).
+		OrderBy("Seq").
+		QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return scanAuditLogs(rows)
+}
+
+// Find TODO: 1. Apply the filters, 2. Return one page of audit logs, newest first
+func (ar *AuditLogRepository) Find(ctx context.Context, filter AuditLogFilter) (auditLogs []entities.AuditLog, err error) {
+	qb := ar.Database.Select(auditLogColumns...).
+		From(entities.AuditLogTableName).
+		OrderBy("Seq DESC").
+		Limit(filter.Limit)
+	if filter.ActorId != "" {
+		qb = qb.Where(squirrel.Eq{"ActorId": filter.ActorId})
+	}
+	if filter.TargetId != "" {
+		qb = qb.Where(squirrel.Eq{"TargetId": filter.TargetId})
+	}
+	if filter.Action != "" {
+		qb = qb.Where(squirrel.Eq{"Action": filter.Action})
+	}
+	if !filter.From.IsZero() {
+		qb = qb.Where(squirrel.GtOrEq{"CreatedAt": filter.From})
+	}
+	if !filter.To.IsZero() {
+		qb = qb.Where(squirrel.Lt{"CreatedAt": filter.To})
+	}
+	if filter.BeforeSeq > 0 {
+		qb = qb.Where(squirrel.Lt{"Seq": filter.BeforeSeq})
+	}
+
+	rows, err := qb.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return scanAuditLogs(rows)
+}
+
+// FindAfter TODO: 1. Find the entries following afterSeq in chain order, optionally only those created before a date, 2. Return audit logs
+func (ar *AuditLogRepository) FindAfter(ctx context.Context, afterSeq int64, createdBefore time.Time, limit uint64) (auditLogs []entities.AuditLog, err error) {
+	qb := ar.Database.Select(auditLogColumns...).
+		From(entities.AuditLogTableName).
+		Where(squirrel.Gt{"Seq": afterSeq}).
+		OrderBy("Seq").
+		Limit(limit)
+	if !createdBefore.IsZero() {
+		qb = qb.Where(squirrel.Lt{"CreatedAt": createdBefore})
+	}
+
+	rows, err := qb.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return scanAuditLogs(rows)
+}
+
+// DeleteUpTo TODO: 1. Delete every entry up to seq once it has been exported, 2. Return success message
+func (ar *AuditLogRepository) DeleteUpTo(ctx context.Context, seq int64) (message string, err error) {
+	_, err = ar.Database.Delete(entities.AuditLogTableName).
+		Where(squirrel.LtOrEq{"Seq": seq}).
+		ExecContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	return "audit logs deleted successfully", nil
+}
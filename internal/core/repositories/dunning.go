@@ -0,0 +1,138 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/Lenstack/lensaas-app/internal/core/entities"
+	"github.com/Masterminds/squirrel"
+	"time"
+)
+
+type IDunningRepository interface {
+	Open(ctx context.Context, dunning entities.Dunning) (opened bool, err error)
+	FindByUser(ctx context.Context, userId string) (dunning entities.Dunning, err error)
+	FindInGrace(ctx context.Context, limit uint64) (dunnings []entities.Dunning, err error)
+	UpdateRemindersSent(ctx context.Context, userId string, previous int, remindersSent int, remindedAt *time.Time) (updated bool, err error)
+	Restrict(ctx context.Context, userId string, restrictedAt time.Time) (updated bool, err error)
+	Resolve(ctx context.Context, userId string, paidAt time.Time) (updated bool, err error)
+}
+
+type DunningRepository struct {
+	Database squirrel.StatementBuilderType
+}
+
+var dunningColumns = []string{"UserId", "Provider", "SubscriptionId", "Status", "FailedAt", "GraceEndsAt", "RemindersSent",
+	"LastReminderAt", "RestrictedAt", "ResolvedAt", "UpdatedAt"}
+
+func scanDunning(row squirrel.RowScanner) (dunning entities.Dunning, err error) {
+	err = row.Scan(&dunning.UserId, &dunning.Provider, &dunning.SubscriptionId, &dunning.Status, &dunning.FailedAt,
+		&dunning.GraceEndsAt, &dunning.RemindersSent, &dunning.LastReminderAt, &dunning.RestrictedAt, &dunning.ResolvedAt,
+		&dunning.UpdatedAt)
+	if err != nil {
+		return entities.Dunning{}, err
+	}
+	return dunning, nil
+}
+
+// Open TODO: 1. Start the case of the user, replacing a case resolved before the failure, 2. Return whether it was opened, an open case or a later payment keeps the current one
+func (dr *DunningRepository) Open(ctx context.Context, dunning entities.Dunning) (opened bool, err error) {
+	var userId string
+	err = dr.Database.Insert(entities.DunningTableName).
+		Columns(dunningColumns...).
+		Values(dunning.UserId, dunning.Provider, dunning.SubscriptionId, dunning.Status, dunning.FailedAt, dunning.GraceEndsAt,
+			dunning.RemindersSent, dunning.LastReminderAt, dunning.RestrictedAt, dunning.ResolvedAt, dunning.UpdatedAt).
+		Suffix(`ON CONFLICT (UserId) DO UPDATE SET Provider = EXCLUDED.Provider, SubscriptionId = EXCLUDED.SubscriptionId,
+			Status = EXCLUDED.Status, FailedAt = EXCLUDED.FailedAt, GraceEndsAt = EXCLUDED.GraceEndsAt,
+			RemindersSent = EXCLUDED.RemindersSent, LastReminderAt = EXCLUDED.LastReminderAt, RestrictedAt = EXCLUDED.RestrictedAt,
+			ResolvedAt = EXCLUDED.ResolvedAt, UpdatedAt = EXCLUDED.UpdatedAt
+			WHERE dunning.Status = ? AND dunning.ResolvedAt < EXCLUDED.FailedAt
+			RETURNING UserId`, entities.DunningResolved).
+		QueryRowContext(ctx).
+		Scan(&userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// FindByUser TODO: 1. Find the latest case of the user, 2. Return dunning
+func (dr *DunningRepository) FindByUser(ctx context.Context, userId string) (dunning entities.Dunning, err error) {
+	row := dr.Database.Select(dunningColumns...).
+		From(entities.DunningTableName).
+		Where(squirrel.Eq{"UserId": userId}).
+		QueryRowContext(ctx)
+	return scanDunning(row)
+}
+
+// FindInGrace TODO: 1. Find the cases whose grace period runs, the first to end first, restricted cases wait for a payment only, 2. Return dunnings
+func (dr *DunningRepository) FindInGrace(ctx context.Context, limit uint64) (dunnings []entities.Dunning, err error) {
+	rows, err := dr.Database.Select(dunningColumns...).
+		From(entities.DunningTableName).
+		Where(squirrel.Eq{"Status": entities.DunningGrace}).
+		OrderBy("GraceEndsAt").
+		Limit(limit).
+		QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		dunning, err := scanDunning(rows)
+		if err != nil {
+			return nil, err
+		}
+		dunnings = append(dunnings, dunning)
+	}
+	return dunnings, rows.Err()
+}
+
+// UpdateRemindersSent TODO: 1. Count the reminders unless another worker already did, counting them back clears the claim, 2. Return whether it was counted
+func (dr *DunningRepository) UpdateRemindersSent(ctx context.Context, userId string, previous int, remindersSent int, remindedAt *time.Time) (updated bool, err error) {
+	result, err := dr.Database.Update(entities.DunningTableName).
+		Set("RemindersSent", remindersSent).
+		Set("LastReminderAt", remindedAt).
+		Set("UpdatedAt", time.Now()).
+		Where(squirrel.Eq{"UserId": userId, "RemindersSent": previous,
+			"Status": []string{entities.DunningGrace, entities.DunningRestricted}}).
+		ExecContext(ctx)
+	return affected(result, err)
+}
+
+// Restrict TODO: 1. Move a case in grace to restricted, 2. Return whether it moved
+func (dr *DunningRepository) Restrict(ctx context.Context, userId string, restrictedAt time.Time) (updated bool, err error) {
+	result, err := dr.Database.Update(entities.DunningTableName).
+		Set("Status", entities.DunningRestricted).
+		Set("RestrictedAt", restrictedAt).
+		Set("UpdatedAt", restrictedAt).
+		Where(squirrel.Eq{"UserId": userId, "Status": entities.DunningGrace}).
+		ExecContext(ctx)
+	return affected(result, err)
+}
+
+// Resolve TODO: 1. Close the open case of the user when the payment came after the failure, it is resolved at the payment so later failures compare with provider times, 2. Return whether it was closed
+func (dr *DunningRepository) Resolve(ctx context.Context, userId string, paidAt time.Time) (updated bool, err error) {
+	result, err := dr.Database.Update(entities.DunningTableName).
+		Set("Status", entities.DunningResolved).
+		Set("ResolvedAt", paidAt).
+		Set("UpdatedAt", time.Now()).
+		Where(squirrel.Eq{"UserId": userId, "Status": []string{entities.DunningGrace, entities.DunningRestricted}}).
+		Where(squirrel.LtOrEq{"FailedAt": paidAt}).
+		ExecContext(ctx)
+	return affected(result, err)
+}
+
+func affected(result sql.Result, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
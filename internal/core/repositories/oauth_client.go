@@ -0,0 +1,94 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"github.com/Lenstack/lensaas-app/internal/core/entities"
+	"github.com/Masterminds/squirrel"
+	"github.com/lib/pq"
+	"time"
+)
+
+type IOAuthClientRepository interface {
+	Create(ctx context.Context, client entities.OAuthClient) (clientId string, err error)
+	FindById(ctx context.Context, clientId string) (client entities.OAuthClient, err error)
+	FindAll(ctx context.Context) (clients []entities.OAuthClient, err error)
+	Revoke(ctx context.Context, clientId string) (message string, err error)
+}
+
+type OAuthClientRepository struct {
+	Database squirrel.StatementBuilderType
+}
+
+var oauthClientColumns = []string{"Id", "Name", "SecretHash", "Scopes", "CreatedBy", "RevokedAt", "CreatedAt"}
+
+func scanOAuthClient(row squirrel.RowScanner) (client entities.OAuthClient, err error) {
+	err = row.Scan(&client.Id, &client.Name, &client.SecretHash, pq.Array(&client.Scopes), &client.CreatedBy,
+		&client.RevokedAt, &client.CreatedAt)
+	if err != nil {
+		return entities.OAuthClient{}, err
+	}
+	return client, nil
+}
+
+// Create TODO: 1. Insert the oauth client, 2. Return client id
+func (or *OAuthClientRepository) Create(ctx context.Context, client entities.OAuthClient) (clientId string, err error) {
+	qb := or.Database.Insert(entities.OAuthClientTableName).
+		Columns("Id", "Name", "SecretHash", "Scopes", "CreatedBy", "CreatedAt").
+		Values(client.Id, client.Name, client.SecretHash, pq.Array(client.Scopes), client.CreatedBy, client.CreatedAt).
+		Suffix("RETURNING Id")
+	err = qb.QueryRowContext(ctx).Scan(&clientId)
+	if err != nil {
+		return "", err
+	}
+	return clientId, nil
+}
+
+// FindById TODO: 1. Find oauth client by id, 2. Return oauth client
+func (or *OAuthClientRepository) FindById(ctx context.Context, clientId string) (client entities.OAuthClient, err error) {
+	row := or.Database.Select(oauthClientColumns...).
+		From(entities.OAuthClientTableName).
+		Where(squirrel.Eq{"Id": clientId}).
+		QueryRowContext(ctx)
+	return scanOAuthClient(row)
+}
+
+// FindAll TODO: 1. Find every oauth client, newest first, 2. Return oauth clients
+func (or *OAuthClientRepository) FindAll(ctx context.Context) (clients []entities.OAuthClient, err error) {
+	rows, err := or.Database.Select(oauthClientColumns...).
+		From(entities.OAuthClientTableName).
+		OrderBy("CreatedAt DESC").
+		QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		client, err := scanOAuthClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+	return clients, rows.Err()
+}
+
+// Revoke TODO: 1. Mark the oauth client as revoked, 2. Return success message
+func (or *OAuthClientRepository) Revoke(ctx context.Context, clientId string) (message string, err error) {
+	result, err := or.Database.Update(entities.OAuthClientTableName).
+		Set("RevokedAt", time.Now()).
+		Where(squirrel.Eq{"Id": clientId, "RevokedAt": nil}).
+		ExecContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+	if affected == 0 {
+		return "", errors.New("oauth client not found")
+	}
+	return "oauth client revoked successfully", nil
+}
@@ -0,0 +1,94 @@
+package repositories
+
+import (
+	"context"
+	"github.com/Lenstack/lensaas-app/internal/core/entities"
+	"github.com/Masterminds/squirrel"
+)
+
+type ISubscriptionRepository interface {
+	Upsert(ctx context.Context, subscription entities.Subscription) (subscriptionId string, err error)
+	FindById(ctx context.Context, subscriptionId string) (subscription entities.Subscription, err error)
+	FindCurrentByUser(ctx context.Context, userId string) (subscription entities.Subscription, err error)
+	FindByUser(ctx context.Context, userId string) (subscriptions []entities.Subscription, err error)
+}
+
+type SubscriptionRepository struct {
+	Database squirrel.StatementBuilderType
+}
+
+var subscriptionColumns = []string{"Id", "Provider", "UserId", "CustomerId", "ItemId", "PriceId", "Quantity", "MeteredItemId", "Status",
+	"CancelAtPeriodEnd", "CurrentPeriodStart", "CurrentPeriodEnd", "CanceledAt", "TrialEnd", "CreatedAt", "UpdatedAt"}
+
+func scanSubscription(row squirrel.RowScanner) (subscription entities.Subscription, err error) {
+	err = row.Scan(&subscription.Id, &subscription.Provider, &subscription.UserId, &subscription.CustomerId, &subscription.ItemId,
+		&subscription.PriceId, &subscription.Quantity, &subscription.MeteredItemId, &subscription.Status, &subscription.CancelAtPeriodEnd,
+		&subscription.CurrentPeriodStart, &subscription.CurrentPeriodEnd, &subscription.CanceledAt, &subscription.TrialEnd,
+		&subscription.CreatedAt, &subscription.UpdatedAt)
+	if err != nil {
+		return entities.Subscription{}, err
+	}
+	return subscription, nil
+}
+
+// Upsert TODO: 1. Insert the subscription or overwrite the mirrored state of an existing one, 2. Return subscription id
+func (sr *SubscriptionRepository) Upsert(ctx context.Context, subscription entities.Subscription) (subscriptionId string, err error) {
+	qb := sr.Database.Insert(entities.SubscriptionTableName).
+		Columns(subscriptionColumns...).
+		Values(subscription.Id, subscription.Provider, subscription.UserId, subscription.CustomerId, subscription.ItemId, subscription.PriceId,
+			subscription.Quantity, subscription.MeteredItemId, subscription.Status, subscription.CancelAtPeriodEnd,
+			subscription.CurrentPeriodStart, subscription.CurrentPeriodEnd, subscription.CanceledAt, subscription.TrialEnd,
+			subscription.CreatedAt, subscription.UpdatedAt).
+		Suffix(`ON CONFLICT (Id) DO UPDATE SET ItemId = EXCLUDED.ItemId, PriceId = EXCLUDED.PriceId, Quantity = EXCLUDED.Quantity,
+			MeteredItemId = EXCLUDED.MeteredItemId, Status = EXCLUDED.Status, CancelAtPeriodEnd = EXCLUDED.CancelAtPeriodEnd,
+			CurrentPeriodStart = EXCLUDED.CurrentPeriodStart, CurrentPeriodEnd = EXCLUDED.CurrentPeriodEnd,
+			CanceledAt = EXCLUDED.CanceledAt, TrialEnd = EXCLUDED.TrialEnd, UpdatedAt = EXCLUDED.UpdatedAt
+			RETURNING Id`)
+	err = qb.QueryRowContext(ctx).Scan(&subscriptionId)
+	if err != nil {
+		return "", err
+	}
+	return subscriptionId, nil
+}
+
+// FindById TODO: 1. Find subscription by its provider id, 2. Return subscription
+func (sr *SubscriptionRepository) FindById(ctx context.Context, subscriptionId string) (subscription entities.Subscription, err error) {
+	row := sr.Database.Select(subscriptionColumns...).
+		From(entities.SubscriptionTableName).
+		Where(squirrel.Eq{"Id": subscriptionId}).
+		QueryRowContext(ctx)
+	return scanSubscription(row)
+}
+
+// FindCurrentByUser TODO: 1. Find the newest subscription of the user, ended ones included, 2. Return subscription
+func (sr *SubscriptionRepository) FindCurrentByUser(ctx context.Context, userId string) (subscription entities.Subscription, err error) {
+	row := sr.Database.Select(subscriptionColumns...).
+		From(entities.SubscriptionTableName).
+		Where(squirrel.Eq{"UserId": userId}).
+		OrderBy("CreatedAt DESC").
+		Limit(1).
+		QueryRowContext(ctx)
+	return scanSubscription(row)
+}
+
+// FindByUser TODO: 1. Find every subscription of the user, newest first, 2. Return subscriptions
+func (sr *SubscriptionRepository) FindByUser(ctx context.Context, userId string) (subscriptions []entities.Subscription, err error) {
+	rows, err := sr.Database.Select(subscriptionColumns...).
+		From(entities.SubscriptionTableName).
+		Where(squirrel.Eq{"UserId": userId}).
+		OrderBy("CreatedAt DESC").
+		QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		subscription, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	return subscriptions, rows.Err()
+}
@@ -0,0 +1,99 @@
+package repositories
+
+import (
+	"context"
+	"github.com/Lenstack/lensaas-app/internal/core/entities"
+	"github.com/Masterminds/squirrel"
+	"time"
+)
+
+type ITrialRepository interface {
+	Create(ctx context.Context, trial entities.Trial) (created bool, err error)
+	FindByUser(ctx context.Context, userId string) (trial entities.Trial, err error)
+	FindRunning(ctx context.Context, limit uint64) (trials []entities.Trial, err error)
+	UpdateRemindersSent(ctx context.Context, userId string, previous int, remindersSent int, remindedAt *time.Time) (updated bool, err error)
+	Convert(ctx context.Context, userId string, convertedAt time.Time) (updated bool, err error)
+	Expire(ctx context.Context, userId string, expiredAt time.Time) (updated bool, err error)
+}
+
+type TrialRepository struct {
+	Database squirrel.StatementBuilderType
+}
+
+var trialColumns = []string{"UserId", "Plan", "StartedAt", "EndsAt", "RemindersSent", "LastReminderAt", "ConvertedAt", "ExpiredAt"}
+
+func scanTrial(row squirrel.RowScanner) (trial entities.Trial, err error) {
+	err = row.Scan(&trial.UserId, &trial.Plan, &trial.StartedAt, &trial.EndsAt, &trial.RemindersSent, &trial.LastReminderAt,
+		&trial.ConvertedAt, &trial.ExpiredAt)
+	if err != nil {
+		return entities.Trial{}, err
+	}
+	return trial, nil
+}
+
+// Create TODO: 1. Insert the trial, 2. Return whether it was created, users who already had a trial keep theirs
+func (tr *TrialRepository) Create(ctx context.Context, trial entities.Trial) (created bool, err error) {
+	return affected(tr.Database.Insert(entities.TrialTableName).
+		Columns("UserId", "Plan", "StartedAt", "EndsAt").
+		Values(trial.UserId, trial.Plan, trial.StartedAt, trial.EndsAt).
+		Suffix("ON CONFLICT (UserId) DO NOTHING").
+		ExecContext(ctx))
+}
+
+// FindByUser TODO: 1. Find the trial of the user, 2. Return trial
+func (tr *TrialRepository) FindByUser(ctx context.Context, userId string) (trial entities.Trial, err error) {
+	row := tr.Database.Select(trialColumns...).
+		From(entities.TrialTableName).
+		Where(squirrel.Eq{"UserId": userId}).
+		QueryRowContext(ctx)
+	return scanTrial(row)
+}
+
+// FindRunning TODO: 1. Find the trials neither converted nor expired, ending first first, 2. Return trials
+func (tr *TrialRepository) FindRunning(ctx context.Context, limit uint64) (trials []entities.Trial, err error) {
+	rows, err := tr.Database.Select(trialColumns...).
+		From(entities.TrialTableName).
+		Where(squirrel.Eq{"ConvertedAt": nil, "ExpiredAt": nil}).
+		OrderBy("EndsAt ASC").
+		Limit(limit).
+		QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		trial, err := scanTrial(rows)
+		if err != nil {
+			return nil, err
+		}
+		trials = append(trials, trial)
+	}
+	return trials, rows.Err()
+}
+
+// UpdateRemindersSent TODO: 1. Count the reminders of a running trial when no other worker counted them first, 2. Return whether it was updated
+func (tr *TrialRepository) UpdateRemindersSent(ctx context.Context, userId string, previous int, remindersSent int, remindedAt *time.Time) (updated bool, err error) {
+	return affected(tr.Database.Update(entities.TrialTableName).
+		Set("RemindersSent", remindersSent).
+		Set("LastReminderAt", remindedAt).
+		Where(squirrel.Eq{"UserId": userId, "RemindersSent": previous, "ConvertedAt": nil, "ExpiredAt": nil}).
+		ExecContext(ctx))
+}
+
+// Convert TODO: 1. End a running trial with a paid subscription, 2. Return whether it was running
+func (tr *TrialRepository) Convert(ctx context.Context, userId string, convertedAt time.Time) (updated bool, err error) {
+	return affected(tr.Database.Update(entities.TrialTableName).
+		Set("ConvertedAt", convertedAt).
+		Where(squirrel.Eq{"UserId": userId, "ConvertedAt": nil, "ExpiredAt": nil}).
+		ExecContext(ctx))
+}
+
+// Expire TODO: 1. End a running trial that reached its end, 2. Return whether it was running
+func (tr *TrialRepository) Expire(ctx context.Context, userId string, expiredAt time.Time) (updated bool, err error) {
+	return affected(tr.Database.Update(entities.TrialTableName).
+		Set("ExpiredAt", expiredAt).
+		Where(squirrel.Eq{"UserId": userId, "ConvertedAt": nil, "ExpiredAt": nil}).
+		Where(squirrel.LtOrEq{"EndsAt": expiredAt}).
+		ExecContext(ctx))
+}
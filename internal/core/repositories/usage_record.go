@@ -0,0 +1,147 @@
+package repositories
+
+import (
+	"context"
+	"github.com/Lenstack/lensaas-app/internal/core/entities"
+	"github.com/Masterminds/squirrel"
+	"time"
+)
+
+type IUsageRecordRepository interface {
+	Add(ctx context.Context, flushKey string, field string, usageRecord entities.UsageRecord) (added bool, err error)
+	DeleteFlush(ctx context.Context, flushKey string) (message string, err error)
+	FindByPeriod(ctx context.Context, userId string, periodStart time.Time) (usageRecords []entities.UsageRecord, err error)
+	FindByUser(ctx context.Context, userId string) (usageRecords []entities.UsageRecord, err error)
+	FindUnreported(ctx context.Context, limit uint64) (usageRecords []entities.UsageRecord, err error)
+	UpdateReportedQuantity(ctx context.Context, usageRecordId string, reportedQuantity int64, reportedAt time.Time) (message string, err error)
+}
+
+type UsageRecordRepository struct {
+	Database squirrel.StatementBuilderType
+}
+
+var usageRecordColumns = []string{"Id", "UserId", "Metric", "PeriodStart", "PeriodEnd", "Quantity", "ReportedQuantity",
+	"ReportedAt", "CreatedAt", "UpdatedAt"}
+
+func scanUsageRecord(row squirrel.RowScanner) (usageRecord entities.UsageRecord, err error) {
+	err = row.Scan(&usageRecord.Id, &usageRecord.UserId, &usageRecord.Metric, &usageRecord.PeriodStart,
+		&usageRecord.PeriodEnd, &usageRecord.Quantity, &usageRecord.ReportedQuantity, &usageRecord.ReportedAt,
+		&usageRecord.CreatedAt, &usageRecord.UpdatedAt)
+	if err != nil {
+		return entities.UsageRecord{}, err
+	}
+	return usageRecord, nil
+}
+
+// Add TODO: 1. Mark the counter of the flushing key as added, 2. Insert the usage of the period or add the quantity to the existing one in the same statement,
+// 3. Return whether it was added, a counter already marked is not added twice
+func (ur *UsageRecordRepository) Add(ctx context.Context, flushKey string, field string, usageRecord entities.UsageRecord) (added bool, err error) {
+	qb := ur.Database.Insert(entities.UsageRecordTableName).
+		Prefix("WITH flush AS (INSERT INTO "+entities.UsageFlushTableName+` (FlushKey, Field, CreatedAt) VALUES (?, ?, ?)
+			ON CONFLICT DO NOTHING RETURNING FlushKey)`, flushKey, field, usageRecord.UpdatedAt).
+		Columns("Id", "UserId", "Metric", "PeriodStart", "PeriodEnd", "Quantity", "CreatedAt", "UpdatedAt").
+		Select(squirrel.Select().
+			Column("?::uuid", usageRecord.Id).
+			Column("?::uuid", usageRecord.UserId).
+			Column("?::varchar", usageRecord.Metric).
+			Column("?::timestamptz", usageRecord.PeriodStart).
+			Column("?::timestamptz", usageRecord.PeriodEnd).
+			Column("?::bigint", usageRecord.Quantity).
+			Column("?::timestamptz", usageRecord.CreatedAt).
+			Column("?::timestamptz", usageRecord.UpdatedAt).
+			Where("EXISTS (SELECT 1 FROM flush)")).
+		Suffix(`ON CONFLICT (UserId, Metric, PeriodStart) DO UPDATE SET
+			Quantity = usage_records.Quantity + EXCLUDED.Quantity, UpdatedAt = EXCLUDED.UpdatedAt`)
+	return affected(qb.ExecContext(ctx))
+}
+
+// DeleteFlush TODO: 1. Drop the markers of a drained flushing key, 2. Return success message
+func (ur *UsageRecordRepository) DeleteFlush(ctx context.Context, flushKey string) (message string, err error) {
+	_, err = ur.Database.Delete(entities.UsageFlushTableName).
+		Where(squirrel.Eq{"FlushKey": flushKey}).
+		ExecContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	return "usage flush deleted successfully", nil
+}
+
+// FindByPeriod TODO: 1. Find the usage of the user for the period starting at periodStart, 2. Return usage records
+func (ur *UsageRecordRepository) FindByPeriod(ctx context.Context, userId string, periodStart time.Time) (usageRecords []entities.UsageRecord, err error) {
+	rows, err := ur.Database.Select(usageRecordColumns...).
+		From(entities.UsageRecordTableName).
+		Where(squirrel.Eq{"UserId": userId, "PeriodStart": periodStart}).
+		OrderBy("Metric").
+		QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		usageRecord, err := scanUsageRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		usageRecords = append(usageRecords, usageRecord)
+	}
+	return usageRecords, rows.Err()
+}
+
+// FindByUser TODO: 1. Find the usage of the user over every period, newest first, 2. Return usage records
+func (ur *UsageRecordRepository) FindByUser(ctx context.Context, userId string) (usageRecords []entities.UsageRecord, err error) {
+	rows, err := ur.Database.Select(usageRecordColumns...).
+		From(entities.UsageRecordTableName).
+		Where(squirrel.Eq{"UserId": userId}).
+		OrderBy("PeriodStart DESC", "Metric").
+		QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		usageRecord, err := scanUsageRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		usageRecords = append(usageRecords, usageRecord)
+	}
+	return usageRecords, rows.Err()
+}
+
+// FindUnreported TODO: 1. Find usage not fully sent to the billing provider, oldest first, 2. Return usage records
+func (ur *UsageRecordRepository) FindUnreported(ctx context.Context, limit uint64) (usageRecords []entities.UsageRecord, err error) {
+	rows, err := ur.Database.Select(usageRecordColumns...).
+		From(entities.UsageRecordTableName).
+		Where("Quantity > ReportedQuantity").
+		OrderBy("UpdatedAt").
+		Limit(limit).
+		QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		usageRecord, err := scanUsageRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		usageRecords = append(usageRecords, usageRecord)
+	}
+	return usageRecords, rows.Err()
+}
+
+// UpdateReportedQuantity TODO: 1. Record how much of the usage the billing provider has, 2. Return success message
+func (ur *UsageRecordRepository) UpdateReportedQuantity(ctx context.Context, usageRecordId string, reportedQuantity int64, reportedAt time.Time) (message string, err error) {
+	_, err = ur.Database.Update(entities.UsageRecordTableName).
+		Set("ReportedQuantity", reportedQuantity).
+		Set("ReportedAt", reportedAt).
+		Where(squirrel.Eq{"Id": usageRecordId}).
+		ExecContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	return "usage record reported successfully", nil
+}
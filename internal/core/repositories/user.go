@@ -12,17 +12,41 @@ import (
 )
 
 type IUserRepository interface {
-	Create(user entities.User) (userId string, err error)
-	FindById(userId string) (user entities.User, err error)
-	FindByEmail(email string) (user entities.User, err error)
-	FindByRefreshToken(refreshToken string) (user entities.User, err error)
-	UpdateVerified(email string, verified bool) (message string, err error)
-	UpdateVerificationCode(email string, code string, sendExpiresAt time.Time) (message string, err error)
-
-	FindRefreshToken(userId string) (refreshToken []entities.TokenList, err error)
-	SaveRefreshToken(userId string, refreshToken string, expiresIn time.Duration) (message string, err error)
-	DeleteRefreshToken(tokenId string) (message string, err error)
-	BlockRefreshToken(tokenId string) (message string, err error)
+	Create(ctx context.Context, user entities.User) (userId string, err error)
+	FindById(ctx context.Context, userId string) (user entities.User, err error)
+	FindByEmail(ctx context.Context, email string) (user entities.User, err error)
+	FindByRefreshToken(ctx context.Context, refreshToken string) (user entities.User, err error)
+	FindByBillingCustomerId(ctx context.Context, provider string, customerId string) (user entities.User, err error)
+	UpdateVerified(ctx context.Context, email string, verified bool) (message string, err error)
+	UpdateVerificationCode(ctx context.Context, email string, code string, sendExpiresAt time.Time) (message string, err error)
+	UpdatePassword(ctx context.Context, userId string, password string) (message string, err error)
+	UpdateEmail(ctx context.Context, userId string, email string) (message string, err error)
+	UpdateBillingCustomer(ctx context.Context, userId string, provider string, customerId string) (message string, err error)
+	UpdateDeactivatedAt(ctx context.Context, userId string, deactivatedAt *time.Time) (message string, err error)
+	FindDeactivatedBefore(ctx context.Context, before time.Time) (users []entities.User, err error)
+	Anonymize(ctx context.Context, userId string) (message string, err error)
+	Delete(ctx context.Context, userId string) (message string, err error)
+
+	SaveEmailChange(ctx context.Context, userId string, email string, token string, expiresIn time.Duration) (message string, err error)
+	FindEmailChange(ctx context.Context, userId string) (email string, token string, err error)
+	DeleteEmailChange(ctx context.Context, userId string) (message string, err error)
+
+	FindSignInFailures(ctx context.Context, userId string) (failures int, lastFailure time.Time, err error)
+	IncrementSignInFailures(ctx context.Context, userId string, expiresIn time.Duration) (failures int, err error)
+	DeleteSignInFailures(ctx context.Context, userId string) (message string, err error)
+	FindSignInLock(ctx context.Context, userId string) (expiresIn time.Duration, err error)
+	SaveSignInLock(ctx context.Context, userId string, expiresIn time.Duration) (message string, err error)
+	DeleteSignInLock(ctx context.Context, userId string) (message string, err error)
+
+	SavePasswordResetToken(ctx context.Context, userId string, token string, expiresIn time.Duration) (message string, err error)
+	FindPasswordResetToken(ctx context.Context, userId string) (token string, err error)
+	DeletePasswordResetToken(ctx context.Context, userId string) (message string, err error)
+
+	FindRefreshToken(ctx context.Context, userId string) (refreshToken []entities.TokenList, err error)
+	SaveRefreshToken(ctx context.Context, userId string, refreshToken string, expiresIn time.Duration) (message string, err error)
+	DeleteRefreshToken(ctx context.Context, tokenId string) (message string, err error)
+	BlockRefreshToken(ctx context.Context, tokenId string) (message string, err error)
+	DeleteRefreshTokens(ctx context.Context, userId string) (message string, err error)
 }
 
 type UserRepository struct {
@@ -30,13 +54,26 @@ type UserRepository struct {
 	Redis    *redis.Client
 }
 
+var userColumns = []string{"Id", "Name", "Email", "Password", "Verified", "Role", "Code", "Token", "SendExpiresAt",
+	"DeactivatedAt", "PurgedAt", "COALESCE(BillingProvider, '')", "COALESCE(BillingCustomerId, '')", "CreatedAt", "UpdatedAt"}
+
+func scanUser(row squirrel.RowScanner) (user entities.User, err error) {
+	err = row.Scan(&user.Id, &user.Name, &user.Email, &user.Password,
+		&user.Verified, &user.Role, &user.Code, &user.Token, &user.SendExpiresAt,
+		&user.DeactivatedAt, &user.PurgedAt, &user.BillingProvider, &user.BillingCustomerId, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		return entities.User{}, err
+	}
+	return user, nil
+}
+
 // Create TODO: 1. Create user, 2. Return user id
-func (ur *UserRepository) Create(user entities.User) (userId string, err error) {
+func (ur *UserRepository) Create(ctx context.Context, user entities.User) (userId string, err error) {
 	qb := ur.Database.Insert(entities.UserTableName).
-		Columns("Id", "Name", "Email", "Password", "Verified", "Code", "Token", "SendExpiresAt").
-		Values(user.Id, user.Name, user.Email, user.Password, user.Verified, user.Code, user.Token, user.SendExpiresAt).
+		Columns("Id", "Name", "Email", "Password", "Verified", "Role", "Code", "Token", "SendExpiresAt").
+		Values(user.Id, user.Name, user.Email, user.Password, user.Verified, user.Role, user.Code, user.Token, user.SendExpiresAt).
 		Suffix("RETURNING Id")
-	err = qb.QueryRow().Scan(&userId)
+	err = qb.QueryRowContext(ctx).Scan(&userId)
 	if err != nil {
 		return "", err
 	}
@@ -44,61 +81,49 @@ func (ur *UserRepository) Create(user entities.User) (userId string, err error)
 }
 
 // FindById TODO: 1. Find user by id, 2. Return user
-func (ur *UserRepository) FindById(userId string) (user entities.User, err error) {
-	err = ur.Database.Select("Id", "Name", "Email", "Password",
-		"Verified", "Code", "Token", "SendExpiresAt", "CreatedAt", "UpdatedAt").
+func (ur *UserRepository) FindById(ctx context.Context, userId string) (user entities.User, err error) {
+	row := ur.Database.Select(userColumns...).
 		From(entities.UserTableName).
 		Where(squirrel.Eq{"id": userId}).
-		QueryRow().
-		Scan(&user.Id, &user.Name, &user.Email, &user.Password,
-			&user.Verified, &user.Code, &user.Token, &user.SendExpiresAt,
-			&user.CreatedAt, &user.UpdatedAt)
-	if err != nil {
-		return entities.User{}, err
-	}
-	return user, nil
+		QueryRowContext(ctx)
+	return scanUser(row)
 }
 
-// FindByEmail TODO: 1. Find user by email, 2. Return user
-func (ur *UserRepository) FindByEmail(email string) (user entities.User, err error) {
-	err = ur.Database.Select("Id", "Name", "Email", "Password",
-		"Verified", "Code", "Token", "SendExpiresAt", "CreatedAt", "UpdatedAt").
+// FindByEmail TODO: 1. Find user by email whatever its case, as the unique index compares them, 2. Return user
+func (ur *UserRepository) FindByEmail(ctx context.Context, email string) (user entities.User, err error) {
+	row := ur.Database.Select(userColumns...).
 		From(entities.UserTableName).
-		Where(squirrel.Eq{"email": email}).
-		QueryRow().
-		Scan(&user.Id, &user.Name, &user.Email, &user.Password,
-			&user.Verified, &user.Code, &user.Token, &user.SendExpiresAt,
-			&user.CreatedAt, &user.UpdatedAt)
-	if err != nil {
-		return entities.User{}, err
-	}
-	return user, nil
+		Where("LOWER(Email) = LOWER(?)", email).
+		QueryRowContext(ctx)
+	return scanUser(row)
+}
+
+// FindByBillingCustomerId TODO: 1. Find user by its customer id at the billing provider, 2. Return user
+func (ur *UserRepository) FindByBillingCustomerId(ctx context.Context, provider string, customerId string) (user entities.User, err error) {
+	row := ur.Database.Select(userColumns...).
+		From(entities.UserTableName).
+		Where(squirrel.Eq{"BillingProvider": provider, "BillingCustomerId": customerId}).
+		QueryRowContext(ctx)
+	return scanUser(row)
 }
 
 // FindByRefreshToken TODO: 1. Find user by refresh token, 2. Return user
-func (ur *UserRepository) FindByRefreshToken(refreshToken string) (user entities.User, err error) {
-	err = ur.Database.Select("Id", "Name", "Email", "Password",
-		"Verified", "Code", "Token", "SendExpiresAt", "CreatedAt", "UpdatedAt").
+func (ur *UserRepository) FindByRefreshToken(ctx context.Context, refreshToken string) (user entities.User, err error) {
+	row := ur.Database.Select(userColumns...).
 		From(entities.UserTableName).
 		Where(squirrel.Eq{"token": refreshToken}).
-		QueryRow().
-		Scan(&user.Id, &user.Name, &user.Email, &user.Password,
-			&user.Verified, &user.Code, &user.Token, &user.SendExpiresAt,
-			&user.CreatedAt, &user.UpdatedAt)
-	if err != nil {
-		return entities.User{}, err
-	}
-	return user, nil
+		QueryRowContext(ctx)
+	return scanUser(row)
 }
 
 // UpdateVerified TODO: 1. Update verified, 2. Return success message
-func (ur *UserRepository) UpdateVerified(email string, verified bool) (message string, err error) {
+func (ur *UserRepository) UpdateVerified(ctx context.Context, email string, verified bool) (message string, err error) {
 	qb := ur.Database.Update(entities.UserTableName).
 		Set("Verified", verified).
-		Where(squirrel.Eq{"Email": email}).
+		Where("LOWER(Email) = LOWER(?)", email).
 		Suffix("RETURNING Id")
 
-	err = qb.QueryRow().Scan(&message)
+	err = qb.QueryRowContext(ctx).Scan(&message)
 	if err != nil {
 		return "", err
 	}
@@ -106,33 +131,297 @@ func (ur *UserRepository) UpdateVerified(email string, verified bool) (message s
 }
 
 // UpdateVerificationCode TODO: 1. Update verification code,SendExpiresAt by email 2. Return success message
-func (ur *UserRepository) UpdateVerificationCode(email string, code string, sendExpiresAt time.Time) (message string, err error) {
+func (ur *UserRepository) UpdateVerificationCode(ctx context.Context, email string, code string, sendExpiresAt time.Time) (message string, err error) {
 	qb := ur.Database.Update(entities.UserTableName).
 		Set("Code", code).
 		Set("SendExpiresAt", sendExpiresAt).
-		Where(squirrel.Eq{"Email": email}).
+		Where("LOWER(Email) = LOWER(?)", email).
+		Suffix("RETURNING Id")
+
+	err = qb.QueryRowContext(ctx).Scan(&message)
+	if err != nil {
+		return "", err
+	}
+	return message, nil
+}
+
+// UpdatePassword TODO: 1. Update password hash by user id, 2. Return success message
+func (ur *UserRepository) UpdatePassword(ctx context.Context, userId string, password string) (message string, err error) {
+	qb := ur.Database.Update(entities.UserTableName).
+		Set("Password", password).
+		Set("UpdatedAt", time.Now()).
+		Where(squirrel.Eq{"Id": userId}).
+		Suffix("RETURNING Id")
+
+	err = qb.QueryRowContext(ctx).Scan(&message)
+	if err != nil {
+		return "", err
+	}
+	return message, nil
+}
+
+// UpdateEmail TODO: 1. Update email by user id, the unique index rejects emails already in use, 2. Return success message
+func (ur *UserRepository) UpdateEmail(ctx context.Context, userId string, email string) (message string, err error) {
+	qb := ur.Database.Update(entities.UserTableName).
+		Set("Email", email).
+		Set("UpdatedAt", time.Now()).
+		Where(squirrel.Eq{"Id": userId}).
+		Suffix("RETURNING Id")
+
+	err = qb.QueryRowContext(ctx).Scan(&message)
+	if err != nil {
+		return "", err
+	}
+	return message, nil
+}
+
+// UpdateBillingCustomer TODO: 1. Link the user to its customer at the billing provider, 2. Return success message
+func (ur *UserRepository) UpdateBillingCustomer(ctx context.Context, userId string, provider string, customerId string) (message string, err error) {
+	qb := ur.Database.Update(entities.UserTableName).
+		Set("BillingProvider", provider).
+		Set("BillingCustomerId", customerId).
+		Set("UpdatedAt", time.Now()).
+		Where(squirrel.Eq{"Id": userId}).
+		Suffix("RETURNING Id")
+
+	err = qb.QueryRowContext(ctx).Scan(&message)
+	if err != nil {
+		return "", err
+	}
+	return message, nil
+}
+
+// UpdateDeactivatedAt TODO: 1. Deactivate the user, or restore it when deactivatedAt is nil, 2. Return success message
+func (ur *UserRepository) UpdateDeactivatedAt(ctx context.Context, userId string, deactivatedAt *time.Time) (message string, err error) {
+	qb := ur.Database.Update(entities.UserTableName).
+		Set("DeactivatedAt", deactivatedAt).
+		Set("UpdatedAt", time.Now()).
+		Where(squirrel.Eq{"Id": userId}).
+		Suffix("RETURNING Id")
+
+	err = qb.QueryRowContext(ctx).Scan(&message)
+	if err != nil {
+		return "", err
+	}
+	return message, nil
+}
+
+// FindDeactivatedBefore TODO: 1. Find users deactivated before the given time and not purged yet, 2. Return users
+func (ur *UserRepository) FindDeactivatedBefore(ctx context.Context, before time.Time) (users []entities.User, err error) {
+	rows, err := ur.Database.Select(userColumns...).
+		From(entities.UserTableName).
+		Where(squirrel.Lt{"DeactivatedAt": before}).
+		Where(squirrel.Eq{"PurgedAt": nil}).
+		QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// Anonymize TODO: 1. Replace every personal field of the user, keeping the row for referential integrity, 2. Mark it purged, 3. Return success message
+func (ur *UserRepository) Anonymize(ctx context.Context, userId string) (message string, err error) {
+	qb := ur.Database.Update(entities.UserTableName).
+		Set("Name", "Deleted User").
+		Set("Email", fmt.Sprintf("deleted-%s@invalid", userId)).
+		Set("Password", "").
+		Set("Verified", false).
+		Set("Code", "").
+		Set("Token", "").
+		Set("BillingProvider", nil).
+		Set("BillingCustomerId", nil).
+		Set("PurgedAt", time.Now()).
+		Set("UpdatedAt", time.Now()).
+		Where(squirrel.Eq{"Id": userId}).
+		Suffix("RETURNING Id")
+
+	err = qb.QueryRowContext(ctx).Scan(&message)
+	if err != nil {
+		return "", err
+	}
+	return message, nil
+}
+
+// Delete TODO: 1. Delete user by id, 2. Return success message
+func (ur *UserRepository) Delete(ctx context.Context, userId string) (message string, err error) {
+	qb := ur.Database.Delete(entities.UserTableName).
+		Where(squirrel.Eq{"Id": userId}).
 		Suffix("RETURNING Id")
 
-	err = qb.QueryRow().Scan(&message)
+	err = qb.QueryRowContext(ctx).Scan(&message)
 	if err != nil {
 		return "", err
 	}
 	return message, nil
 }
 
-// FindRefreshToken TODO: 1. Find refresh token by user id, 2. Return refresh token
-func (ur *UserRepository) FindRefreshToken(userId string) (refreshToken []entities.TokenList, err error) {
+// SaveEmailChange TODO: 1. Save the pending email change and its confirmation token, 2. Return success message
+func (ur *UserRepository) SaveEmailChange(ctx context.Context, userId string, email string, token string, expiresIn time.Duration) (message string, err error) {
+	key := fmt.Sprintf("email_change:%s", userId)
+	pipe := ur.Redis.TxPipeline()
+	pipe.Del(ctx, key)
+	pipe.HSet(ctx, key, map[string]interface{}{"Email": email, "Token": token})
+	pipe.Expire(ctx, key, expiresIn)
+	_, err = pipe.Exec(ctx)
+	if err != nil {
+		return "", err
+	}
+	return "success", nil
+}
+
+// FindEmailChange TODO: 1. Find the pending email change by user id, 2. Return new email and token
+func (ur *UserRepository) FindEmailChange(ctx context.Context, userId string) (email string, token string, err error) {
+	data, err := ur.Redis.HGetAll(ctx, fmt.Sprintf("email_change:%s", userId)).Result()
+	if err != nil {
+		return "", "", err
+	}
+	if len(data) == 0 {
+		return "", "", errors.New("email change not found")
+	}
+	return data["Email"], data["Token"], nil
+}
+
+// DeleteEmailChange TODO: 1. Delete the pending email change, 2. Return success message
+func (ur *UserRepository) DeleteEmailChange(ctx context.Context, userId string) (message string, err error) {
+	err = ur.Redis.Del(ctx, fmt.Sprintf("email_change:%s", userId)).Err()
+	if err != nil {
+		return "", err
+	}
+	return "success", nil
+}
+
+// SavePasswordResetToken TODO: 1. Save the last issued password reset token, replacing older ones, 2. Return success message
+func (ur *UserRepository) SavePasswordResetToken(ctx context.Context, userId string, token string, expiresIn time.Duration) (message string, err error) {
+	err = ur.Redis.Set(ctx, fmt.Sprintf("password_reset:%s", userId), token, expiresIn).Err()
+	if err != nil {
+		return "", err
+	}
+	return "success", nil
+}
+
+// FindPasswordResetToken TODO: 1. Find the pending password reset token by user id, 2. Return token
+func (ur *UserRepository) FindPasswordResetToken(ctx context.Context, userId string) (token string, err error) {
+	token, err = ur.Redis.Get(ctx, fmt.Sprintf("password_reset:%s", userId)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", errors.New("password reset token not found")
+	}
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// DeletePasswordResetToken TODO: 1. Delete the pending password reset token, 2. Return success message
+func (ur *UserRepository) DeletePasswordResetToken(ctx context.Context, userId string) (message string, err error) {
+	err = ur.Redis.Del(ctx, fmt.Sprintf("password_reset:%s", userId)).Err()
+	if err != nil {
+		return "", err
+	}
+	return "success", nil
+}
+
+// FindSignInFailures TODO: 1. Find failed sign-in counter by user id, 2. Return count and time of the last failure
+func (ur *UserRepository) FindSignInFailures(ctx context.Context, userId string) (failures int, lastFailure time.Time, err error) {
+	key := fmt.Sprintf("sign_in_failures:%s", userId)
+	data, err := ur.Redis.HGetAll(ctx, key).Result()
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	if len(data) == 0 {
+		return 0, time.Time{}, nil
+	}
+
+	failures, err = strconv.Atoi(data["Count"])
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	lastFailureUnix, err := strconv.ParseInt(data["LastFailure"], 10, 64)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return failures, time.UnixMilli(lastFailureUnix), nil
+}
+
+// IncrementSignInFailures TODO: 1. Increment failed sign-in counter, 2. Refresh its expiration, 3. Return the new count
+func (ur *UserRepository) IncrementSignInFailures(ctx context.Context, userId string, expiresIn time.Duration) (failures int, err error) {
+	key := fmt.Sprintf("sign_in_failures:%s", userId)
+	pipe := ur.Redis.TxPipeline()
+	count := pipe.HIncrBy(ctx, key, "Count", 1)
+	pipe.HSet(ctx, key, "LastFailure", time.Now().UnixMilli())
+	pipe.Expire(ctx, key, expiresIn)
+	_, err = pipe.Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return int(count.Val()), nil
+}
+
+// DeleteSignInFailures TODO: 1. Delete failed sign-in counter, 2. Return success message
+func (ur *UserRepository) DeleteSignInFailures(ctx context.Context, userId string) (message string, err error) {
+	err = ur.Redis.Del(ctx, fmt.Sprintf("sign_in_failures:%s", userId)).Err()
+	if err != nil {
+		return "", err
+	}
+	return "success", nil
+}
+
+// FindSignInLock TODO: 1. Find the remaining lock time by user id, 2. Return zero when the account is not locked
+func (ur *UserRepository) FindSignInLock(ctx context.Context, userId string) (expiresIn time.Duration, err error) {
+	expiresIn, err = ur.Redis.PTTL(ctx, fmt.Sprintf("sign_in_lock:%s", userId)).Result()
+	if err != nil {
+		return 0, err
+	}
+	// PTTL returns negative values when the key does not exist or has no expiration.
+	if expiresIn < 0 {
+		return 0, nil
+	}
+	return expiresIn, nil
+}
+
+// SaveSignInLock TODO: 1. Lock sign-in for the user until the lock expires, 2. Return success message
+func (ur *UserRepository) SaveSignInLock(ctx context.Context, userId string, expiresIn time.Duration) (message string, err error) {
+	err = ur.Redis.Set(ctx, fmt.Sprintf("sign_in_lock:%s", userId), time.Now().Unix(), expiresIn).Err()
+	if err != nil {
+		return "", err
+	}
+	return "success", nil
+}
+
+// DeleteSignInLock TODO: 1. Remove the lock and the failed sign-in counter, 2. Return success message
+func (ur *UserRepository) DeleteSignInLock(ctx context.Context, userId string) (message string, err error) {
+	err = ur.Redis.Del(ctx, fmt.Sprintf("sign_in_lock:%s", userId), fmt.Sprintf("sign_in_failures:%s", userId)).Err()
+	if err != nil {
+		return "", err
+	}
+	return "success", nil
+}
+
+// FindRefreshToken TODO: 1. Find the refresh tokens of the user, sessions that expired are skipped, 2. Return refresh token
+func (ur *UserRepository) FindRefreshToken(ctx context.Context, userId string) (refreshToken []entities.TokenList, err error) {
 	userKey := fmt.Sprintf("refresh_token:%s", userId)
-	keys, err := ur.Redis.SMembers(context.Background(), userKey).Result()
+	keys, err := ur.Redis.SMembers(ctx, userKey).Result()
 	if err != nil {
 		return nil, err
 	}
 
 	for _, key := range keys {
-		tokenData, err := ur.Redis.HGetAll(context.Background(), key).Result()
+		tokenData, err := ur.Redis.HGetAll(ctx, key).Result()
 		if err != nil {
 			return nil, err
 		}
+		// The set keeps the keys of sessions that expired since, their hash is gone.
+		if len(tokenData) == 0 {
+			continue
+		}
 
 		// Convert string to bool and int64
 		blocked, err := strconv.ParseBool(tokenData["Blocked"])
@@ -143,6 +432,9 @@ func (ur *UserRepository) FindRefreshToken(userId string) (refreshToken []entiti
 		if err != nil {
 			return nil, err
 		}
+		if expiration < time.Now().Unix() {
+			continue
+		}
 
 		tokenList := &entities.TokenList{
 			Type:       tokenData["Type"],
@@ -158,7 +450,7 @@ func (ur *UserRepository) FindRefreshToken(userId string) (refreshToken []entiti
 }
 
 // SaveRefreshToken TODO: 1. Save refresh token to redis, 2. Return success message
-func (ur *UserRepository) SaveRefreshToken(userId string, refreshToken string, expiresIn time.Duration) (message string, err error) {
+func (ur *UserRepository) SaveRefreshToken(ctx context.Context, userId string, refreshToken string, expiresIn time.Duration) (message string, err error) {
 	key := fmt.Sprintf("refresh_token:%s:%s", userId, refreshToken)
 	expiresInTime := time.Now().Add(expiresIn).Unix()
 
@@ -170,7 +462,7 @@ func (ur *UserRepository) SaveRefreshToken(userId string, refreshToken string, e
 		Expiration: expiresInTime,
 	}
 
-	err = ur.Redis.HMSet(context.Background(), key, map[string]interface{}{
+	err = ur.Redis.HMSet(ctx, key, map[string]interface{}{
 		"Type":       tokenList.Type,
 		"Token":      tokenList.Token,
 		"UserId":     tokenList.UserId,
@@ -181,13 +473,13 @@ func (ur *UserRepository) SaveRefreshToken(userId string, refreshToken string, e
 		return "", err
 	}
 
-	err = ur.Redis.Expire(context.Background(), key, expiresIn).Err()
+	err = ur.Redis.Expire(ctx, key, expiresIn).Err()
 	if err != nil {
 		return "", err
 	}
 
 	userKey := fmt.Sprintf("refresh_token:%s", userId)
-	err = ur.Redis.SAdd(context.Background(), userKey, key).Err()
+	err = ur.Redis.SAdd(ctx, userKey, key).Err()
 	if err != nil {
 		return "", err
 	}
@@ -196,8 +488,8 @@ func (ur *UserRepository) SaveRefreshToken(userId string, refreshToken string, e
 }
 
 // DeleteRefreshToken TODO: 1. Delete refresh token from redis, 2. Return success message
-func (ur *UserRepository) DeleteRefreshToken(tokenId string) (message string, err error) {
-	values, err := ur.Redis.HMGet(context.Background(), tokenId, "user_id", "refresh_token").Result()
+func (ur *UserRepository) DeleteRefreshToken(ctx context.Context, tokenId string) (message string, err error) {
+	values, err := ur.Redis.HMGet(ctx, tokenId, "user_id", "refresh_token").Result()
 	if err != nil {
 		return "", err
 	}
@@ -208,7 +500,7 @@ func (ur *UserRepository) DeleteRefreshToken(tokenId string) (message string, er
 		return "", errors.New("failed to get user_id or refresh_token from Redis")
 	}
 
-	deletedCount, err := ur.Redis.Del(context.Background(), tokenId).Result()
+	deletedCount, err := ur.Redis.Del(ctx, tokenId).Result()
 	if err != nil {
 		return "", err
 	}
@@ -217,7 +509,7 @@ func (ur *UserRepository) DeleteRefreshToken(tokenId string) (message string, er
 	}
 
 	tokensKey := fmt.Sprintf("user_refresh_tokens:%s", userId)
-	deletedCount, err = ur.Redis.ZRem(context.Background(), tokensKey, refreshToken).Result()
+	deletedCount, err = ur.Redis.ZRem(ctx, tokensKey, refreshToken).Result()
 	if err != nil {
 		return "", err
 	}
@@ -229,18 +521,18 @@ func (ur *UserRepository) DeleteRefreshToken(tokenId string) (message string, er
 }
 
 // BlockRefreshToken TODO: 1. Block refresh token from redis, 2. Return success message
-func (ur *UserRepository) BlockRefreshToken(userId, tokenId string) (message string, err error) {
+func (ur *UserRepository) BlockRefreshToken(ctx context.Context, userId, tokenId string) (message string, err error) {
 	userKey := fmt.Sprintf("refresh_token:%s", userId)
 
 	// Get all refresh tokens for the user.
-	keys, err := ur.Redis.SMembers(context.Background(), userKey).Result()
+	keys, err := ur.Redis.SMembers(ctx, userKey).Result()
 	if err != nil {
 		return "", err
 	}
 
 	// Check each refresh token for a match with the provided token ID.
 	for _, key := range keys {
-		tokenData, err := ur.Redis.HGetAll(context.Background(), key).Result()
+		tokenData, err := ur.Redis.HGetAll(ctx, key).Result()
 		if err != nil {
 			return "", err
 		}
@@ -257,7 +549,7 @@ func (ur *UserRepository) BlockRefreshToken(userId, tokenId string) (message str
 				return "", errors.New("token already blocked")
 			}
 			// Update the token's "blocked" status to true.
-			err = ur.Redis.HSet(context.Background(), key, "Blocked", true).Err()
+			err = ur.Redis.HSet(ctx, key, "Blocked", true).Err()
 			if err != nil {
 				return "", err
 			}
@@ -268,3 +560,18 @@ func (ur *UserRepository) BlockRefreshToken(userId, tokenId string) (message str
 	// If no matching token ID is found, return an error.
 	return "", errors.New("token not found")
 }
+
+// DeleteRefreshTokens TODO: 1. Delete every refresh token of the user from redis, 2. Return success message
+func (ur *UserRepository) DeleteRefreshTokens(ctx context.Context, userId string) (message string, err error) {
+	userKey := fmt.Sprintf("refresh_token:%s", userId)
+	keys, err := ur.Redis.SMembers(ctx, userKey).Result()
+	if err != nil {
+		return "", err
+	}
+
+	err = ur.Redis.Del(ctx, append(keys, userKey)...).Err()
+	if err != nil {
+		return "", err
+	}
+	return "success", nil
+}
@@ -0,0 +1,173 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/Lenstack/lensaas-app/internal/core/entities"
+	"github.com/Masterminds/squirrel"
+	"strings"
+	"time"
+)
+
+type IWebhookEventRepository interface {
+	Create(ctx context.Context, event entities.WebhookEvent) (created bool, err error)
+	FindById(ctx context.Context, eventId string) (event entities.WebhookEvent, err error)
+	FindDue(ctx context.Context, now time.Time, limit uint64) (eventIds []string, err error)
+	FindByStatus(ctx context.Context, status string, limit uint64) (eventIds []string, err error)
+	Claim(ctx context.Context, eventId string, now time.Time, leaseUntil time.Time) (event entities.WebhookEvent, err error)
+	MarkProcessed(ctx context.Context, eventId string, processedAt time.Time) (message string, err error)
+	MarkFailed(ctx context.Context, eventId string, status string, lastError string, nextAttemptAt time.Time) (message string, err error)
+	Reset(ctx context.Context, eventId string) (message string, err error)
+}
+
+type WebhookEventRepository struct {
+	Database squirrel.StatementBuilderType
+}
+
+var webhookEventColumns = []string{"Id", "Provider", "Type", "Payload", "Status", "Attempts", "LastError", "NextAttemptAt",
+	"ProcessedAt", "CreatedAt"}
+
+func scanWebhookEvent(row squirrel.RowScanner) (event entities.WebhookEvent, err error) {
+	err = row.Scan(&event.Id, &event.Provider, &event.Type, &event.Payload, &event.Status, &event.Attempts, &event.LastError,
+		&event.NextAttemptAt, &event.ProcessedAt, &event.CreatedAt)
+	if err != nil {
+		return entities.WebhookEvent{}, err
+	}
+	return event, nil
+}
+
+// Create TODO: 1. Insert the event unless it was already received, 2. Return whether it was inserted
+func (wr *WebhookEventRepository) Create(ctx context.Context, event entities.WebhookEvent) (created bool, err error) {
+	var eventId string
+	err = wr.Database.Insert(entities.WebhookEventTableName).
+		Columns("Id", "Provider", "Type", "Payload", "Status", "NextAttemptAt", "CreatedAt").
+		Values(event.Id, event.Provider, event.Type, event.Payload, event.Status, event.NextAttemptAt, event.CreatedAt).
+		Suffix("ON CONFLICT (Id) DO NOTHING RETURNING Id").
+		QueryRowContext(ctx).
+		Scan(&eventId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// FindById TODO: 1. Find event by its provider id, 2. Return event
+func (wr *WebhookEventRepository) FindById(ctx context.Context, eventId string) (event entities.WebhookEvent, err error) {
+	row := wr.Database.Select(webhookEventColumns...).
+		From(entities.WebhookEventTableName).
+		Where(squirrel.Eq{"Id": eventId}).
+		QueryRowContext(ctx)
+	return scanWebhookEvent(row)
+}
+
+// FindDue TODO: 1. Find pending events and abandoned leases whose next attempt is due, oldest first, 2. Return their ids
+func (wr *WebhookEventRepository) FindDue(ctx context.Context, now time.Time, limit uint64) (eventIds []string, err error) {
+	rows, err := wr.Database.Select("Id").
+		From(entities.WebhookEventTableName).
+		Where(squirrel.Eq{"Status": []string{entities.WebhookEventPending, entities.WebhookEventProcessing}}).
+		Where(squirrel.LtOrEq{"NextAttemptAt": now}).
+		OrderBy("NextAttemptAt").
+		Limit(limit).
+		QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return scanIds(rows)
+}
+
+// FindByStatus TODO: 1. Find events with the status, oldest first, 2. Return their ids
+func (wr *WebhookEventRepository) FindByStatus(ctx context.Context, status string, limit uint64) (eventIds []string, err error) {
+	rows, err := wr.Database.Select("Id").
+		From(entities.WebhookEventTableName).
+		Where(squirrel.Eq{"Status": status}).
+		OrderBy("CreatedAt").
+		Limit(limit).
+		QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return scanIds(rows)
+}
+
+// Claim TODO: 1. Take a lease on a due event and count the attempt, concurrent workers get sql.ErrNoRows, 2. Return event
+func (wr *WebhookEventRepository) Claim(ctx context.Context, eventId string, now time.Time, leaseUntil time.Time) (event entities.WebhookEvent, err error) {
+	row := wr.Database.Update(entities.WebhookEventTableName).
+		Set("Status", entities.WebhookEventProcessing).
+		Set("Attempts", squirrel.Expr("Attempts + 1")).
+		Set("NextAttemptAt", leaseUntil).
+		Where(squirrel.Eq{"Id": eventId, "Status": []string{entities.WebhookEventPending, entities.WebhookEventProcessing}}).
+		Where(squirrel.LtOrEq{"NextAttemptAt": now}).
+		Suffix("RETURNING " + joinColumns(webhookEventColumns)).
+		QueryRowContext(ctx)
+	return scanWebhookEvent(row)
+}
+
+// MarkProcessed TODO: 1. Mark the event as processed, 2. Return success message
+func (wr *WebhookEventRepository) MarkProcessed(ctx context.Context, eventId string, processedAt time.Time) (message string, err error) {
+	_, err = wr.Database.Update(entities.WebhookEventTableName).
+		Set("Status", entities.WebhookEventProcessed).
+		Set("LastError", nil).
+		Set("ProcessedAt", processedAt).
+		Where(squirrel.Eq{"Id": eventId}).
+		ExecContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	return "webhook event processed successfully", nil
+}
+
+// MarkFailed TODO: 1. Record the error, 2. Schedule the next attempt or give up with the failed status, 3. Return success message
+func (wr *WebhookEventRepository) MarkFailed(ctx context.Context, eventId string, status string, lastError string, nextAttemptAt time.Time) (message string, err error) {
+	_, err = wr.Database.Update(entities.WebhookEventTableName).
+		Set("Status", status).
+		Set("LastError", lastError).
+		Set("NextAttemptAt", nextAttemptAt).
+		Where(squirrel.Eq{"Id": eventId}).
+		ExecContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	return "webhook event failure recorded successfully", nil
+}
+
+// Reset TODO: 1. Make the event due again with a fresh attempt budget, 2. Return success message
+func (wr *WebhookEventRepository) Reset(ctx context.Context, eventId string) (message string, err error) {
+	result, err := wr.Database.Update(entities.WebhookEventTableName).
+		Set("Status", entities.WebhookEventPending).
+		Set("Attempts", 0).
+		Set("NextAttemptAt", time.Now()).
+		Where(squirrel.Eq{"Id": eventId}).
+		ExecContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+	if affected == 0 {
+		return "", errors.New("webhook event not found")
+	}
+	return "webhook event reset successfully", nil
+}
+
+func scanIds(rows *sql.Rows) (ids []string, err error) {
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func joinColumns(columns []string) string {
+	return strings.Join(columns, ", ")
+}
@@ -0,0 +1,415 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Lenstack/lensaas-app/internal/core/entities"
+	"github.com/Lenstack/lensaas-app/internal/core/models"
+	"github.com/Lenstack/lensaas-app/internal/core/repositories"
+	"github.com/Lenstack/lensaas-app/internal/templates"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"github.com/Masterminds/squirrel"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+)
+
+const (
+	DeletionModeAnonymize = "anonymize"
+	DeletionModeDelete    = "delete"
+
+	PurposeRestoreAccount = "restore_account"
+
+	AuditAccountDeactivated = "account.deactivated"
+	AuditAccountRestored    = "account.restored"
+	AuditAccountDeleted     = "account.deleted"
+	AuditAccountExported    = "account.exported"
+)
+
+type IAccountService interface {
+	DeleteAccount(ctx context.Context, userId string, password string) (message string, err error)
+	RestoreAccount(ctx context.Context, token string) (message string, err error)
+	PurgeDeactivatedAccounts(ctx context.Context) error
+	ExportAccount(ctx context.Context, userId string) (export models.AccountExport, err error)
+}
+
+type AccountService struct {
+	UserRepository          repositories.UserRepository
+	AuditLogRepository      repositories.AuditLogRepository
+	ApiKeyRepository        repositories.ApiKeyRepository
+	SubscriptionRepository  repositories.SubscriptionRepository
+	UsageRecordRepository   repositories.UsageRecordRepository
+	DunningRepository       repositories.DunningRepository
+	AccountMemberRepository repositories.AccountMemberRepository
+	TrialRepository         repositories.TrialRepository
+	TokenService            TokenService
+	EmailService            EmailService
+	AuditService            AuditService
+	BillingService          BillingService
+	UserService             UserService
+	GracePeriod             time.Duration
+	DeletionMode            string
+}
+
+func NewAccountService(database squirrel.StatementBuilderType, redis *redis.Client, tokenService TokenService, emailService EmailService, auditService AuditService, billingService BillingService, userService UserService, gracePeriod string, deletionMode string) *AccountService {
+	gracePeriodTime, err := time.ParseDuration(gracePeriod)
+	if err != nil {
+		panic(err)
+	}
+	if deletionMode != DeletionModeAnonymize && deletionMode != DeletionModeDelete {
+		panic(fmt.Sprintf("unknown account deletion mode %q", deletionMode))
+	}
+	return &AccountService{
+		UserRepository: repositories.UserRepository{
+			Database: database,
+			Redis:    redis,
+		},
+		AuditLogRepository: repositories.AuditLogRepository{
+			Database: database,
+		},
+		ApiKeyRepository: repositories.ApiKeyRepository{
+			Database: database,
+		},
+		SubscriptionRepository: repositories.SubscriptionRepository{
+			Database: database,
+		},
+		UsageRecordRepository: repositories.UsageRecordRepository{
+			Database: database,
+		},
+		DunningRepository: repositories.DunningRepository{
+			Database: database,
+		},
+		AccountMemberRepository: repositories.AccountMemberRepository{
+			Database: database,
+		},
+		TrialRepository: repositories.TrialRepository{
+			Database: database,
+		},
+		TokenService:   tokenService,
+		EmailService:   emailService,
+		AuditService:   auditService,
+		BillingService: billingService,
+		UserService:    userService,
+		GracePeriod:    gracePeriodTime,
+		DeletionMode:   deletionMode,
+	}
+}
+
+// DeleteAccount TODO: 1. Re-authenticate with the password, failures count towards the sign-in lockout, 2. Deactivate the account, 3. Revoke every session, 4. Send the restore link, 5. Return success message
+func (as *AccountService) DeleteAccount(ctx context.Context, userId string, password string) (message string, err error) {
+	ctx, span := tracer.Start(ctx, "AccountService.DeleteAccount")
+	defer span.End()
+
+	user, err := as.UserRepository.FindById(ctx, userId)
+	if err != nil {
+		return "", err
+	}
+
+	err = as.UserService.VerifyCurrentPassword(ctx, user, password)
+	if err != nil {
+		return "", err
+	}
+
+	if user.DeactivatedAt != nil {
+		return "", errors.New("account is already scheduled for deletion")
+	}
+
+	now := time.Now()
+	_, err = as.UserRepository.UpdateDeactivatedAt(ctx, user.Id, &now)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = as.UserRepository.DeleteRefreshTokens(ctx, user.Id)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = as.ApiKeyRepository.RevokeByUser(ctx, user.Id)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := as.TokenService.GeneratePurposeToken(user.Id, PurposeRestoreAccount, as.GracePeriod)
+	if err != nil {
+		return "", err
+	}
+
+	deletesAt := now.Add(as.GracePeriod)
+	mail, err := as.EmailService.Create("internal/templates/account_deletion_template.html", []string{user.Email},
+		"Your Account Will Be Deleted", templates.AccountDeletion{Name: strings.ToTitle(user.Name), Token: token,
+			DeletesAt: deletesAt.Format("January 2, 2006")}, []string{})
+	if err != nil {
+		return "", err
+	}
+
+	err = as.EmailService.Send(ctx, mail)
+	if err != nil {
+		return "", err
+	}
+
+	as.AuditService.Record(ctx, AuditAccountDeactivated, user.Id, map[string]interface{}{"deletes_at": deletesAt})
+	return fmt.Sprintf("your account will be deleted on %s, check your email to restore it before then", deletesAt.Format(time.RFC3339)), nil
+}
+
+// RestoreAccount TODO: 1. Validate the restore token, 2. Reactivate the account while the grace period lasts, 3. Return success message
+func (as *AccountService) RestoreAccount(ctx context.Context, token string) (message string, err error) {
+	ctx, span := tracer.Start(ctx, "AccountService.RestoreAccount")
+	defer span.End()
+
+	userId, err := as.TokenService.ValidatePurposeToken(token, PurposeRestoreAccount)
+	if err != nil {
+		return "", errors.New("invalid token")
+	}
+
+	user, err := as.UserRepository.FindById(ctx, userId)
+	if err != nil {
+		return "", err
+	}
+
+	if user.DeactivatedAt == nil {
+		return "", errors.New("account is not scheduled for deletion")
+	}
+	if user.PurgedAt != nil {
+		return "", errors.New("account has already been deleted")
+	}
+
+	_, err = as.UserRepository.UpdateDeactivatedAt(ctx, user.Id, nil)
+	if err != nil {
+		return "", err
+	}
+
+	as.AuditService.Record(ctx, AuditAccountRestored, user.Id, nil)
+	return "your account has been restored successfully", nil
+}
+
+// PurgeDeactivatedAccounts TODO: 1. Find accounts whose grace period ended, 2. Anonymise or delete them, 3. Purge their redis keys
+func (as *AccountService) PurgeDeactivatedAccounts(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "AccountService.PurgeDeactivatedAccounts")
+	defer span.End()
+
+	users, err := as.UserRepository.FindDeactivatedBefore(ctx, time.Now().Add(-as.GracePeriod))
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		err = as.purge(ctx, user)
+		if err != nil {
+			utils.Logger(ctx).Error("account purge failed", zap.String("user_id", user.Id), zap.Error(err))
+			continue
+		}
+		as.AuditService.Record(ctx, AuditAccountDeleted, user.Id, map[string]interface{}{"mode": as.DeletionMode})
+	}
+	return nil
+}
+
+func (as *AccountService) purge(ctx context.Context, user entities.User) error {
+	// The customer goes first, a failure leaves the account for the next run instead of orphaning it at the billing provider.
+	err := as.BillingService.DeleteCustomer(ctx, user.Id)
+	if err != nil {
+		return err
+	}
+
+	if as.DeletionMode == DeletionModeDelete {
+		_, err = as.UserRepository.Delete(ctx, user.Id)
+	} else {
+		_, err = as.UserRepository.Anonymize(ctx, user.Id)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = as.UserRepository.DeleteRefreshTokens(ctx, user.Id)
+	if err != nil {
+		return err
+	}
+	_, err = as.UserRepository.DeleteSignInLock(ctx, user.Id)
+	if err != nil {
+		return err
+	}
+	_, err = as.UserRepository.DeleteEmailChange(ctx, user.Id)
+	if err != nil {
+		return err
+	}
+	_, err = as.UserRepository.DeletePasswordResetToken(ctx, user.Id)
+	return err
+}
+
+// ExportAccount TODO: 1. Collect the profile, sessions and audit trail of the user, 2. Collect the api keys, billing, usage, seats and trial, 3. Return the export
+func (as *AccountService) ExportAccount(ctx context.Context, userId string) (export models.AccountExport, err error) {
+	ctx, span := tracer.Start(ctx, "AccountService.ExportAccount")
+	defer span.End()
+
+	user, err := as.UserRepository.FindById(ctx, userId)
+	if err != nil {
+		return models.AccountExport{}, err
+	}
+
+	refreshTokens, err := as.UserRepository.FindRefreshToken(ctx, user.Id)
+	if err != nil {
+		return models.AccountExport{}, err
+	}
+
+	auditLogs, err := as.AuditLogRepository.FindByUser(ctx, user.Id)
+	if err != nil {
+		return models.AccountExport{}, err
+	}
+
+	apiKeys, err := as.ApiKeyRepository.FindByUser(ctx, user.Id)
+	if err != nil {
+		return models.AccountExport{}, err
+	}
+
+	subscriptions, err := as.SubscriptionRepository.FindByUser(ctx, user.Id)
+	if err != nil {
+		return models.AccountExport{}, err
+	}
+
+	usageRecords, err := as.UsageRecordRepository.FindByUser(ctx, user.Id)
+	if err != nil {
+		return models.AccountExport{}, err
+	}
+
+	// The user owns an account and its members, or takes a seat of the account of another user.
+	members, err := as.AccountMemberRepository.FindByAccount(ctx, user.Id)
+	if err != nil {
+		return models.AccountExport{}, err
+	}
+	membership, err := as.AccountMemberRepository.FindByUser(ctx, user.Id)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return models.AccountExport{}, err
+	}
+	if err == nil {
+		members = append(members, membership)
+	}
+
+	dunning, err := as.DunningRepository.FindByUser(ctx, user.Id)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return models.AccountExport{}, err
+	}
+	hasDunning := err == nil
+
+	trial, err := as.TrialRepository.FindByUser(ctx, user.Id)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return models.AccountExport{}, err
+	}
+	hasTrial := err == nil
+
+	export = models.AccountExport{
+		ExportedAt: time.Now(),
+		Profile: models.AccountExportProfile{
+			Id:            user.Id,
+			Name:          user.Name,
+			Email:         user.Email,
+			Verified:      user.Verified,
+			Role:          user.Role,
+			DeactivatedAt: user.DeactivatedAt,
+			CreatedAt:     user.CreatedAt,
+			UpdatedAt:     user.UpdatedAt,
+		},
+		Sessions:  []models.AccountExportSession{},
+		AuditLogs: []models.AccountExportAuditLog{},
+		ApiKeys:   []models.AccountExportApiKey{},
+		Billing: models.AccountExportBilling{
+			Provider:      user.BillingProvider,
+			CustomerId:    user.BillingCustomerId,
+			Subscriptions: []models.AccountExportSubscription{},
+		},
+		UsageRecords:   []models.AccountExportUsageRecord{},
+		AccountMembers: []models.AccountExportAccountMember{},
+	}
+	// Token values are credentials, only their metadata is exported.
+	for _, refreshToken := range refreshTokens {
+		export.Sessions = append(export.Sessions, models.AccountExportSession{
+			Type:      refreshToken.Type,
+			Blocked:   refreshToken.Blocked,
+			ExpiresAt: time.Unix(refreshToken.Expiration, 0),
+		})
+	}
+	for _, auditLog := range auditLogs {
+		export.AuditLogs = append(export.AuditLogs, models.AccountExportAuditLog{
+			Action:    auditLog.Action,
+			ActorId:   auditLog.ActorId,
+			TargetId:  auditLog.TargetId,
+			Ip:        auditLog.Ip,
+			UserAgent: auditLog.UserAgent,
+			Metadata:  json.RawMessage(auditLog.Metadata),
+			CreatedAt: auditLog.CreatedAt,
+		})
+	}
+	// Key hashes are credentials too, only the metadata is exported.
+	for _, apiKey := range apiKeys {
+		export.ApiKeys = append(export.ApiKeys, models.AccountExportApiKey{
+			Id:         apiKey.Id,
+			Name:       apiKey.Name,
+			Prefix:     apiKey.Prefix,
+			Scopes:     apiKey.Scopes,
+			ExpiresAt:  apiKey.ExpiresAt,
+			LastUsedAt: apiKey.LastUsedAt,
+			RevokedAt:  apiKey.RevokedAt,
+			CreatedAt:  apiKey.CreatedAt,
+		})
+	}
+	for _, subscription := range subscriptions {
+		export.Billing.Subscriptions = append(export.Billing.Subscriptions, models.AccountExportSubscription{
+			Id:                 subscription.Id,
+			Provider:           subscription.Provider,
+			PriceId:            subscription.PriceId,
+			Quantity:           subscription.Quantity,
+			Status:             subscription.Status,
+			CancelAtPeriodEnd:  subscription.CancelAtPeriodEnd,
+			CurrentPeriodStart: subscription.CurrentPeriodStart,
+			CurrentPeriodEnd:   subscription.CurrentPeriodEnd,
+			CanceledAt:         subscription.CanceledAt,
+			TrialEnd:           subscription.TrialEnd,
+			CreatedAt:          subscription.CreatedAt,
+			UpdatedAt:          subscription.UpdatedAt,
+		})
+	}
+	if hasDunning {
+		export.Billing.Dunning = &models.AccountExportDunning{
+			SubscriptionId: dunning.SubscriptionId,
+			Status:         dunning.Status,
+			FailedAt:       dunning.FailedAt,
+			GraceEndsAt:    dunning.GraceEndsAt,
+			RemindersSent:  dunning.RemindersSent,
+			RestrictedAt:   dunning.RestrictedAt,
+			ResolvedAt:     dunning.ResolvedAt,
+		}
+	}
+	for _, usageRecord := range usageRecords {
+		export.UsageRecords = append(export.UsageRecords, models.AccountExportUsageRecord{
+			Metric:           usageRecord.Metric,
+			PeriodStart:      usageRecord.PeriodStart,
+			PeriodEnd:        usageRecord.PeriodEnd,
+			Quantity:         usageRecord.Quantity,
+			ReportedQuantity: usageRecord.ReportedQuantity,
+			ReportedAt:       usageRecord.ReportedAt,
+		})
+	}
+	for _, member := range members {
+		export.AccountMembers = append(export.AccountMembers, models.AccountExportAccountMember{
+			AccountId: member.AccountId,
+			UserId:    member.UserId,
+			CreatedAt: member.CreatedAt,
+		})
+	}
+	if hasTrial {
+		export.Trial = &models.AccountExportTrial{
+			Plan:          trial.Plan,
+			StartedAt:     trial.StartedAt,
+			EndsAt:        trial.EndsAt,
+			RemindersSent: trial.RemindersSent,
+			ConvertedAt:   trial.ConvertedAt,
+			ExpiredAt:     trial.ExpiredAt,
+		}
+	}
+
+	as.AuditService.Record(ctx, AuditAccountExported, user.Id, nil)
+	return export, nil
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/Lenstack/lensaas-app/internal/core/entities"
+	"github.com/Lenstack/lensaas-app/internal/core/repositories"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+)
+
+const (
+	ScopeUsersRead  = "users:read"
+	ScopeUsersWrite = "users:write"
+	ScopeAccount    = "account"
+	ScopeAuditRead  = "audit:read"
+
+	AuditApiKeyCreated = "api_key.created"
+	AuditApiKeyRevoked = "api_key.revoked"
+
+	// apiKeyPrefix makes keys recognisable by secret scanners, e.g. lsk_1a2b3c4d_<secret>.
+	apiKeyPrefix = "lsk_"
+	// apiKeyLastUsedInterval limits last-used writes to one per key and interval.
+	apiKeyLastUsedInterval = time.Minute
+)
+
+var ErrInvalidApiKey = errors.New("invalid api key")
+
+// Scopes lists every scope an api key or client can be restricted to.
+var Scopes = []string{ScopeUsersRead, ScopeUsersWrite, ScopeAccount, ScopeAuditRead}
+
+type IApiKeyService interface {
+	CreateApiKey(ctx context.Context, userId string, name string, scopes []string, expiresAt *time.Time) (key string, apiKey entities.ApiKey, err error)
+	ListApiKeys(ctx context.Context, userId string) (apiKeys []entities.ApiKey, err error)
+	RevokeApiKey(ctx context.Context, userId string, apiKeyId string) (message string, err error)
+	Authenticate(ctx context.Context, key string) (apiKey entities.ApiKey, err error)
+}
+
+type ApiKeyService struct {
+	ApiKeyRepository repositories.ApiKeyRepository
+	AuditService     AuditService
+}
+
+func NewApiKeyService(database squirrel.StatementBuilderType, auditService AuditService) *ApiKeyService {
+	return &ApiKeyService{
+		ApiKeyRepository: repositories.ApiKeyRepository{
+			Database: database,
+		},
+		AuditService: auditService,
+	}
+}
+
+// CreateApiKey TODO: 1. Check scopes and expiry, 2. Generate the key and store only its hash, 3. Return the key, it is never shown again
+func (as *ApiKeyService) CreateApiKey(ctx context.Context, userId string, name string, scopes []string, expiresAt *time.Time) (key string, apiKey entities.ApiKey, err error) {
+	ctx, span := tracer.Start(ctx, "ApiKeyService.CreateApiKey")
+	defer span.End()
+
+	for _, scope := range scopes {
+		if !HasScope(Scopes, scope) {
+			return "", entities.ApiKey{}, fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return "", entities.ApiKey{}, errors.New("expiry must be in the future")
+	}
+
+	prefix, err := randomString(4, hex.EncodeToString)
+	if err != nil {
+		return "", entities.ApiKey{}, err
+	}
+	secret, err := randomString(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return "", entities.ApiKey{}, err
+	}
+	key = apiKeyPrefix + prefix + "_" + secret
+
+	apiKey = entities.ApiKey{
+		Id:        uuid.New().String(),
+		UserId:    userId,
+		Name:      name,
+		Prefix:    prefix,
+		Hash:      hashSecret(key),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}
+	if apiKey.Scopes == nil {
+		apiKey.Scopes = []string{}
+	}
+
+	_, err = as.ApiKeyRepository.Create(ctx, apiKey)
+	if err != nil {
+		return "", entities.ApiKey{}, err
+	}
+
+	as.AuditService.Record(ctx, AuditApiKeyCreated, userId, map[string]interface{}{"api_key_id": apiKey.Id, "prefix": prefix, "scopes": apiKey.Scopes})
+	return key, apiKey, nil
+}
+
+// ListApiKeys TODO: 1. Find the api keys of the user, 2. Return api keys
+func (as *ApiKeyService) ListApiKeys(ctx context.Context, userId string) (apiKeys []entities.ApiKey, err error) {
+	ctx, span := tracer.Start(ctx, "ApiKeyService.ListApiKeys")
+	defer span.End()
+
+	return as.ApiKeyRepository.FindByUser(ctx, userId)
+}
+
+// RevokeApiKey TODO: 1. Revoke the api key of the user, 2. Return success message
+func (as *ApiKeyService) RevokeApiKey(ctx context.Context, userId string, apiKeyId string) (message string, err error) {
+	ctx, span := tracer.Start(ctx, "ApiKeyService.RevokeApiKey")
+	defer span.End()
+
+	message, err = as.ApiKeyRepository.Revoke(ctx, userId, apiKeyId)
+	if err != nil {
+		return "", err
+	}
+
+	as.AuditService.Record(ctx, AuditApiKeyRevoked, userId, map[string]interface{}{"api_key_id": apiKeyId})
+	return message, nil
+}
+
+// Authenticate TODO: 1. Find the key by its prefix, 2. Compare hashes in constant time, 3. Reject revoked or expired keys, 4. Track the last use, 5. Return api key
+func (as *ApiKeyService) Authenticate(ctx context.Context, key string) (apiKey entities.ApiKey, err error) {
+	ctx, span := tracer.Start(ctx, "ApiKeyService.Authenticate")
+	defer span.End()
+
+	prefix, _, found := strings.Cut(strings.TrimPrefix(key, apiKeyPrefix), "_")
+	if !strings.HasPrefix(key, apiKeyPrefix) || !found {
+		return entities.ApiKey{}, ErrInvalidApiKey
+	}
+
+	apiKey, err = as.ApiKeyRepository.FindByPrefix(ctx, prefix)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entities.ApiKey{}, ErrInvalidApiKey
+	}
+	if err != nil {
+		return entities.ApiKey{}, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(apiKey.Hash), []byte(hashSecret(key))) != 1 {
+		return entities.ApiKey{}, ErrInvalidApiKey
+	}
+	if apiKey.RevokedAt != nil || (apiKey.ExpiresAt != nil && time.Now().After(*apiKey.ExpiresAt)) {
+		return entities.ApiKey{}, ErrInvalidApiKey
+	}
+
+	if apiKey.LastUsedAt == nil || time.Since(*apiKey.LastUsedAt) > apiKeyLastUsedInterval {
+		_, err = as.ApiKeyRepository.UpdateLastUsedAt(ctx, apiKey.Id, time.Now())
+		if err != nil {
+			utils.Logger(ctx).Warn("api key last use update failed", zap.String("api_key_id", apiKey.Id), zap.Error(err))
+		}
+	}
+	return apiKey, nil
+}
+
+// hashSecret uses a plain SHA-256, api keys and client secrets are random 256 bit values so a slow hash adds nothing.
+func hashSecret(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+func randomString(size int, encode func([]byte) string) (string, error) {
+	buffer := make([]byte, size)
+	_, err := rand.Read(buffer)
+	if err != nil {
+		return "", err
+	}
+	return encode(buffer), nil
+}
+
+// HasScope reports whether scope is one of scopes.
+func HasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,292 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/Lenstack/lensaas-app/internal/core/entities"
+	"github.com/Lenstack/lensaas-app/internal/core/repositories"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	AuditSignInSucceeded        = "user.sign_in_succeeded"
+	AuditSignInFailed           = "user.sign_in_failed"
+	AuditSignedUp               = "user.signed_up"
+	AuditEmailVerified          = "user.email_verified"
+	AuditAccountLocked          = "user.locked"
+	AuditAccountUnlocked        = "user.unlocked"
+	AuditUserUnlocked           = "admin.user_unlocked"
+	AuditTokenRefreshed         = "token.refreshed"
+	AuditTokenRevoked           = "token.revoked"
+	AuditPasswordResetRequested = "password.reset_requested"
+	AuditPasswordReset          = "password.reset"
+	AuditPasswordChanged        = "password.changed"
+	AuditEmailChangeRequested   = "email.change_requested"
+	AuditEmailChanged           = "email.changed"
+	AuditReauthenticated        = "user.reauthenticated"
+	AuditImpersonationStarted   = "user.impersonation_started"
+
+	auditLogPageSize = 1000
+)
+
+type IAuditService interface {
+	Record(ctx context.Context, action string, targetId string, metadata map[string]interface{})
+	Query(ctx context.Context, filter repositories.AuditLogFilter) (auditLogs []entities.AuditLog, nextCursor int64, err error)
+	Verify(ctx context.Context) (verification AuditChainVerification, err error)
+	ExportExpired(ctx context.Context) error
+}
+
+type AuditService struct {
+	AuditLogRepository repositories.AuditLogRepository
+	Retention          time.Duration
+	ExportDirectory    string
+}
+
+// AuditChainVerification is the result of walking the hash chain, BrokenAt is the id of the first entry that does not match.
+type AuditChainVerification struct {
+	Valid    bool
+	Checked  int
+	BrokenAt string
+}
+
+func NewAuditService(database squirrel.StatementBuilderType, db *sql.DB, retention string, exportDirectory string) *AuditService {
+	retentionTime, err := time.ParseDuration(retention)
+	if err != nil {
+		panic(err)
+	}
+	return &AuditService{
+		AuditLogRepository: repositories.AuditLogRepository{
+			Database: database,
+			DB:       db,
+		},
+		Retention:       retentionTime,
+		ExportDirectory: exportDirectory,
+	}
+}
+
+// Record TODO: 1. Take actor, ip, user agent and request id from the context, 2. Append the entry to the hash chain, failures are logged and never block the action
+func (as *AuditService) Record(ctx context.Context, action string, targetId string, metadata map[string]interface{}) {
+	ctx, span := tracer.Start(ctx, "AuditService.Record")
+	defer span.End()
+
+	// Everything done through an impersonation token is attributed to the administrator as well.
+	if actorId := utils.Authentication(ctx).ActorId; actorId != "" {
+		if metadata == nil {
+			metadata = map[string]interface{}{}
+		}
+		metadata["impersonated_by"] = actorId
+	}
+
+	encodedMetadata, err := json.Marshal(metadata)
+	if err != nil || metadata == nil {
+		encodedMetadata = []byte("{}")
+	}
+
+	client := utils.Client(ctx)
+	auditLog := entities.AuditLog{
+		Id:        uuid.New().String(),
+		ActorId:   utils.Principal(ctx).Id,
+		TargetId:  targetId,
+		Action:    action,
+		Ip:        client.Ip,
+		UserAgent: client.UserAgent,
+		RequestId: utils.RequestId(ctx),
+		Metadata:  string(encodedMetadata),
+		// Postgres keeps microseconds, the hash must be computed over the value read back.
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+	_, err = as.AuditLogRepository.Append(ctx, auditLog, func(prevHash string) string {
+		auditLog.PrevHash = prevHash
+		return hashAuditLog(auditLog)
+	})
+	if err != nil {
+		utils.Logger(ctx).Error("audit log write failed", zap.String("action", action), zap.Error(err))
+	}
+}
+
+// Query TODO: 1. Clamp the page size, 2. Find one page of audit logs, 3. Return the cursor of the next page, zero on the last one
+func (as *AuditService) Query(ctx context.Context, filter repositories.AuditLogFilter) (auditLogs []entities.AuditLog, nextCursor int64, err error) {
+	ctx, span := tracer.Start(ctx, "AuditService.Query")
+	defer span.End()
+
+	if filter.Limit == 0 || filter.Limit > 200 {
+		filter.Limit = 50
+	}
+
+	auditLogs, err = as.AuditLogRepository.Find(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	if uint64(len(auditLogs)) == filter.Limit {
+		nextCursor = auditLogs[len(auditLogs)-1].Seq
+	}
+	return auditLogs, nextCursor, nil
+}
+
+// Verify TODO: 1. Walk the chain in order, 2. Recompute every hash and check the link to the previous entry, 3. Return the first broken entry
+func (as *AuditService) Verify(ctx context.Context) (verification AuditChainVerification, err error) {
+	ctx, span := tracer.Start(ctx, "AuditService.Verify")
+	defer span.End()
+
+	verification.Valid = true
+	// The first remaining entry anchors the chain, older ones may have been exported by the retention job.
+	var prevHash string
+	var anchored bool
+	var afterSeq int64
+	for {
+		auditLogs, err := as.AuditLogRepository.FindAfter(ctx, afterSeq, time.Time{}, auditLogPageSize)
+		if err != nil {
+			return AuditChainVerification{}, err
+		}
+		for _, auditLog := range auditLogs {
+			afterSeq = auditLog.Seq
+			if auditLog.Hash == "" {
+				// Written before hash chaining was introduced.
+				continue
+			}
+			verification.Checked++
+			if (anchored && auditLog.PrevHash != prevHash) || hashAuditLog(auditLog) != auditLog.Hash {
+				verification.Valid = false
+				verification.BrokenAt = auditLog.Id
+				return verification, nil
+			}
+			prevHash, anchored = auditLog.Hash, true
+		}
+		if len(auditLogs) < auditLogPageSize {
+			return verification, nil
+		}
+	}
+}
+
+// ExportExpired TODO: 1. Write the entries older than the retention period to a NDJSON file, 2. Delete them once the file is synced
+func (as *AuditService) ExportExpired(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "AuditService.ExportExpired")
+	defer span.End()
+
+	createdBefore := time.Now().Add(-as.Retention)
+	var file *os.File
+	var writer *bufio.Writer
+	var lastSeq int64
+	var exported int
+	for {
+		auditLogs, err := as.AuditLogRepository.FindAfter(ctx, lastSeq, createdBefore, auditLogPageSize)
+		if err != nil {
+			return err
+		}
+		if len(auditLogs) == 0 {
+			break
+		}
+
+		if file == nil {
+			err = os.MkdirAll(as.ExportDirectory, 0o750)
+			if err != nil {
+				return err
+			}
+			name := fmt.Sprintf("audit_logs_%s.ndjson", time.Now().UTC().Format("20060102T150405Z"))
+			file, err = os.OpenFile(filepath.Join(as.ExportDirectory, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			writer = bufio.NewWriter(file)
+		}
+
+		encoder := json.NewEncoder(writer)
+		for _, auditLog := range auditLogs {
+			err = encoder.Encode(auditLogRecord(auditLog))
+			if err != nil {
+				return err
+			}
+			lastSeq = auditLog.Seq
+		}
+		exported += len(auditLogs)
+	}
+	if file == nil {
+		return nil
+	}
+
+	err := writer.Flush()
+	if err != nil {
+		return err
+	}
+	err = file.Sync()
+	if err != nil {
+		return err
+	}
+
+	_, err = as.AuditLogRepository.DeleteUpTo(ctx, lastSeq)
+	if err != nil {
+		return err
+	}
+	utils.Logger(ctx).Info("audit logs exported", zap.String("file", file.Name()), zap.Int("entries", exported))
+	return nil
+}
+
+// auditLogEntry is the serialised form of an entry, shared by the hash and the NDJSON export so exported files can be verified.
+type auditLogEntry struct {
+	Id        string          `json:"id"`
+	Seq       int64           `json:"seq,omitempty"`
+	ActorId   string          `json:"actor_id"`
+	TargetId  string          `json:"target_id"`
+	Action    string          `json:"action"`
+	Ip        string          `json:"ip"`
+	UserAgent string          `json:"user_agent"`
+	RequestId string          `json:"request_id"`
+	Metadata  json.RawMessage `json:"metadata"`
+	PrevHash  string          `json:"prev_hash"`
+	Hash      string          `json:"hash,omitempty"`
+	CreatedAt string          `json:"created_at"`
+}
+
+func auditLogRecord(auditLog entities.AuditLog) auditLogEntry {
+	return auditLogEntry{
+		Id:        auditLog.Id,
+		Seq:       auditLog.Seq,
+		ActorId:   auditLog.ActorId,
+		TargetId:  auditLog.TargetId,
+		Action:    auditLog.Action,
+		Ip:        auditLog.Ip,
+		UserAgent: auditLog.UserAgent,
+		RequestId: auditLog.RequestId,
+		Metadata:  canonicalMetadata(auditLog.Metadata),
+		PrevHash:  auditLog.PrevHash,
+		Hash:      auditLog.Hash,
+		CreatedAt: auditLog.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}
+}
+
+// hashAuditLog is SHA-256 over the entry without seq and hash, linked to the previous entry through prev_hash.
+func hashAuditLog(auditLog entities.AuditLog) string {
+	entry := auditLogRecord(auditLog)
+	entry.Seq, entry.Hash = 0, ""
+	encoded, _ := json.Marshal(entry)
+	hash := sha256.Sum256(encoded)
+	return hex.EncodeToString(hash[:])
+}
+
+// canonicalMetadata re-encodes metadata with sorted keys and no spacing, JSONB does not keep the original text.
+func canonicalMetadata(metadata string) json.RawMessage {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(metadata)))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return json.RawMessage("{}")
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return json.RawMessage("{}")
+	}
+	return encoded
+}
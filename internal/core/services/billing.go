@@ -0,0 +1,201 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Lenstack/lensaas-app/internal/core/billing"
+	"github.com/Lenstack/lensaas-app/internal/core/repositories"
+	"github.com/Masterminds/squirrel"
+	"github.com/redis/go-redis/v9"
+	"strings"
+)
+
+const AuditPaymentRefunded = "payment.refunded"
+
+var (
+	ErrUnknownProvider = errors.New("unknown billing provider")
+	ErrProviderLocked  = errors.New("the billing provider can not be changed once the customer exists")
+)
+
+type IBillingService interface {
+	Provider(name string) (provider billing.Provider, err error)
+	ProviderOf(ctx context.Context, userId string) (provider billing.Provider, err error)
+	CreateCustomer(ctx context.Context, userId string, providerName string) (provider billing.Provider, customerId string, err error)
+	UpdateCustomer(ctx context.Context, userId string) error
+	DeleteCustomer(ctx context.Context, userId string) error
+	Refund(ctx context.Context, providerName string, params billing.RefundParams) (refund billing.Refund, err error)
+}
+
+// BillingService selects the payment provider of every account, the rest of the code only sees billing.Provider.
+type BillingService struct {
+	Providers              map[string]billing.Provider
+	DefaultProvider        string
+	UserRepository         repositories.UserRepository
+	SubscriptionRepository repositories.SubscriptionRepository
+	AuditService           AuditService
+}
+
+// NewBillingService TODO: 1. Index the providers by name, 2. Check the default provider, new customers are created there unless they pick another one
+func NewBillingService(database squirrel.StatementBuilderType, redis *redis.Client, auditService AuditService, defaultProvider string, providers ...billing.Provider) *BillingService {
+	indexed := map[string]billing.Provider{}
+	for _, provider := range providers {
+		indexed[provider.Name()] = provider
+	}
+	if _, ok := indexed[defaultProvider]; !ok {
+		panic("invalid default billing provider " + defaultProvider)
+	}
+	return &BillingService{
+		Providers:       indexed,
+		DefaultProvider: defaultProvider,
+		UserRepository: repositories.UserRepository{
+			Database: database,
+			Redis:    redis,
+		},
+		SubscriptionRepository: repositories.SubscriptionRepository{
+			Database: database,
+		},
+		AuditService: auditService,
+	}
+}
+
+// Provider TODO: 1. Return the configured provider, the default one for an empty name
+func (bs *BillingService) Provider(name string) (provider billing.Provider, err error) {
+	if name == "" {
+		name = bs.DefaultProvider
+	}
+	provider, ok := bs.Providers[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownProvider, name)
+	}
+	return provider, nil
+}
+
+// ProviderOf TODO: 1. Return the provider of the customer of the user, the default one before it exists
+func (bs *BillingService) ProviderOf(ctx context.Context, userId string) (provider billing.Provider, err error) {
+	user, err := bs.UserRepository.FindById(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	return bs.Provider(user.BillingProvider)
+}
+
+// CreateCustomer TODO: 1. Return the existing customer of the user, 2. Create it at the requested or default provider, 3. Persist the provider and the customer id
+func (bs *BillingService) CreateCustomer(ctx context.Context, userId string, providerName string) (provider billing.Provider, customerId string, err error) {
+	ctx, span := tracer.Start(ctx, "BillingService.CreateCustomer")
+	defer span.End()
+
+	user, err := bs.UserRepository.FindById(ctx, userId)
+	if err != nil {
+		return nil, "", err
+	}
+	if user.BillingCustomerId != "" {
+		if providerName != "" && !strings.EqualFold(providerName, user.BillingProvider) {
+			return nil, "", ErrProviderLocked
+		}
+		provider, err = bs.Provider(user.BillingProvider)
+		if err != nil {
+			return nil, "", err
+		}
+		return provider, user.BillingCustomerId, nil
+	}
+	if !user.Verified {
+		return nil, "", errors.New("user is not verified")
+	}
+
+	provider, err = bs.Provider(providerName)
+	if err != nil {
+		return nil, "", err
+	}
+	customerId, err = provider.CreateCustomer(ctx, billing.Customer{UserId: user.Id, Name: user.Name, Email: user.Email})
+	if err != nil {
+		return nil, "", err
+	}
+
+	_, err = bs.UserRepository.UpdateBillingCustomer(ctx, user.Id, provider.Name(), customerId)
+	if err != nil {
+		return nil, "", err
+	}
+	return provider, customerId, nil
+}
+
+// UpdateCustomer TODO: 1. Push the current name and email of the user to its customer, users without customer are skipped
+func (bs *BillingService) UpdateCustomer(ctx context.Context, userId string) error {
+	ctx, span := tracer.Start(ctx, "BillingService.UpdateCustomer")
+	defer span.End()
+
+	user, err := bs.UserRepository.FindById(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if user.BillingCustomerId == "" {
+		return nil
+	}
+	provider, err := bs.Provider(user.BillingProvider)
+	if err != nil {
+		return err
+	}
+	return provider.UpdateCustomer(ctx, user.BillingCustomerId, billing.Customer{UserId: user.Id, Name: user.Name, Email: user.Email})
+}
+
+// DeleteCustomer TODO: 1. Cancel the live subscription, not every provider does it with the customer, 2. Delete the customer, an already deleted one is not an error
+func (bs *BillingService) DeleteCustomer(ctx context.Context, userId string) error {
+	ctx, span := tracer.Start(ctx, "BillingService.DeleteCustomer")
+	defer span.End()
+
+	user, err := bs.UserRepository.FindById(ctx, userId)
+	if err != nil {
+		return err
+	}
+	subscription, err := bs.SubscriptionRepository.FindCurrentByUser(ctx, userId)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if err == nil && subscription.Live() {
+		provider, err := bs.Provider(subscription.Provider)
+		if err != nil {
+			return err
+		}
+		_, err = provider.CancelSubscription(ctx, subscription.Id, true)
+		if err != nil && !errors.Is(err, billing.ErrNotFound) {
+			return err
+		}
+	}
+	if user.BillingCustomerId == "" {
+		return nil
+	}
+
+	provider, err := bs.Provider(user.BillingProvider)
+	if err != nil {
+		return err
+	}
+	err = provider.DeleteCustomer(ctx, user.BillingCustomerId)
+	if errors.Is(err, billing.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// Refund TODO: 1. Refund the payment at the provider, 2. Audit it
+func (bs *BillingService) Refund(ctx context.Context, providerName string, params billing.RefundParams) (refund billing.Refund, err error) {
+	ctx, span := tracer.Start(ctx, "BillingService.Refund")
+	defer span.End()
+
+	provider, err := bs.Provider(providerName)
+	if err != nil {
+		return billing.Refund{}, err
+	}
+	refund, err = provider.Refund(ctx, params)
+	if err != nil {
+		return billing.Refund{}, err
+	}
+	bs.AuditService.Record(ctx, AuditPaymentRefunded, params.PaymentId, map[string]interface{}{
+		"provider":  provider.Name(),
+		"refund_id": refund.Id,
+		"amount":    refund.Amount,
+		"currency":  refund.Currency,
+		"reason":    params.Reason,
+	})
+	return refund, nil
+}
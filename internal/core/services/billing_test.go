@@ -0,0 +1,38 @@
+package services
+
+import (
+	"context"
+	"github.com/Lenstack/lensaas-app/internal/core/billing"
+	"testing"
+)
+
+func TestRefund(t *testing.T) {
+	f := newFixture(t)
+
+	f.expectAudit(AuditPaymentRefunded, "pi_1")
+
+	refund, err := f.BillingService.Refund(context.Background(), billing.ProviderFake, billing.RefundParams{
+		PaymentId: "pi_1", Amount: 1500, Currency: "usd", Reason: "requested_by_customer",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refund.Id == "" || refund.PaymentId != "pi_1" || refund.Amount != 1500 || refund.Currency != "usd" {
+		t.Errorf("unexpected refund %+v", refund)
+	}
+	if len(f.Provider.Refunds) != 1 || f.Provider.Refunds[0].Id != refund.Id {
+		t.Errorf("provider refunds = %+v, want the refund", f.Provider.Refunds)
+	}
+}
+
+func TestRefundUnknownProvider(t *testing.T) {
+	f := newFixture(t)
+
+	_, err := f.BillingService.Refund(context.Background(), "unknown", billing.RefundParams{PaymentId: "pi_1", Amount: 1500})
+	if err == nil {
+		t.Fatal("refunding at an unknown provider succeeded")
+	}
+	if len(f.Provider.Refunds) != 0 {
+		t.Errorf("provider refunds = %+v, want none", f.Provider.Refunds)
+	}
+}
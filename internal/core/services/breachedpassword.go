@@ -0,0 +1,98 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// IBreachedPasswordChecker reports whether a password is part of a known breach corpus.
+// Implementations only ever see the first five characters of the SHA-1 hash (k-anonymity).
+type IBreachedPasswordChecker interface {
+	Breached(ctx context.Context, password string) (bool, error)
+}
+
+// NewBreachedPasswordChecker TODO: 1. Select the checker by name (local, range or none)
+func NewBreachedPasswordChecker(checker string, dataset string, rangeUrl string) IBreachedPasswordChecker {
+	switch checker {
+	case "local":
+		return &LocalBreachedPasswordChecker{Directory: dataset}
+	case "range":
+		return &RangeBreachedPasswordChecker{BaseUrl: rangeUrl, Client: &http.Client{Timeout: 5 * time.Second}}
+	default:
+		return nil
+	}
+}
+
+// LocalBreachedPasswordChecker reads range files named <PREFIX>.txt containing SUFFIX:COUNT lines,
+// the same layout produced by the HIBP downloader, so the check works offline.
+type LocalBreachedPasswordChecker struct {
+	Directory string
+}
+
+func (lc *LocalBreachedPasswordChecker) Breached(ctx context.Context, password string) (bool, error) {
+	prefix, suffix := hashPrefixSuffix(password)
+	file, err := os.Open(filepath.Join(lc.Directory, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	return rangeContains(file, suffix)
+}
+
+// RangeBreachedPasswordChecker queries an HIBP compatible range API, e.g. https://api.pwnedpasswords.com/range/
+type RangeBreachedPasswordChecker struct {
+	BaseUrl string
+	Client  *http.Client
+}
+
+func (rc *RangeBreachedPasswordChecker) Breached(ctx context.Context, password string) (bool, error) {
+	prefix, suffix := hashPrefixSuffix(password)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(rc.BaseUrl, "/")+"/"+prefix, nil)
+	if err != nil {
+		return false, err
+	}
+	// Padding hides the real size of the response from anyone watching the traffic.
+	req.Header.Set("Add-Padding", "true")
+
+	res, err := rc.Client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("range api returned status %d", res.StatusCode)
+	}
+	return rangeContains(res.Body, suffix)
+}
+
+func hashPrefixSuffix(password string) (prefix string, suffix string) {
+	hash := sha1.Sum([]byte(password))
+	encoded := strings.ToUpper(hex.EncodeToString(hash[:]))
+	return encoded[:5], encoded[5:]
+}
+
+// rangeContains scans SUFFIX:COUNT lines; padded entries have a count of zero and are ignored.
+func rangeContains(reader io.Reader, suffix string) (bool, error) {
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		lineSuffix, count, found := strings.Cut(line, ":")
+		if found && strings.EqualFold(lineSuffix, suffix) && count != "0" {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
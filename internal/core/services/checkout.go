@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Lenstack/lensaas-app/internal/core/billing"
+	"github.com/Lenstack/lensaas-app/internal/core/entities"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"strconv"
+)
+
+const AuditCheckoutStarted = "checkout.started"
+
+var (
+	ErrInvalidPromotionCode    = billing.ErrInvalidPromotionCode
+	ErrCheckoutSessionNotFound = errors.New("checkout session not found")
+)
+
+type ICheckoutService interface {
+	CreateCheckoutSession(ctx context.Context, userId string, priceId string, promotionCode string) (sessionId string, url string, err error)
+	CreatePortalSession(ctx context.Context, userId string) (url string, err error)
+	ReconcileCheckout(ctx context.Context, userId string, sessionId string) (reconciliation CheckoutReconciliation, err error)
+}
+
+type CheckoutService struct {
+	SubscriptionService SubscriptionService
+	AuditService        AuditService
+	SuccessUrl          string
+	CancelUrl           string
+	PortalReturnUrl     string
+	TrialDays           int64
+}
+
+// CheckoutReconciliation is the state of a checkout session as the provider reports it, Subscription is the mirror once it completed.
+type CheckoutReconciliation struct {
+	Status        string
+	PaymentStatus string
+	Subscription  *entities.Subscription
+}
+
+// NewCheckoutService TODO: 1. Parse the trial days, providers add the session id to the success url for the reconciliation
+func NewCheckoutService(subscriptionService SubscriptionService, auditService AuditService, successUrl string, cancelUrl string, portalReturnUrl string, trialDays string) (*CheckoutService, error) {
+	days, err := strconv.ParseInt(trialDays, 10, 64)
+	if err != nil || days < 0 {
+		return nil, fmt.Errorf("invalid checkout trial days %q", trialDays)
+	}
+	return &CheckoutService{
+		SubscriptionService: subscriptionService,
+		AuditService:        auditService,
+		SuccessUrl:          successUrl,
+		CancelUrl:           cancelUrl,
+		PortalReturnUrl:     portalReturnUrl,
+		TrialDays:           days,
+	}, nil
+}
+
+// CreateCheckoutSession TODO: 1. Check the price and the live subscription, 2. Grant the trial to users who never subscribed nor had a trial, 3. Apply the promotion code or let the user enter one, 4. Return the hosted checkout url
+func (cs *CheckoutService) CreateCheckoutSession(ctx context.Context, userId string, priceId string, promotionCode string) (sessionId string, url string, err error) {
+	ctx, span := tracer.Start(ctx, "CheckoutService.CreateCheckoutSession")
+	defer span.End()
+
+	if _, ok := cs.SubscriptionService.EntitlementService.PlanByPrice(priceId); !ok {
+		return "", "", ErrUnknownPrice
+	}
+	provider, customerId, err := cs.SubscriptionService.BillingService.CreateCustomer(ctx, userId, "")
+	if err != nil {
+		return "", "", err
+	}
+	current, err := cs.SubscriptionService.GetSubscription(ctx, userId)
+	if err == nil && current.Live() {
+		return "", "", ErrSubscriptionExists
+	}
+	if err != nil && !errors.Is(err, ErrSubscriptionNotFound) {
+		return "", "", err
+	}
+	firstSubscription := errors.Is(err, ErrSubscriptionNotFound)
+	if firstSubscription {
+		// Users converting a trial without a payment method already had theirs.
+		_, err = cs.SubscriptionService.TrialRepository.FindByUser(ctx, userId)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return "", "", err
+		}
+		firstSubscription = errors.Is(err, sql.ErrNoRows)
+	}
+
+	params := billing.CheckoutParams{
+		UserId:         userId,
+		CustomerId:     customerId,
+		PriceId:        priceId,
+		MeteredPriceId: cs.SubscriptionService.MeteredPriceId,
+		PromotionCode:  promotionCode,
+		SuccessUrl:     cs.SuccessUrl,
+		CancelUrl:      cs.CancelUrl,
+	}
+	// Trials are for first subscriptions only.
+	if cs.TrialDays > 0 && firstSubscription {
+		params.TrialDays = cs.TrialDays
+	}
+	if requestId := utils.RequestId(ctx); requestId != "" {
+		params.IdempotencyKey = "checkout-create-" + userId + "-" + requestId
+	}
+
+	session, err := provider.CreateCheckoutSession(ctx, params)
+	if err != nil {
+		return "", "", err
+	}
+	cs.AuditService.Record(ctx, AuditCheckoutStarted, userId, map[string]interface{}{
+		"provider":   provider.Name(),
+		"session_id": session.Id,
+		"price_id":   priceId,
+	})
+	return session.Id, session.Url, nil
+}
+
+// CreatePortalSession TODO: 1. Create the customer if needed, 2. Return the customer portal url for cards, invoices and cancellation
+func (cs *CheckoutService) CreatePortalSession(ctx context.Context, userId string) (url string, err error) {
+	ctx, span := tracer.Start(ctx, "CheckoutService.CreatePortalSession")
+	defer span.End()
+
+	provider, customerId, err := cs.SubscriptionService.BillingService.CreateCustomer(ctx, userId, "")
+	if err != nil {
+		return "", err
+	}
+	return provider.CreatePortalSession(ctx, customerId, cs.PortalReturnUrl)
+}
+
+// ReconcileCheckout TODO: 1. Fetch the session from the provider, the redirect itself proves nothing, 2. Check it belongs to the user, 3. Refresh the subscription exactly as the webhook does once it completed
+func (cs *CheckoutService) ReconcileCheckout(ctx context.Context, userId string, sessionId string) (reconciliation CheckoutReconciliation, err error) {
+	ctx, span := tracer.Start(ctx, "CheckoutService.ReconcileCheckout")
+	defer span.End()
+
+	provider, err := cs.SubscriptionService.BillingService.ProviderOf(ctx, userId)
+	if err != nil {
+		return CheckoutReconciliation{}, err
+	}
+	session, err := provider.GetCheckoutSession(ctx, sessionId)
+	if err != nil && !errors.Is(err, billing.ErrNotFound) {
+		return CheckoutReconciliation{}, err
+	}
+	if err != nil || session.UserId != userId {
+		return CheckoutReconciliation{}, ErrCheckoutSessionNotFound
+	}
+
+	reconciliation = CheckoutReconciliation{Status: session.Status, PaymentStatus: session.PaymentStatus}
+	if session.Status != billing.CheckoutComplete || session.SubscriptionId == "" {
+		return reconciliation, nil
+	}
+
+	subscription, err := cs.SubscriptionService.RefreshSubscription(ctx, provider.Name(), session.SubscriptionId)
+	if err != nil {
+		return CheckoutReconciliation{}, err
+	}
+	reconciliation.Subscription = &subscription
+	return reconciliation, nil
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/Lenstack/lensaas-app/internal/core/billing"
+	"github.com/Lenstack/lensaas-app/internal/core/entities"
+	"testing"
+)
+
+// checkoutSession opens a checkout session of the user at the fake provider, the fake completes it once read.
+func checkoutSession(t *testing.T, f *fixture, userId string, customerId string) billing.CheckoutSession {
+	t.Helper()
+	session, err := f.Provider.CreateCheckoutSession(context.Background(), billing.CheckoutParams{
+		UserId: userId, CustomerId: customerId, PriceId: testProPrice, SuccessUrl: "https://app.test/success",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return session
+}
+
+func TestReconcileCheckout(t *testing.T) {
+	f := newFixture(t)
+	user := verifiedCustomer(t, f)
+	session := checkoutSession(t, f, testUserId, user.BillingCustomerId)
+	f.cacheEntitlements(t, testUserId)
+
+	f.expectUser(user)
+	f.expectSync(session.SubscriptionId, testProPrice, entities.SubscriptionActive, false)
+
+	reconciliation, err := f.CheckoutService.ReconcileCheckout(context.Background(), testUserId, session.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reconciliation.Status != billing.CheckoutComplete || reconciliation.PaymentStatus != "paid" {
+		t.Errorf("unexpected reconciliation %+v", reconciliation)
+	}
+	if reconciliation.Subscription == nil || reconciliation.Subscription.Id != session.SubscriptionId {
+		t.Fatalf("reconciliation subscription = %+v, want %s", reconciliation.Subscription, session.SubscriptionId)
+	}
+	if reconciliation.Subscription.UserId != testUserId || reconciliation.Subscription.PriceId != testProPrice {
+		t.Errorf("unexpected subscription %+v", reconciliation.Subscription)
+	}
+	f.assertEntitlementsInvalidated(t, testUserId)
+}
+
+func TestReconcileCheckoutOfAnotherUser(t *testing.T) {
+	f := newFixture(t)
+	user := verifiedCustomer(t, f)
+	session := checkoutSession(t, f, "another-user", "cus_another")
+
+	f.expectUser(user)
+
+	_, err := f.CheckoutService.ReconcileCheckout(context.Background(), testUserId, session.Id)
+	if !errors.Is(err, ErrCheckoutSessionNotFound) {
+		t.Fatalf("err = %v, want %v", err, ErrCheckoutSessionNotFound)
+	}
+}
+
+func TestReconcileCheckoutUnknownSession(t *testing.T) {
+	f := newFixture(t)
+	user := verifiedCustomer(t, f)
+
+	f.expectUser(user)
+
+	_, err := f.CheckoutService.ReconcileCheckout(context.Background(), testUserId, "cs_unknown")
+	if !errors.Is(err, ErrCheckoutSessionNotFound) {
+		t.Fatalf("err = %v, want %v", err, ErrCheckoutSessionNotFound)
+	}
+}
@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Lenstack/lensaas-app/internal/core/entities"
+	"github.com/Lenstack/lensaas-app/internal/core/repositories"
+	"github.com/Lenstack/lensaas-app/internal/templates"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"github.com/Masterminds/squirrel"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"sort"
+	"time"
+)
+
+const (
+	AuditPaymentFailed     = "payment.failed"
+	AuditPaymentRecovered  = "payment.recovered"
+	AuditAccountRestricted = "billing.restricted"
+
+	BillingStatusOk         = "ok"
+	BillingStatusGrace      = entities.DunningGrace
+	BillingStatusRestricted = entities.DunningRestricted
+
+	dunningBatchSize = 500
+)
+
+// BillingStatus is the billing state of an account, the dunning fields are set while a failed payment is open.
+type BillingStatus struct {
+	Status             string
+	Plan               string
+	SubscriptionStatus string
+	ReadOnly           bool
+	PaymentFailedAt    *time.Time
+	GraceEndsAt        *time.Time
+	RestrictedAt       *time.Time
+	RemindersSent      int
+}
+
+type IDunningService interface {
+	PaymentFailed(ctx context.Context, subscription entities.Subscription, failedAt time.Time) error
+	PaymentSucceeded(ctx context.Context, subscription entities.Subscription, paidAt time.Time) error
+	ProcessDue(ctx context.Context) error
+	Status(ctx context.Context, userId string) (status BillingStatus, err error)
+}
+
+type DunningService struct {
+	DunningRepository      repositories.DunningRepository
+	SubscriptionRepository repositories.SubscriptionRepository
+	UserRepository         repositories.UserRepository
+	EmailService           EmailService
+	EntitlementService     EntitlementService
+	AuditService           AuditService
+	GracePeriod            time.Duration
+	// Reminders are the offsets after the failure at which a reminder is sent, while the grace period runs.
+	Reminders []time.Duration
+}
+
+// NewDunningService TODO: 1. Parse the grace period, 2. Parse the reminder offsets (e.g. 0s,72h,144h) in order
+func NewDunningService(database squirrel.StatementBuilderType, redis *redis.Client, emailService EmailService, entitlementService EntitlementService, auditService AuditService, gracePeriod string, reminders string) (*DunningService, error) {
+	grace, err := time.ParseDuration(gracePeriod)
+	if err != nil {
+		return nil, err
+	}
+	offsets, err := parseReminders(reminders)
+	if err != nil {
+		return nil, fmt.Errorf("dunning: %w", err)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+
+	return &DunningService{
+		DunningRepository: repositories.DunningRepository{
+			Database: database,
+		},
+		SubscriptionRepository: repositories.SubscriptionRepository{
+			Database: database,
+		},
+		UserRepository: repositories.UserRepository{
+			Database: database,
+			Redis:    redis,
+		},
+		EmailService:       emailService,
+		EntitlementService: entitlementService,
+		AuditService:       auditService,
+		GracePeriod:        grace,
+		Reminders:          offsets,
+	}, nil
+}
+
+// PaymentFailed TODO: 1. Ignore first payments, the subscription never started, and failures the subscription recovered from, 2. Open the case with the grace period, a case already open keeps running, 3. Send the due reminders
+func (ds *DunningService) PaymentFailed(ctx context.Context, subscription entities.Subscription, failedAt time.Time) error {
+	ctx, span := tracer.Start(ctx, "DunningService.PaymentFailed")
+	defer span.End()
+
+	// The subscription is refreshed from the provider, a failure delivered after the payment finds it active again.
+	if subscription.Status != entities.SubscriptionPastDue && subscription.Status != entities.SubscriptionUnpaid {
+		return nil
+	}
+
+	now := time.Now()
+	dunning := entities.Dunning{
+		UserId:         subscription.UserId,
+		Provider:       subscription.Provider,
+		SubscriptionId: subscription.Id,
+		Status:         entities.DunningGrace,
+		FailedAt:       failedAt,
+		GraceEndsAt:    failedAt.Add(ds.GracePeriod),
+		UpdatedAt:      now,
+	}
+	opened, err := ds.DunningRepository.Open(ctx, dunning)
+	if err != nil {
+		return err
+	}
+	if !opened {
+		return nil
+	}
+	ds.AuditService.Record(ctx, AuditPaymentFailed, subscription.UserId, map[string]interface{}{
+		"subscription_id": subscription.Id,
+		"grace_ends_at":   dunning.GraceEndsAt,
+	})
+	return ds.process(ctx, dunning, now)
+}
+
+// PaymentSucceeded TODO: 1. Close the open case when the payment came after the failure, 2. Restore the entitlements
+func (ds *DunningService) PaymentSucceeded(ctx context.Context, subscription entities.Subscription, paidAt time.Time) error {
+	ctx, span := tracer.Start(ctx, "DunningService.PaymentSucceeded")
+	defer span.End()
+
+	resolved, err := ds.DunningRepository.Resolve(ctx, subscription.UserId, paidAt)
+	if err != nil || !resolved {
+		return err
+	}
+	err = ds.EntitlementService.Invalidate(ctx, subscription.UserId)
+	if err != nil {
+		return err
+	}
+	ds.AuditService.Record(ctx, AuditPaymentRecovered, subscription.UserId, map[string]interface{}{
+		"subscription_id": subscription.Id,
+	})
+	return nil
+}
+
+// ProcessDue TODO: 1. Find the cases in grace, 2. Send the reminders that came due, 3. Restrict the accounts whose grace period ended
+func (ds *DunningService) ProcessDue(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "DunningService.ProcessDue")
+	defer span.End()
+
+	dunnings, err := ds.DunningRepository.FindInGrace(ctx, dunningBatchSize)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, dunning := range dunnings {
+		if err := ds.process(ctx, dunning, now); err != nil {
+			utils.Logger(ctx).Warn("dunning will be retried", zap.String("user_id", dunning.UserId), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// Status TODO: 1. Read the entitlements and the subscription, 2. Add the open failed payment case, 3. Return the billing status
+func (ds *DunningService) Status(ctx context.Context, userId string) (status BillingStatus, err error) {
+	ctx, span := tracer.Start(ctx, "DunningService.Status")
+	defer span.End()
+
+	entitlements, err := ds.EntitlementService.Entitlements(ctx, userId)
+	if err != nil {
+		return BillingStatus{}, err
+	}
+	status = BillingStatus{Status: BillingStatusOk, Plan: entitlements.Plan, ReadOnly: entitlements.ReadOnly}
+
+	subscription, err := ds.SubscriptionRepository.FindCurrentByUser(ctx, userId)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return BillingStatus{}, err
+	}
+	if err == nil {
+		status.SubscriptionStatus = subscription.Status
+	}
+
+	dunning, err := ds.DunningRepository.FindByUser(ctx, userId)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return BillingStatus{}, err
+	}
+	if err == nil && dunning.Open() {
+		status.Status = dunning.Status
+		status.PaymentFailedAt = &dunning.FailedAt
+		status.GraceEndsAt = &dunning.GraceEndsAt
+		status.RestrictedAt = dunning.RestrictedAt
+		status.RemindersSent = dunning.RemindersSent
+	}
+	return status, nil
+}
+
+// process sends the latest reminder that came due during the grace period, then restricts the account once it ended.
+func (ds *DunningService) process(ctx context.Context, dunning entities.Dunning, now time.Time) error {
+	if dunning.Status == entities.DunningGrace && now.Before(dunning.GraceEndsAt) {
+		due := remindersDue(ds.Reminders, now, dunning.FailedAt.Add)
+		return remind(dunning.RemindersSent, due, dunning.LastReminderAt, now,
+			func(previous int, remindersSent int, remindedAt *time.Time) (bool, error) {
+				return ds.DunningRepository.UpdateRemindersSent(ctx, dunning.UserId, previous, remindersSent, remindedAt)
+			},
+			func() error {
+				return notify(ctx, ds.UserRepository, ds.EmailService, dunning.UserId, "internal/templates/payment_failed_template.html", "Your Payment Failed",
+					func(name string) interface{} {
+						return templates.PaymentReminder{Name: name, GraceEndsAt: dunning.GraceEndsAt.Format("January 2, 2006")}
+					})
+			})
+	}
+	if dunning.Status != entities.DunningGrace {
+		return nil
+	}
+
+	restricted, err := ds.DunningRepository.Restrict(ctx, dunning.UserId, now)
+	if err != nil || !restricted {
+		return err
+	}
+	err = ds.EntitlementService.Invalidate(ctx, dunning.UserId)
+	if err != nil {
+		return err
+	}
+	ds.AuditService.Record(ctx, AuditAccountRestricted, dunning.UserId, map[string]interface{}{
+		"subscription_id": dunning.SubscriptionId,
+	})
+	return notify(ctx, ds.UserRepository, ds.EmailService, dunning.UserId, "internal/templates/account_restricted_template.html", "Your Account Is Read-Only",
+		func(name string) interface{} {
+			return templates.AccountRestricted{Name: name}
+		})
+}
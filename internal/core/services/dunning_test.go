@@ -0,0 +1,53 @@
+package services
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Lenstack/lensaas-app/internal/core/entities"
+	"testing"
+	"time"
+)
+
+func graceDunning(now time.Time) entities.Dunning {
+	return entities.Dunning{UserId: testUserId, Provider: "fake", SubscriptionId: "sub_fake_2", Status: entities.DunningGrace,
+		FailedAt: now.Add(-time.Hour), GraceEndsAt: now.Add(167 * time.Hour), UpdatedAt: now}
+}
+
+// expectReminderCount expects the reminders to move from previous to remindersSent, counted tells whether the row matched.
+func (f *fixture) expectReminderCount(previous int, remindersSent int, remindedAt interface{}, counted bool) {
+	var rows int64
+	if counted {
+		rows = 1
+	}
+	f.Database.ExpectExec(query("UPDATE dunning SET RemindersSent = $1, LastReminderAt = $2, UpdatedAt = $3")).
+		WithArgs(remindersSent, remindedAt, sqlmock.AnyArg(), previous, entities.DunningGrace, entities.DunningRestricted, testUserId).
+		WillReturnResult(sqlmock.NewResult(0, rows))
+}
+
+func TestProcessDunningSkipsReminderCountedElsewhere(t *testing.T) {
+	f := newFixture(t)
+	now := time.Now()
+
+	f.expectReminderCount(0, 1, sqlmock.AnyArg(), false)
+
+	err := f.DunningService.process(context.Background(), graceDunning(now), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProcessDunningGivesBackReminderWhoseEmailFailed(t *testing.T) {
+	f := newFixture(t)
+	now := time.Now()
+	user := entities.User{Id: testUserId, Name: "ada", Email: "ada@example.com", Verified: true, Role: entities.RoleUser,
+		CreatedAt: now, UpdatedAt: now}
+
+	f.expectReminderCount(0, 1, sqlmock.AnyArg(), true)
+	f.expectUser(user)
+	f.expectReminderCount(1, 0, nil, true)
+
+	err := f.DunningService.process(context.Background(), graceDunning(now), now)
+	if err == nil {
+		t.Fatal("the failed email was not reported")
+	}
+}
@@ -2,15 +2,20 @@ package services
 
 import (
 	"bytes"
-	"fmt"
+	"context"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
 	"gopkg.in/gomail.v2"
 	"html/template"
 	"strconv"
+	"strings"
 )
 
 type IEmailService interface {
 	Create(templateUrl string, to []string, subject string, body interface{}, attachments []string) (message *gomail.Message, err error)
-	Send(mail *gomail.Message) error
+	Send(ctx context.Context, mail *gomail.Message) error
+	Deliver(ctx context.Context, mail *gomail.Message) error
 }
 
 type EmailService struct {
@@ -18,11 +23,12 @@ type EmailService struct {
 	Port     int
 	Email    string
 	Password string
+	Metrics  MetricsService
 }
 
-func NewEmailService(host string, port string, email string, password string) *EmailService {
+func NewEmailService(host string, port string, email string, password string, metricsService MetricsService) *EmailService {
 	portInt, _ := strconv.Atoi(port)
-	return &EmailService{Host: host, Port: portInt, Email: email, Password: password}
+	return &EmailService{Host: host, Port: portInt, Email: email, Password: password, Metrics: metricsService}
 }
 
 func (es *EmailService) Create(templateUrl string, to []string, subject string, body interface{}, attachments []string) (message *gomail.Message, err error) {
@@ -54,14 +60,35 @@ func (es *EmailService) Create(templateUrl string, to []string, subject string,
 	return mail, nil
 }
 
-func (es *EmailService) Send(mail *gomail.Message) error {
-	dialer := gomail.NewDialer(es.Host, es.Port, es.Email, es.Password)
-	errChan := make(chan error)
+// Send delivers the email in the background, failures are logged and never reach the caller.
+func (es *EmailService) Send(ctx context.Context, mail *gomail.Message) error {
+	_, span := tracer.Start(ctx, "EmailService.Send")
+	logger := utils.Logger(ctx)
 	go func() {
-		if err := dialer.DialAndSend(mail); err != nil {
-			fmt.Println("Error sending email: ", err)
-			errChan <- err
-		}
+		defer span.End()
+		_ = es.deliver(logger, span, mail)
 	}()
 	return nil
 }
+
+// Deliver delivers the email and returns the failure, scheduled jobs send their emails this way to retry them.
+func (es *EmailService) Deliver(ctx context.Context, mail *gomail.Message) error {
+	_, span := tracer.Start(ctx, "EmailService.Deliver")
+	defer span.End()
+	return es.deliver(utils.Logger(ctx), span, mail)
+}
+
+func (es *EmailService) deliver(logger *zap.Logger, span trace.Span, mail *gomail.Message) error {
+	logger = logger.With(zap.String("to", strings.Join(mail.GetHeader("To"), ",")),
+		zap.Strings("subject", mail.GetHeader("Subject")))
+	dialer := gomail.NewDialer(es.Host, es.Port, es.Email, es.Password)
+	if err := dialer.DialAndSend(mail); err != nil {
+		logger.Error("email delivery failed", zap.Error(err))
+		span.RecordError(err)
+		es.Metrics.IncEmail("failure")
+		return err
+	}
+	logger.Debug("email delivered")
+	es.Metrics.IncEmail("success")
+	return nil
+}
@@ -0,0 +1,339 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Lenstack/lensaas-app/internal/core/entities"
+	"github.com/Lenstack/lensaas-app/internal/core/repositories"
+	"github.com/Masterminds/squirrel"
+	"github.com/redis/go-redis/v9"
+	"strings"
+	"time"
+)
+
+const (
+	PlanFree       = "free"
+	PlanPro        = "pro"
+	PlanEnterprise = "enterprise"
+
+	FeatureApiKeys         = "api_keys"
+	FeaturePrioritySupport = "priority_support"
+
+	LimitSeats    = "seats"
+	LimitApiCalls = "api_calls"
+
+	// Unlimited is the value of a limit the plan does not cap.
+	Unlimited int64 = -1
+)
+
+// Plan maps billing provider prices to the features and limits they grant.
+type Plan struct {
+	Name     string
+	PriceIds []string
+	Features []string
+	Limits   map[string]int64
+}
+
+// Plans is the catalog, from the cheapest plan to the most expensive one. Prices are configured with PLAN_PRICES.
+var Plans = []Plan{
+	{
+		Name:     PlanFree,
+		Features: []string{},
+		Limits:   map[string]int64{LimitSeats: 1, LimitApiCalls: 1000},
+	},
+	{
+		Name:     PlanPro,
+		Features: []string{FeatureApiKeys},
+		Limits:   map[string]int64{LimitSeats: 10, LimitApiCalls: 100000},
+	},
+	{
+		Name:     PlanEnterprise,
+		Features: []string{FeatureApiKeys, FeaturePrioritySupport},
+		Limits:   map[string]int64{LimitSeats: Unlimited, LimitApiCalls: Unlimited},
+	},
+}
+
+// Entitlements is what the current plan of a user grants, it is cached in redis. Read-only accounts keep their limits
+// but no feature until the failed payment is settled. TrialEndsAt is set while the plan is granted by a trial.
+type Entitlements struct {
+	Plan        string
+	Features    []string
+	Limits      map[string]int64
+	ReadOnly    bool
+	TrialEndsAt *time.Time
+}
+
+// EntitlementError is returned when the plan lacks a feature or a limit is reached, UpgradePlan is the cheapest plan granting it.
+type EntitlementError struct {
+	Plan        string
+	Feature     string
+	Limit       string
+	UpgradePlan string
+	ReadOnly    bool
+}
+
+func (e *EntitlementError) Error() string {
+	if e.ReadOnly {
+		return "the account is read-only until the failed payment is settled"
+	}
+	if e.Limit != "" {
+		return fmt.Sprintf("the %s plan limit of %s is reached", e.Plan, e.Limit)
+	}
+	return fmt.Sprintf("the %s plan does not include %s", e.Plan, e.Feature)
+}
+
+type IEntitlementService interface {
+	Entitlements(ctx context.Context, userId string) (entitlements Entitlements, err error)
+	Can(ctx context.Context, userId string, feature string) (allowed bool, err error)
+	Limit(ctx context.Context, userId string, limit string) (value int64, err error)
+	RequireFeature(ctx context.Context, userId string, feature string) error
+	RequireLimit(ctx context.Context, userId string, limit string, used int64) error
+	RequireWritable(ctx context.Context, userId string) error
+	Invalidate(ctx context.Context, userId string) error
+	PlanByPrice(priceId string) (plan Plan, ok bool)
+}
+
+type EntitlementService struct {
+	SubscriptionRepository repositories.SubscriptionRepository
+	DunningRepository      repositories.DunningRepository
+	TrialRepository        repositories.TrialRepository
+	Redis                  *redis.Client
+	Catalog                []Plan
+	CacheTTL               time.Duration
+}
+
+// NewEntitlementService TODO: 1. Attach the prices (plan:price+price,...) to the catalog, 2. Parse the cache ttl
+func NewEntitlementService(database squirrel.StatementBuilderType, redis *redis.Client, prices string, cacheTTL string) (*EntitlementService, error) {
+	catalog, err := ParsePlanPrices(prices)
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := time.ParseDuration(cacheTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &EntitlementService{
+		SubscriptionRepository: repositories.SubscriptionRepository{
+			Database: database,
+		},
+		DunningRepository: repositories.DunningRepository{
+			Database: database,
+		},
+		TrialRepository: repositories.TrialRepository{
+			Database: database,
+		},
+		Redis:    redis,
+		Catalog:  catalog,
+		CacheTTL: ttl,
+	}, nil
+}
+
+// ParsePlanPrices TODO: 1. Parse entries like "pro:price_monthly+price_yearly" separated by commas, 2. Return a copy of the catalog with the prices
+func ParsePlanPrices(prices string) ([]Plan, error) {
+	catalog := make([]Plan, len(Plans))
+	copy(catalog, Plans)
+
+	for _, entry := range strings.Split(prices, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.Split(entry, ":")
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("invalid plan prices %q", entry)
+		}
+		found := false
+		for i := range catalog {
+			if catalog[i].Name == parts[0] {
+				catalog[i].PriceIds = append([]string{}, strings.Split(parts[1], "+")...)
+				found = true
+			}
+		}
+		if !found || parts[0] == PlanFree {
+			return nil, fmt.Errorf("invalid plan %q in plan prices", parts[0])
+		}
+	}
+	return catalog, nil
+}
+
+// Entitlements TODO: 1. Read the cached entitlements, 2. Otherwise derive them from the mirrored subscription, or the running trial, free without one, 3. Drop the features of a subscription restricted for a failed payment, 4. Cache them
+func (es *EntitlementService) Entitlements(ctx context.Context, userId string) (entitlements Entitlements, err error) {
+	ctx, span := tracer.Start(ctx, "EntitlementService.Entitlements")
+	defer span.End()
+
+	key := fmt.Sprintf("entitlements:%s", userId)
+	cached, err := es.Redis.Get(ctx, key).Bytes()
+	if err == nil && json.Unmarshal(cached, &entitlements) == nil {
+		return entitlements, nil
+	}
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return Entitlements{}, err
+	}
+
+	plan := es.Catalog[0]
+	subscription, err := es.SubscriptionRepository.FindCurrentByUser(ctx, userId)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return Entitlements{}, err
+	}
+	current := err == nil
+	subscribed := false
+	if current && grantsPlan(subscription) {
+		plan, subscribed = es.PlanByPrice(subscription.PriceId)
+		if !subscribed {
+			plan = es.Catalog[0]
+		}
+	}
+
+	var trialEndsAt *time.Time
+	if !subscribed {
+		trial, err := es.TrialRepository.FindByUser(ctx, userId)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return Entitlements{}, err
+		}
+		if err == nil && trial.Running(time.Now()) {
+			for _, catalogPlan := range es.Catalog {
+				if catalogPlan.Name == trial.Plan {
+					plan = catalogPlan
+					trialEndsAt = &trial.EndsAt
+				}
+			}
+		}
+	}
+
+	entitlements = Entitlements{Plan: plan.Name, Features: plan.Features, Limits: plan.Limits, TrialEndsAt: trialEndsAt}
+	if current {
+		dunning, err := es.DunningRepository.FindByUser(ctx, userId)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return Entitlements{}, err
+		}
+		if err == nil && dunning.Status == entities.DunningRestricted && dunning.SubscriptionId == subscription.Id {
+			entitlements.Features = []string{}
+			entitlements.ReadOnly = true
+		}
+	}
+	encoded, err := json.Marshal(entitlements)
+	if err != nil {
+		return Entitlements{}, err
+	}
+	// Trials end on time even when the expiry job did not run yet.
+	ttl := es.CacheTTL
+	if trialEndsAt != nil && time.Until(*trialEndsAt) < ttl {
+		ttl = time.Until(*trialEndsAt)
+	}
+	err = es.Redis.Set(ctx, key, encoded, ttl).Err()
+	if err != nil {
+		return Entitlements{}, err
+	}
+	return entitlements, nil
+}
+
+// Can TODO: 1. Report whether the plan of the user includes the feature
+func (es *EntitlementService) Can(ctx context.Context, userId string, feature string) (allowed bool, err error) {
+	entitlements, err := es.Entitlements(ctx, userId)
+	if err != nil {
+		return false, err
+	}
+	return HasScope(entitlements.Features, feature), nil
+}
+
+// Limit TODO: 1. Return the value of the limit in the plan of the user, Unlimited when it is not capped
+func (es *EntitlementService) Limit(ctx context.Context, userId string, limit string) (value int64, err error) {
+	entitlements, err := es.Entitlements(ctx, userId)
+	if err != nil {
+		return 0, err
+	}
+	value, ok := entitlements.Limits[limit]
+	if !ok {
+		return 0, nil
+	}
+	return value, nil
+}
+
+// RequireFeature TODO: 1. Return an EntitlementError with the upgrade hint when the plan lacks the feature
+func (es *EntitlementService) RequireFeature(ctx context.Context, userId string, feature string) error {
+	entitlements, err := es.Entitlements(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if entitlements.ReadOnly {
+		return &EntitlementError{Plan: entitlements.Plan, Feature: feature, ReadOnly: true}
+	}
+	if HasScope(entitlements.Features, feature) {
+		return nil
+	}
+	return &EntitlementError{Plan: entitlements.Plan, Feature: feature, UpgradePlan: es.upgradePlan(func(plan Plan) bool {
+		return HasScope(plan.Features, feature)
+	})}
+}
+
+// RequireLimit TODO: 1. Return an EntitlementError with the upgrade hint when one more unit would exceed the limit
+func (es *EntitlementService) RequireLimit(ctx context.Context, userId string, limit string, used int64) error {
+	entitlements, err := es.Entitlements(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if entitlements.ReadOnly {
+		return &EntitlementError{Plan: entitlements.Plan, Limit: limit, ReadOnly: true}
+	}
+	value, ok := entitlements.Limits[limit]
+	if ok && (value == Unlimited || used < value) {
+		return nil
+	}
+	return &EntitlementError{Plan: entitlements.Plan, Limit: limit, UpgradePlan: es.upgradePlan(func(plan Plan) bool {
+		value, ok := plan.Limits[limit]
+		return ok && (value == Unlimited || used < value)
+	})}
+}
+
+// RequireWritable TODO: 1. Return an EntitlementError when the account is read-only for a failed payment
+func (es *EntitlementService) RequireWritable(ctx context.Context, userId string) error {
+	entitlements, err := es.Entitlements(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if entitlements.ReadOnly {
+		return &EntitlementError{Plan: entitlements.Plan, ReadOnly: true}
+	}
+	return nil
+}
+
+// Invalidate TODO: 1. Drop the cached entitlements, the next check derives them again
+func (es *EntitlementService) Invalidate(ctx context.Context, userId string) error {
+	ctx, span := tracer.Start(ctx, "EntitlementService.Invalidate")
+	defer span.End()
+
+	return es.Redis.Del(ctx, fmt.Sprintf("entitlements:%s", userId)).Err()
+}
+
+// PlanByPrice TODO: 1. Find the plan sold at the price
+func (es *EntitlementService) PlanByPrice(priceId string) (plan Plan, ok bool) {
+	for _, plan := range es.Catalog {
+		if HasScope(plan.PriceIds, priceId) {
+			return plan, true
+		}
+	}
+	return Plan{}, false
+}
+
+// upgradePlan returns the cheapest purchasable plan matching, empty when there is none.
+func (es *EntitlementService) upgradePlan(matches func(plan Plan) bool) string {
+	for _, plan := range es.Catalog {
+		if len(plan.PriceIds) > 0 && matches(plan) {
+			return plan.Name
+		}
+	}
+	return ""
+}
+
+// grantsPlan reports whether the subscription grants its plan, past due subscriptions keep it until they are unpaid or canceled.
+func grantsPlan(subscription entities.Subscription) bool {
+	switch subscription.Status {
+	case entities.SubscriptionTrialing, entities.SubscriptionActive, entities.SubscriptionPastDue:
+		return true
+	}
+	return false
+}
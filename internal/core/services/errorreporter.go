@@ -0,0 +1,53 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+type ErrorReport struct {
+	RequestId string    `json:"request_id"`
+	UserId    string    `json:"user_id,omitempty"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Error     string    `json:"error"`
+	Stack     string    `json:"stack"`
+	Time      time.Time `json:"time"`
+}
+
+// IErrorReporter is the sink for unexpected failures; production deployments can plug in an external tracker.
+type IErrorReporter interface {
+	Report(ctx context.Context, report ErrorReport) error
+}
+
+// NewErrorReporter TODO: 1. Select the reporter by name (file, stdout or none)
+func NewErrorReporter(reporter string, path string) (IErrorReporter, error) {
+	switch reporter {
+	case "file":
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		return &WriterErrorReporter{Writer: file}, nil
+	case "stdout":
+		return &WriterErrorReporter{Writer: os.Stdout}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// WriterErrorReporter writes one JSON document per report, meant for local development.
+type WriterErrorReporter struct {
+	Writer io.Writer
+	mutex  sync.Mutex
+}
+
+func (wr *WriterErrorReporter) Report(ctx context.Context, report ErrorReport) error {
+	wr.mutex.Lock()
+	defer wr.mutex.Unlock()
+	return json.NewEncoder(wr.Writer).Encode(report)
+}
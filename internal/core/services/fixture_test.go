@@ -0,0 +1,246 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Lenstack/lensaas-app/internal/core/billing"
+	"github.com/Lenstack/lensaas-app/internal/core/entities"
+	"github.com/Masterminds/squirrel"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"net"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const (
+	testUserId     = "7f1c1d5e-2a4b-4a8e-9d61-1a2b3c4d5e6f"
+	testProPrice   = "price_pro"
+	testEntPrice   = "price_enterprise"
+	testPlanPrices = "pro:" + testProPrice + ",enterprise:" + testEntPrice
+)
+
+var (
+	testUserColumns = []string{"id", "name", "email", "password", "verified", "role", "code", "token", "send_expires_at",
+		"deactivated_at", "purged_at", "billing_provider", "billing_customer_id", "created_at", "updated_at"}
+	testSubscriptionColumns = []string{"id", "provider", "user_id", "customer_id", "item_id", "price_id", "quantity",
+		"metered_item_id", "status", "cancel_at_period_end", "current_period_start", "current_period_end", "canceled_at",
+		"trial_end", "created_at", "updated_at"}
+)
+
+// fixture runs the billing services against the fake provider, postgres is mocked and redis runs in memory.
+// Audit entries go to their own mock, the chain is written in a transaction of its own.
+type fixture struct {
+	Provider *billing.Fake
+	Database sqlmock.Sqlmock
+	Audit    sqlmock.Sqlmock
+	Redis    *miniredis.Miniredis
+
+	BillingService      *BillingService
+	EntitlementService  *EntitlementService
+	SubscriptionService *SubscriptionService
+	CheckoutService     *CheckoutService
+	DunningService      *DunningService
+	WebhookService      *WebhookService
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+
+	db, database, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditDb, audit, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() {
+		client.Close()
+		db.Close()
+		auditDb.Close()
+	})
+
+	builder := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).RunWith(db)
+	auditBuilder := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).RunWith(auditDb)
+
+	provider := billing.NewFake("secret")
+	auditService := NewAuditService(auditBuilder, auditDb, "720h", t.TempDir())
+	billingService := NewBillingService(builder, client, *auditService, billing.ProviderFake, provider)
+	entitlementService, err := NewEntitlementService(builder, client, testPlanPrices, "5m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	subscriptionService := NewSubscriptionService(builder, *billingService, *entitlementService, *auditService, "")
+	checkoutService, err := NewCheckoutService(*subscriptionService, *auditService, "https://app.test/success", "https://app.test/cancel", "https://app.test/billing", "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Emails go to a closed port, every delivery fails.
+	emailService := NewEmailService("127.0.0.1", closedPort(t), "billing@app.test", "", *NewMetricsService())
+	dunningService, err := NewDunningService(builder, client, *emailService, *entitlementService, *auditService, "168h", "0s,72h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	webhookService := NewWebhookService(builder, *subscriptionService, *dunningService)
+
+	f := &fixture{
+		Provider:            provider,
+		Database:            database,
+		Audit:               audit,
+		Redis:               server,
+		BillingService:      billingService,
+		EntitlementService:  entitlementService,
+		SubscriptionService: subscriptionService,
+		CheckoutService:     checkoutService,
+		DunningService:      dunningService,
+		WebhookService:      webhookService,
+	}
+	t.Cleanup(func() {
+		if err := database.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		if err := audit.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	return f
+}
+
+// closedPort is a local port nothing listens on.
+func closedPort(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+}
+
+// query matches the statement containing the fragment, placeholders included.
+func query(fragment string) string {
+	return regexp.QuoteMeta(fragment)
+}
+
+// expectUser returns the user from users.FindById.
+func (f *fixture) expectUser(user entities.User) {
+	f.Database.ExpectQuery(query("FROM users WHERE id = $1")).
+		WithArgs(user.Id).
+		WillReturnRows(sqlmock.NewRows(testUserColumns).AddRow(user.Id, user.Name, user.Email, user.Password, user.Verified,
+			user.Role, user.Code, user.Token, user.SendExpiresAt, nullable(user.DeactivatedAt), nullable(user.PurgedAt), user.BillingProvider,
+			user.BillingCustomerId, user.CreatedAt, user.UpdatedAt))
+}
+
+// expectCurrentSubscription returns the mirror from subscriptions.FindCurrentByUser, none when subscription is nil.
+func (f *fixture) expectCurrentSubscription(userId string, subscription *entities.Subscription) {
+	expectation := f.Database.ExpectQuery(query("FROM subscriptions WHERE UserId = $1 ORDER BY CreatedAt DESC LIMIT 1")).
+		WithArgs(userId)
+	rows := sqlmock.NewRows(testSubscriptionColumns)
+	if subscription != nil {
+		rows.AddRow(subscription.Id, subscription.Provider, subscription.UserId, subscription.CustomerId, subscription.ItemId,
+			subscription.PriceId, subscription.Quantity, subscription.MeteredItemId, subscription.Status,
+			subscription.CancelAtPeriodEnd, nullable(subscription.CurrentPeriodStart), nullable(subscription.CurrentPeriodEnd),
+			nullable(subscription.CanceledAt), nullable(subscription.TrialEnd), subscription.CreatedAt, subscription.UpdatedAt)
+	}
+	expectation.WillReturnRows(rows)
+}
+
+// expectSync expects the mirror of the provider subscription to be written with the given state, then the trial conversion.
+func (f *fixture) expectSync(subscriptionId string, priceId string, status string, cancelAtPeriodEnd bool) {
+	any := sqlmock.AnyArg()
+	f.Database.ExpectQuery(query("INSERT INTO subscriptions")).
+		WithArgs(subscriptionId, billing.ProviderFake, testUserId, any, any, priceId, any, any, status, cancelAtPeriodEnd,
+			any, any, any, any, any, any).
+		WillReturnRows(sqlmock.NewRows([]string{"Id"}).AddRow(subscriptionId))
+	if grantsPlan(entities.Subscription{Status: status}) {
+		f.Database.ExpectExec(query("UPDATE trials SET ConvertedAt = $1")).
+			WithArgs(sqlmock.AnyArg(), testUserId).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+}
+
+// expectAudit expects one entry of the action on the target to be appended to the chain.
+func (f *fixture) expectAudit(action string, targetId string) {
+	any := sqlmock.AnyArg()
+	f.Audit.ExpectBegin()
+	f.Audit.ExpectExec(query("SELECT pg_advisory_xact_lock($1)")).WillReturnResult(sqlmock.NewResult(0, 0))
+	f.Audit.ExpectQuery(query("SELECT Hash FROM audit_logs")).WillReturnRows(sqlmock.NewRows([]string{"Hash"}))
+	f.Audit.ExpectQuery(query("INSERT INTO audit_logs")).
+		WithArgs(any, any, targetId, action, any, any, any, any, any, any, any).
+		WillReturnRows(sqlmock.NewRows([]string{"Id"}).AddRow("audit"))
+	f.Audit.ExpectCommit()
+}
+
+// cacheEntitlements stores cached entitlements of the user, a sync must drop them.
+func (f *fixture) cacheEntitlements(t *testing.T, userId string) {
+	t.Helper()
+	if err := f.Redis.Set("entitlements:"+userId, "{}"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (f *fixture) assertEntitlementsInvalidated(t *testing.T, userId string) {
+	t.Helper()
+	if f.Redis.Exists("entitlements:" + userId) {
+		t.Error("cached entitlements were not invalidated")
+	}
+}
+
+// mirror is the local mirror of a subscription created at the fake provider.
+func mirror(subscription billing.Subscription) *entities.Subscription {
+	return &entities.Subscription{
+		Id:                 subscription.Id,
+		Provider:           billing.ProviderFake,
+		UserId:             subscription.UserId,
+		CustomerId:         subscription.CustomerId,
+		ItemId:             subscription.Items[0].Id,
+		PriceId:            subscription.Items[0].PriceId,
+		Quantity:           subscription.Items[0].Quantity,
+		Status:             subscription.Status,
+		CancelAtPeriodEnd:  subscription.CancelAtPeriodEnd,
+		CurrentPeriodStart: subscription.CurrentPeriodStart,
+		CurrentPeriodEnd:   subscription.CurrentPeriodEnd,
+		CanceledAt:         subscription.CanceledAt,
+		TrialEnd:           subscription.TrialEnd,
+		CreatedAt:          subscription.CreatedAt,
+		UpdatedAt:          subscription.CreatedAt,
+	}
+}
+
+// verifiedCustomer is a verified user whose customer exists at the fake provider.
+func verifiedCustomer(t *testing.T, f *fixture) entities.User {
+	t.Helper()
+	customerId, err := f.Provider.CreateCustomer(context.Background(), billing.Customer{UserId: testUserId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	return entities.User{Id: testUserId, Name: "ada", Email: "ada@example.com", Verified: true, Role: entities.RoleUser,
+		BillingProvider: billing.ProviderFake, BillingCustomerId: customerId, CreatedAt: now, UpdatedAt: now}
+}
+
+// subscribed creates a subscription of the user at the fake provider.
+func subscribed(t *testing.T, f *fixture, customerId string, priceId string) billing.Subscription {
+	t.Helper()
+	subscription, err := f.Provider.CreateSubscription(context.Background(), billing.SubscriptionParams{
+		UserId: testUserId, CustomerId: customerId, PriceId: priceId,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return subscription
+}
+
+// nullable is the column value of an optional time.
+func nullable(value *time.Time) driver.Value {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
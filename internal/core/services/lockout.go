@@ -0,0 +1,63 @@
+package services
+
+import (
+	"strconv"
+	"time"
+)
+
+// LockoutPolicy delays sign-in exponentially after Threshold consecutive failures
+// and locks the account for Duration once MaxAttempts is reached.
+type LockoutPolicy struct {
+	Threshold   int
+	MaxAttempts int
+	BaseDelay   time.Duration
+	Duration    time.Duration
+}
+
+func NewLockoutPolicy(threshold string, maxAttempts string, baseDelay string, duration string) *LockoutPolicy {
+	thresholdInt, err := strconv.Atoi(threshold)
+	if err != nil {
+		panic(err)
+	}
+	maxAttemptsInt, err := strconv.Atoi(maxAttempts)
+	if err != nil {
+		panic(err)
+	}
+	baseDelayTime, err := time.ParseDuration(baseDelay)
+	if err != nil {
+		panic(err)
+	}
+	durationTime, err := time.ParseDuration(duration)
+	if err != nil {
+		panic(err)
+	}
+	return &LockoutPolicy{Threshold: thresholdInt, MaxAttempts: maxAttemptsInt, BaseDelay: baseDelayTime, Duration: durationTime}
+}
+
+// Delay returns how long a client must wait after its last failure before trying again.
+func (lp *LockoutPolicy) Delay(failures int) time.Duration {
+	if failures < lp.Threshold {
+		return 0
+	}
+	delay := lp.BaseDelay
+	for i := lp.Threshold; i < failures && delay < lp.Duration; i++ {
+		delay *= 2
+	}
+	if delay > lp.Duration {
+		return lp.Duration
+	}
+	return delay
+}
+
+// LockoutError is returned by SignIn while the account is delayed or locked.
+type LockoutError struct {
+	Locked     bool
+	RetryAfter time.Duration
+}
+
+func (le *LockoutError) Error() string {
+	if le.Locked {
+		return "account is temporarily locked, check your email to unlock it"
+	}
+	return "too many failed sign-in attempts, try again later"
+}
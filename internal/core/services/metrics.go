@@ -0,0 +1,164 @@
+package services
+
+import (
+	"database/sql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+const metricsNamespace = "lensaas"
+
+type IMetricsService interface {
+	ObserveRequest(method, route string, status int, duration time.Duration)
+	IncSignIn(result string)
+	IncToken(operation string)
+	IncEmail(result string)
+	IncPanic(route string)
+	IncRateLimited(policy string)
+	RegisterDatabase(database *sql.DB)
+	RegisterRedis(client *redis.Client)
+}
+
+type MetricsService struct {
+	Registry        *prometheus.Registry
+	requestsTotal   *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	signInTotal     *prometheus.CounterVec
+	tokensTotal     *prometheus.CounterVec
+	emailsTotal     *prometheus.CounterVec
+	panicsTotal     *prometheus.CounterVec
+	rateLimited     *prometheus.CounterVec
+}
+
+func NewMetricsService() *MetricsService {
+	registry := prometheus.NewRegistry()
+	ms := &MetricsService{
+		Registry: registry,
+		requestsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_total",
+			Help:      "Total number of HTTP requests by route pattern, method and status.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by route pattern, method and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		signInTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "auth_sign_in_total",
+			Help:      "Sign-in attempts by result (success or failure reason).",
+		}, []string{"result"}),
+		tokensTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "auth_tokens_total",
+			Help:      "Token operations by type (issued, refreshed, revoked).",
+		}, []string{"operation"}),
+		emailsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "emails_sent_total",
+			Help:      "Email delivery attempts by result.",
+		}, []string{"result"}),
+		panicsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_panics_total",
+			Help:      "Panics recovered while serving HTTP requests by route pattern.",
+		}, []string{"route"}),
+		rateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_rate_limited_total",
+			Help:      "Requests rejected by the rate limiter by policy.",
+		}, []string{"policy"}),
+	}
+
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		ms.requestsTotal,
+		ms.requestDuration,
+		ms.signInTotal,
+		ms.tokensTotal,
+		ms.emailsTotal,
+		ms.panicsTotal,
+		ms.rateLimited,
+	)
+	return ms
+}
+
+func (ms *MetricsService) ObserveRequest(method, route string, status int, duration time.Duration) {
+	statusCode := strconv.Itoa(status)
+	ms.requestsTotal.WithLabelValues(method, route, statusCode).Inc()
+	ms.requestDuration.WithLabelValues(method, route, statusCode).Observe(duration.Seconds())
+}
+
+func (ms *MetricsService) IncSignIn(result string) {
+	ms.signInTotal.WithLabelValues(result).Inc()
+}
+
+func (ms *MetricsService) IncToken(operation string) {
+	ms.tokensTotal.WithLabelValues(operation).Inc()
+}
+
+func (ms *MetricsService) IncEmail(result string) {
+	ms.emailsTotal.WithLabelValues(result).Inc()
+}
+
+func (ms *MetricsService) IncPanic(route string) {
+	ms.panicsTotal.WithLabelValues(route).Inc()
+}
+
+func (ms *MetricsService) IncRateLimited(policy string) {
+	ms.rateLimited.WithLabelValues(policy).Inc()
+}
+
+// RegisterDatabase TODO: 1. Expose database/sql connection pool stats
+func (ms *MetricsService) RegisterDatabase(database *sql.DB) {
+	ms.Registry.MustRegister(collectors.NewDBStatsCollector(database, "postgres"))
+}
+
+// RegisterRedis TODO: 1. Expose go-redis connection pool stats
+func (ms *MetricsService) RegisterRedis(client *redis.Client) {
+	ms.Registry.MustRegister(&redisPoolCollector{client: client})
+}
+
+var (
+	redisPoolHits = prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "redis_pool", "hits_total"),
+		"Number of times a free connection was found in the pool.", nil, nil)
+	redisPoolMisses = prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "redis_pool", "misses_total"),
+		"Number of times a free connection was not found in the pool.", nil, nil)
+	redisPoolTimeouts = prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "redis_pool", "timeouts_total"),
+		"Number of times a wait timeout occurred.", nil, nil)
+	redisPoolTotalConns = prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "redis_pool", "total_connections"),
+		"Number of total connections in the pool.", nil, nil)
+	redisPoolIdleConns = prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "redis_pool", "idle_connections"),
+		"Number of idle connections in the pool.", nil, nil)
+	redisPoolStaleConns = prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "redis_pool", "stale_connections_total"),
+		"Number of stale connections removed from the pool.", nil, nil)
+)
+
+type redisPoolCollector struct {
+	client *redis.Client
+}
+
+func (rc *redisPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- redisPoolHits
+	ch <- redisPoolMisses
+	ch <- redisPoolTimeouts
+	ch <- redisPoolTotalConns
+	ch <- redisPoolIdleConns
+	ch <- redisPoolStaleConns
+}
+
+func (rc *redisPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := rc.client.PoolStats()
+	ch <- prometheus.MustNewConstMetric(redisPoolHits, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(redisPoolMisses, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(redisPoolTimeouts, prometheus.CounterValue, float64(stats.Timeouts))
+	ch <- prometheus.MustNewConstMetric(redisPoolTotalConns, prometheus.GaugeValue, float64(stats.TotalConns))
+	ch <- prometheus.MustNewConstMetric(redisPoolIdleConns, prometheus.GaugeValue, float64(stats.IdleConns))
+	ch <- prometheus.MustNewConstMetric(redisPoolStaleConns, prometheus.CounterValue, float64(stats.StaleConns))
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/Lenstack/lensaas-app/internal/core/entities"
+	"github.com/Lenstack/lensaas-app/internal/core/repositories"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"github.com/Masterminds/squirrel"
+	"strings"
+	"time"
+)
+
+const (
+	GrantTypeClientCredentials = "client_credentials"
+
+	AuditOAuthClientCreated = "oauth_client.created"
+	AuditOAuthClientRevoked = "oauth_client.revoked"
+	AuditOAuthTokenIssued   = "oauth_client.token_issued"
+
+	oauthClientPrefix = "cli_"
+)
+
+// OAuthError carries the RFC 6749 error code returned by the token endpoint.
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (oe *OAuthError) Error() string {
+	return oe.Description
+}
+
+type IOAuthClientService interface {
+	CreateClient(ctx context.Context, name string, scopes []string) (secret string, client entities.OAuthClient, err error)
+	ListClients(ctx context.Context) (clients []entities.OAuthClient, err error)
+	RevokeClient(ctx context.Context, clientId string) (message string, err error)
+	ClientCredentials(ctx context.Context, clientId string, clientSecret string, scope string) (token string, scopes []string, expiresIn time.Duration, err error)
+}
+
+type OAuthClientService struct {
+	OAuthClientRepository repositories.OAuthClientRepository
+	TokenService          TokenService
+	AuditService          AuditService
+	TokenExpiration       time.Duration
+}
+
+func NewOAuthClientService(database squirrel.StatementBuilderType, tokenService TokenService, auditService AuditService, tokenExpiration string) *OAuthClientService {
+	tokenExpirationTime, err := time.ParseDuration(tokenExpiration)
+	if err != nil {
+		panic(err)
+	}
+	return &OAuthClientService{
+		OAuthClientRepository: repositories.OAuthClientRepository{
+			Database: database,
+		},
+		TokenService:    tokenService,
+		AuditService:    auditService,
+		TokenExpiration: tokenExpirationTime,
+	}
+}
+
+// CreateClient TODO: 1. Check the scopes, clients never act on an account nor pass the administrator check of the audit logs, 2. Generate id and secret, store only the secret hash, 3. Return the secret once
+func (cs *OAuthClientService) CreateClient(ctx context.Context, name string, scopes []string) (secret string, client entities.OAuthClient, err error) {
+	ctx, span := tracer.Start(ctx, "OAuthClientService.CreateClient")
+	defer span.End()
+
+	for _, scope := range scopes {
+		if !HasScope(Scopes, scope) {
+			return "", entities.OAuthClient{}, fmt.Errorf("unknown scope %q", scope)
+		}
+		if scope == ScopeAccount || scope == ScopeAuditRead {
+			return "", entities.OAuthClient{}, fmt.Errorf("scope %q is not available to clients", scope)
+		}
+	}
+
+	clientId, err := randomString(8, hex.EncodeToString)
+	if err != nil {
+		return "", entities.OAuthClient{}, err
+	}
+	secret, err = randomString(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return "", entities.OAuthClient{}, err
+	}
+
+	client = entities.OAuthClient{
+		Id:         oauthClientPrefix + clientId,
+		Name:       name,
+		SecretHash: hashSecret(secret),
+		Scopes:     scopes,
+		CreatedBy:  utils.Principal(ctx).Id,
+		CreatedAt:  time.Now(),
+	}
+	if client.Scopes == nil {
+		client.Scopes = []string{}
+	}
+
+	_, err = cs.OAuthClientRepository.Create(ctx, client)
+	if err != nil {
+		return "", entities.OAuthClient{}, err
+	}
+
+	cs.AuditService.Record(ctx, AuditOAuthClientCreated, client.Id, map[string]interface{}{"name": name, "scopes": client.Scopes})
+	return secret, client, nil
+}
+
+// ListClients TODO: 1. Find every oauth client, 2. Return oauth clients
+func (cs *OAuthClientService) ListClients(ctx context.Context) (clients []entities.OAuthClient, err error) {
+	ctx, span := tracer.Start(ctx, "OAuthClientService.ListClients")
+	defer span.End()
+
+	return cs.OAuthClientRepository.FindAll(ctx)
+}
+
+// RevokeClient TODO: 1. Revoke the oauth client, tokens already issued expire on their own, 2. Return success message
+func (cs *OAuthClientService) RevokeClient(ctx context.Context, clientId string) (message string, err error) {
+	ctx, span := tracer.Start(ctx, "OAuthClientService.RevokeClient")
+	defer span.End()
+
+	message, err = cs.OAuthClientRepository.Revoke(ctx, clientId)
+	if err != nil {
+		return "", err
+	}
+
+	cs.AuditService.Record(ctx, AuditOAuthClientRevoked, clientId, nil)
+	return message, nil
+}
+
+// ClientCredentials TODO: 1. Authenticate the client, 2. Narrow the requested scopes to the allowed ones, 3. Issue a client access token
+func (cs *OAuthClientService) ClientCredentials(ctx context.Context, clientId string, clientSecret string, scope string) (token string, scopes []string, expiresIn time.Duration, err error) {
+	ctx, span := tracer.Start(ctx, "OAuthClientService.ClientCredentials")
+	defer span.End()
+
+	invalidClient := &OAuthError{Code: "invalid_client", Description: "client authentication failed"}
+
+	client, err := cs.OAuthClientRepository.FindById(ctx, clientId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil, 0, invalidClient
+	}
+	if err != nil {
+		return "", nil, 0, err
+	}
+	if subtle.ConstantTimeCompare([]byte(client.SecretHash), []byte(hashSecret(clientSecret))) != 1 || client.RevokedAt != nil {
+		return "", nil, 0, invalidClient
+	}
+
+	scopes = client.Scopes
+	if scope != "" {
+		scopes = strings.Fields(scope)
+		for _, requested := range scopes {
+			if !HasScope(client.Scopes, requested) {
+				return "", nil, 0, &OAuthError{Code: "invalid_scope", Description: fmt.Sprintf("scope %q is not allowed for this client", requested)}
+			}
+		}
+	}
+
+	token, err = cs.TokenService.GenerateClientToken(client.Id, scopes, cs.TokenExpiration)
+	if err != nil {
+		return "", nil, 0, err
+	}
+
+	ctx = utils.WithPrincipal(ctx, utils.PrincipalInfo{Type: utils.PrincipalClient, Id: client.Id})
+	cs.AuditService.Record(ctx, AuditOAuthTokenIssued, client.Id, map[string]interface{}{"scopes": scopes})
+	return token, scopes, cs.TokenExpiration, nil
+}
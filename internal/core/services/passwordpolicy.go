@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"github.com/nbutton23/zxcvbn-go"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	PasswordClassLower  = "lower"
+	PasswordClassUpper  = "upper"
+	PasswordClassDigit  = "digit"
+	PasswordClassSymbol = "symbol"
+)
+
+type IPasswordPolicyService interface {
+	Validate(ctx context.Context, password string, userInputs ...string) error
+}
+
+type PasswordPolicy struct {
+	MinLength       int
+	MaxLength       int
+	RequiredClasses []string
+	// MinStrength is the minimum zxcvbn score, from 0 (too guessable) to 4 (very unguessable).
+	MinStrength int
+}
+
+type PasswordPolicyService struct {
+	Policy   PasswordPolicy
+	Breached IBreachedPasswordChecker
+}
+
+// PasswordPolicyError lists every rule the password breaks so clients can show them all at once.
+type PasswordPolicyError struct {
+	Violations []string
+}
+
+func (pe *PasswordPolicyError) Error() string {
+	return "password does not meet the policy: " + strings.Join(pe.Violations, "; ")
+}
+
+func NewPasswordPolicyService(minLength string, maxLength string, requiredClasses string, minStrength string, breached IBreachedPasswordChecker) *PasswordPolicyService {
+	minLengthInt, err := strconv.Atoi(minLength)
+	if err != nil {
+		panic(err)
+	}
+	maxLengthInt, err := strconv.Atoi(maxLength)
+	if err != nil {
+		panic(err)
+	}
+	minStrengthInt, err := strconv.Atoi(minStrength)
+	if err != nil {
+		panic(err)
+	}
+
+	var classes []string
+	for _, class := range strings.Split(requiredClasses, ",") {
+		class = strings.TrimSpace(class)
+		switch class {
+		case "":
+			continue
+		case PasswordClassLower, PasswordClassUpper, PasswordClassDigit, PasswordClassSymbol:
+			classes = append(classes, class)
+		default:
+			panic(fmt.Sprintf("unknown password class %q", class))
+		}
+	}
+
+	return &PasswordPolicyService{
+		Policy: PasswordPolicy{
+			MinLength:       minLengthInt,
+			MaxLength:       maxLengthInt,
+			RequiredClasses: classes,
+			MinStrength:     minStrengthInt,
+		},
+		Breached: breached,
+	}
+}
+
+// Validate TODO: 1. Check length, overlong passwords stop there, and character classes, 2. Reject passwords containing user inputs, 3. Estimate strength, 4. Check breached passwords
+func (ps *PasswordPolicyService) Validate(ctx context.Context, password string, userInputs ...string) error {
+	ctx, span := tracer.Start(ctx, "PasswordPolicyService.Validate")
+	defer span.End()
+
+	// Strength estimation grows faster than the length, overlong passwords are rejected before it runs.
+	length := utf8.RuneCountInString(password)
+	if ps.Policy.MaxLength > 0 && length > ps.Policy.MaxLength {
+		return &PasswordPolicyError{Violations: []string{fmt.Sprintf("must be at most %d characters long", ps.Policy.MaxLength)}}
+	}
+
+	var violations []string
+	if length < ps.Policy.MinLength {
+		violations = append(violations, fmt.Sprintf("must be at least %d characters long", ps.Policy.MinLength))
+	}
+
+	for _, class := range ps.Policy.RequiredClasses {
+		if !containsClass(password, class) {
+			violations = append(violations, "must contain at least one "+class+" character")
+		}
+	}
+
+	// Inputs are split so both "jane.doe@example.com" and "jane" or "doe" are rejected.
+	lowerPassword := strings.ToLower(password)
+	var inputs []string
+	containsInput := false
+	for _, input := range userInputs {
+		for _, part := range strings.FieldsFunc(strings.ToLower(input), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			if len(part) < 3 {
+				continue
+			}
+			inputs = append(inputs, part)
+			containsInput = containsInput || strings.Contains(lowerPassword, part)
+		}
+	}
+	if containsInput {
+		violations = append(violations, "must not contain your name or email")
+	}
+
+	if strength := zxcvbn.PasswordStrength(password, inputs); strength.Score < ps.Policy.MinStrength {
+		violations = append(violations, "is too easy to guess")
+	}
+
+	if ps.Breached != nil {
+		breached, err := ps.Breached.Breached(ctx, password)
+		if err != nil {
+			// The check is best effort, an unavailable dataset must not block sign-ups.
+			utils.Logger(ctx).Warn("breached password check failed", zap.Error(err))
+		}
+		if breached {
+			violations = append(violations, "has appeared in a data breach, please choose another one")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+func containsClass(password string, class string) bool {
+	for _, character := range password {
+		switch {
+		case class == PasswordClassLower && unicode.IsLower(character),
+			class == PasswordClassUpper && unicode.IsUpper(character),
+			class == PasswordClassDigit && unicode.IsDigit(character),
+			class == PasswordClassSymbol && (unicode.IsPunct(character) || unicode.IsSymbol(character) || unicode.IsSpace(character)):
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,246 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	RateLimitKeyIp    = "ip"
+	RateLimitKeyUser  = "user"
+	RateLimitKeyEmail = "email"
+)
+
+type IRateLimitService interface {
+	Policy(name string) (policy RateLimitPolicy, ok bool)
+	Allowlisted(ip string) bool
+	ClientIp(remoteAddr string, forwardedFor string) string
+	Allow(ctx context.Context, policy RateLimitPolicy, keys map[string]string) (result RateLimitResult, err error)
+}
+
+// RateLimitPolicy allows Limit requests per sliding Window for every key dimension listed in Keys.
+type RateLimitPolicy struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+	Keys   []string
+}
+
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+type RateLimitService struct {
+	Redis     *redis.Client
+	Policies  map[string]RateLimitPolicy
+	allowlist []*net.IPNet
+	// trustedProxies may set X-Forwarded-For, e.g. the load balancer.
+	trustedProxies []*net.IPNet
+}
+
+// slidingWindowScript TODO: 1. Drop entries outside the window, 2. Admit the request if under the limit, 3. Return allowed, remaining and reset in milliseconds
+var slidingWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', key, 0, now - window)
+local count = redis.call('ZCARD', key)
+local allowed = 0
+if count < limit then
+	redis.call('ZADD', key, now, ARGV[4])
+	redis.call('PEXPIRE', key, window)
+	count = count + 1
+	allowed = 1
+end
+
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+local reset = window
+if oldest[2] then
+	reset = window - (now - tonumber(oldest[2]))
+end
+return {allowed, limit - count, reset}
+`)
+
+// NewRateLimitService TODO: 1. Parse the policies (name:limit/window:key+key,...), 2. Parse the allowlist of IPs and CIDRs
+func NewRateLimitService(redis *redis.Client, policies string, allowlist string, trustedProxies string) (*RateLimitService, error) {
+	parsedPolicies, err := ParseRateLimitPolicies(policies)
+	if err != nil {
+		return nil, err
+	}
+	allowedNetworks, err := parseNetworks(allowlist)
+	if err != nil {
+		return nil, err
+	}
+	proxyNetworks, err := parseNetworks(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RateLimitService{Redis: redis, Policies: parsedPolicies, allowlist: allowedNetworks, trustedProxies: proxyNetworks}, nil
+}
+
+// parseNetworks parses ips and cidrs separated by commas, a single ip is a network of its own.
+func parseNetworks(entries string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range strings.Split(entries, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if strings.Contains(entry, ":") {
+				entry += "/128"
+			} else {
+				entry += "/32"
+			}
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// ParseRateLimitPolicies TODO: 1. Parse entries like "sign_in:10/1m:ip+email" separated by commas
+func ParseRateLimitPolicies(policies string) (map[string]RateLimitPolicy, error) {
+	parsed := map[string]RateLimitPolicy{}
+	for _, entry := range strings.Split(policies, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.Split(entry, ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid rate limit policy %q", entry)
+		}
+
+		rate := strings.SplitN(parts[1], "/", 2)
+		if len(rate) != 2 {
+			return nil, fmt.Errorf("invalid rate limit policy %q", entry)
+		}
+		limit, err := strconv.Atoi(rate[0])
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("invalid rate limit in policy %q", entry)
+		}
+		window, err := time.ParseDuration(rate[1])
+		if err != nil || window <= 0 {
+			return nil, fmt.Errorf("invalid rate limit window in policy %q", entry)
+		}
+
+		keys := strings.Split(parts[2], "+")
+		for _, key := range keys {
+			if key != RateLimitKeyIp && key != RateLimitKeyUser && key != RateLimitKeyEmail {
+				return nil, fmt.Errorf("invalid rate limit key %q in policy %q", key, entry)
+			}
+		}
+
+		parsed[parts[0]] = RateLimitPolicy{Name: parts[0], Limit: limit, Window: window, Keys: keys}
+	}
+	return parsed, nil
+}
+
+func (rs *RateLimitService) Policy(name string) (policy RateLimitPolicy, ok bool) {
+	policy, ok = rs.Policies[name]
+	return policy, ok
+}
+
+func (rs *RateLimitService) Allowlisted(ip string) bool {
+	return containsIp(rs.allowlist, ip)
+}
+
+// ClientIp TODO: 1. Trust X-Forwarded-For only when the connection comes from a trusted proxy, 2. Return the nearest address that is not a trusted proxy
+func (rs *RateLimitService) ClientIp(remoteAddr string, forwardedFor string) string {
+	ip := remoteAddr
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		ip = host
+	}
+	if !containsIp(rs.trustedProxies, ip) || forwardedFor == "" {
+		return ip
+	}
+
+	// Each proxy appends the address it received the request from, clients can forge everything left of our proxies.
+	hops := strings.Split(forwardedFor, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			return ip
+		}
+		ip = hop
+		if !containsIp(rs.trustedProxies, hop) {
+			return hop
+		}
+	}
+	return ip
+}
+
+func containsIp(networks []*net.IPNet, ip string) bool {
+	parsedIp := net.ParseIP(ip)
+	if parsedIp == nil {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(parsedIp) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allow TODO: 1. Check every key dimension of the policy, 2. Return the most restrictive result
+func (rs *RateLimitService) Allow(ctx context.Context, policy RateLimitPolicy, keys map[string]string) (result RateLimitResult, err error) {
+	ctx, span := tracer.Start(ctx, "RateLimitService.Allow")
+	defer span.End()
+
+	result = RateLimitResult{Allowed: true, Limit: policy.Limit, Remaining: policy.Limit}
+	now := time.Now().UnixMilli()
+
+	for _, dimension := range policy.Keys {
+		value := keys[dimension]
+		if value == "" {
+			continue
+		}
+
+		// Values are hashed so emails never appear in Redis key names.
+		hash := sha256.Sum256([]byte(strings.ToLower(value)))
+		key := fmt.Sprintf("rate_limit:%s:%s:%s", policy.Name, dimension, hex.EncodeToString(hash[:]))
+
+		values, err := slidingWindowScript.Run(ctx, rs.Redis, []string{key},
+			now, policy.Window.Milliseconds(), policy.Limit, uuid.New().String()).Int64Slice()
+		if err != nil {
+			return RateLimitResult{}, err
+		}
+
+		remaining := int(values[1])
+		reset := time.Duration(values[2]) * time.Millisecond
+		if remaining < result.Remaining {
+			result.Remaining = remaining
+		}
+		if reset > result.Reset {
+			result.Reset = reset
+		}
+		if values[0] == 0 {
+			result.Allowed = false
+			if reset > result.RetryAfter {
+				result.RetryAfter = reset
+			}
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"github.com/Lenstack/lensaas-app/internal/core/repositories"
+	"strings"
+	"time"
+)
+
+// parseReminders parses the reminder offsets of a job (e.g. 0s,72h,144h), the caller orders them.
+func parseReminders(reminders string) (offsets []time.Duration, err error) {
+	for _, reminder := range strings.Split(reminders, ",") {
+		reminder = strings.TrimSpace(reminder)
+		if reminder == "" {
+			continue
+		}
+		offset, err := time.ParseDuration(reminder)
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("invalid reminder %q", reminder)
+		}
+		offsets = append(offsets, offset)
+	}
+	return offsets, nil
+}
+
+// remindersDue counts the reminders that came due by now, at returns the time the reminder of an offset is due.
+func remindersDue(offsets []time.Duration, now time.Time, at func(offset time.Duration) time.Time) (due int) {
+	for _, offset := range offsets {
+		if !now.Before(at(offset)) {
+			due++
+		}
+	}
+	return due
+}
+
+// reminderCounter moves the reminders sent from previous to remindersSent unless another worker moved them first.
+type reminderCounter func(previous int, remindersSent int, remindedAt *time.Time) (counted bool, err error)
+
+// remind sends the latest reminder that came due, missed reminders are not sent one after the other. The reminders
+// are counted first so a single worker sends it, then given back when the email fails so the next run retries it.
+func remind(sent int, due int, lastReminderAt *time.Time, now time.Time, count reminderCounter, send func() error) error {
+	if due <= sent {
+		return nil
+	}
+	counted, err := count(sent, due, &now)
+	if err != nil || !counted {
+		return err
+	}
+	err = send()
+	if err != nil {
+		if _, countErr := count(due, sent, lastReminderAt); countErr != nil {
+			return countErr
+		}
+		return err
+	}
+	return nil
+}
+
+// notify emails a billing notification to the user and waits for the delivery so a failure reaches the job, body builds
+// the template data from the name of the user.
+func notify(ctx context.Context, userRepository repositories.UserRepository, emailService EmailService, userId string,
+	template string, subject string, body func(name string) interface{}) error {
+	user, err := userRepository.FindById(ctx, userId)
+	if err != nil {
+		return err
+	}
+	mail, err := emailService.Create(template, []string{user.Email}, subject, body(strings.ToTitle(user.Name)), []string{})
+	if err != nil {
+		return err
+	}
+	return emailService.Deliver(ctx, mail)
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// reminderCount is a counter kept in memory, claimed tells whether another worker counted the reminders first.
+type reminderCount struct {
+	sent           int
+	lastReminderAt *time.Time
+	claimed        bool
+	calls          int
+}
+
+func (rc *reminderCount) count(previous int, remindersSent int, remindedAt *time.Time) (bool, error) {
+	rc.calls++
+	if rc.claimed || rc.sent != previous {
+		return false, nil
+	}
+	rc.sent, rc.lastReminderAt = remindersSent, remindedAt
+	return true, nil
+}
+
+func TestParseReminders(t *testing.T) {
+	offsets, err := parseReminders(" 0s, 72h,,144h ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(offsets) != 3 || offsets[0] != 0 || offsets[1] != 72*time.Hour || offsets[2] != 144*time.Hour {
+		t.Errorf("offsets = %v", offsets)
+	}
+	for _, reminders := range []string{"-1h", "soon"} {
+		if _, err := parseReminders(reminders); err == nil {
+			t.Errorf("reminders %q parsed", reminders)
+		}
+	}
+}
+
+func TestRemindersDue(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	offsets := []time.Duration{0, 72 * time.Hour, 144 * time.Hour}
+	tests := []struct {
+		now  time.Time
+		want int
+	}{
+		{now: start.Add(-time.Minute), want: 0},
+		{now: start, want: 1},
+		{now: start.Add(72 * time.Hour), want: 2},
+		{now: start.Add(200 * time.Hour), want: 3},
+	}
+	for _, test := range tests {
+		if due := remindersDue(offsets, test.now, start.Add); due != test.want {
+			t.Errorf("due at %v = %d, want %d", test.now, due, test.want)
+		}
+	}
+}
+
+func TestRemindSendsLatestDueReminderOnce(t *testing.T) {
+	now := time.Now()
+	counter := &reminderCount{}
+	sends := 0
+	send := func() error {
+		sends++
+		return nil
+	}
+
+	// Two reminders came due, the latest one is sent for both.
+	err := remind(counter.sent, 2, counter.lastReminderAt, now, counter.count, send)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sends != 1 || counter.sent != 2 || counter.lastReminderAt == nil || !counter.lastReminderAt.Equal(now) {
+		t.Fatalf("sends = %d, counter = %+v", sends, counter)
+	}
+
+	err = remind(counter.sent, 2, counter.lastReminderAt, now, counter.count, send)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sends != 1 {
+		t.Errorf("a reminder already sent was sent again")
+	}
+}
+
+func TestRemindSkipsReminderClaimedElsewhere(t *testing.T) {
+	counter := &reminderCount{claimed: true}
+
+	err := remind(0, 1, nil, time.Now(), counter.count, func() error {
+		t.Error("a reminder claimed by another worker was sent")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRemindRetriesFailedReminder(t *testing.T) {
+	previous := time.Now().Add(-72 * time.Hour)
+	counter := &reminderCount{sent: 1, lastReminderAt: &previous}
+	failure := errors.New("smtp unavailable")
+
+	err := remind(counter.sent, 2, counter.lastReminderAt, time.Now(), counter.count, func() error {
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("err = %v, want %v", err, failure)
+	}
+	if counter.sent != 1 || counter.lastReminderAt != &previous {
+		t.Fatalf("failed reminder still counted, counter = %+v", counter)
+	}
+
+	// The next run claims the reminder again.
+	sends := 0
+	err = remind(counter.sent, 2, counter.lastReminderAt, time.Now(), counter.count, func() error {
+		sends++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sends != 1 || counter.sent != 2 {
+		t.Errorf("sends = %d, counter = %+v", sends, counter)
+	}
+}
@@ -0,0 +1,321 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Lenstack/lensaas-app/internal/core/billing"
+	"github.com/Lenstack/lensaas-app/internal/core/entities"
+	"github.com/Lenstack/lensaas-app/internal/core/repositories"
+	"github.com/Lenstack/lensaas-app/internal/templates"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"github.com/Masterminds/squirrel"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gopkg.in/gomail.v2"
+	"strings"
+	"time"
+)
+
+const (
+	AuditMemberInvited = "account.member_invited"
+	AuditMemberAdded   = "account.member_added"
+	AuditMemberRemoved = "account.member_removed"
+
+	invitationTtl = 7 * 24 * time.Hour
+)
+
+var (
+	ErrMemberNotFound     = errors.New("member not found")
+	ErrMemberExists       = errors.New("user is already a member of an account")
+	ErrMemberIsOwner      = errors.New("the account owner already takes a seat")
+	ErrInvitationNotFound = errors.New("invitation not found")
+)
+
+// Seats compares the seats taken by the owner and the members of an account with the paid ones. Accounts without a
+// live subscription are not billed per seat, their paid seats are the plan limit.
+type Seats struct {
+	Used  int64
+	Paid  int64
+	Limit int64
+}
+
+type ISeatService interface {
+	Members(ctx context.Context, accountId string) (members []entities.AccountMember, err error)
+	Seats(ctx context.Context, accountId string) (seats Seats, err error)
+	InviteMember(ctx context.Context, accountId string, email string) error
+	Invitations(ctx context.Context, userId string) (invitations []entities.AccountInvitation, err error)
+	AcceptInvitation(ctx context.Context, userId string, accountId string) (member entities.AccountMember, err error)
+	DeclineInvitation(ctx context.Context, userId string, accountId string) error
+	RemoveMember(ctx context.Context, accountId string, userId string) error
+	LeaveAccount(ctx context.Context, userId string) error
+}
+
+type SeatService struct {
+	AccountMemberRepository     repositories.AccountMemberRepository
+	AccountInvitationRepository repositories.AccountInvitationRepository
+	UserRepository              repositories.UserRepository
+	SubscriptionService         SubscriptionService
+	EntitlementService          EntitlementService
+	EmailService                EmailService
+	AuditService                AuditService
+	// Proration is the proration behaviour of seat changes, one of the billing proration behaviours.
+	Proration string
+}
+
+// NewSeatService TODO: 1. Check the proration behaviour
+func NewSeatService(database squirrel.StatementBuilderType, db *sql.DB, redis *redis.Client, subscriptionService SubscriptionService, entitlementService EntitlementService, emailService EmailService, auditService AuditService, proration string) (*SeatService, error) {
+	switch proration {
+	case billing.ProrationCreate, billing.ProrationInvoice, billing.ProrationNone:
+	default:
+		return nil, fmt.Errorf("invalid seat proration %q", proration)
+	}
+	return &SeatService{
+		AccountMemberRepository: repositories.AccountMemberRepository{
+			Database: database,
+			DB:       db,
+		},
+		AccountInvitationRepository: repositories.AccountInvitationRepository{
+			Database: database,
+		},
+		UserRepository: repositories.UserRepository{
+			Database: database,
+			Redis:    redis,
+		},
+		SubscriptionService: subscriptionService,
+		EntitlementService:  entitlementService,
+		EmailService:        emailService,
+		AuditService:        auditService,
+		Proration:           proration,
+	}, nil
+}
+
+// Members TODO: 1. Return the members of the account, the owner excluded
+func (ss *SeatService) Members(ctx context.Context, accountId string) (members []entities.AccountMember, err error) {
+	ctx, span := tracer.Start(ctx, "SeatService.Members")
+	defer span.End()
+
+	return ss.AccountMemberRepository.FindByAccount(ctx, accountId)
+}
+
+// Seats TODO: 1. Count the owner and the members, 2. Read the paid seats from the live subscription, 3. Return them with the plan limit
+func (ss *SeatService) Seats(ctx context.Context, accountId string) (seats Seats, err error) {
+	ctx, span := tracer.Start(ctx, "SeatService.Seats")
+	defer span.End()
+
+	seats, _, err = ss.seats(ctx, accountId)
+	return seats, err
+}
+
+// InviteMember TODO: 1. Check the plan seat limit, 2. Invite the user of the email, 3. Email the invitation, emails of no user are ignored so the answer does not tell which ones are registered
+func (ss *SeatService) InviteMember(ctx context.Context, accountId string, email string) error {
+	ctx, span := tracer.Start(ctx, "SeatService.InviteMember")
+	defer span.End()
+
+	seats, _, err := ss.seats(ctx, accountId)
+	if err != nil {
+		return err
+	}
+	err = ss.EntitlementService.RequireLimit(ctx, accountId, LimitSeats, seats.Used)
+	if err != nil {
+		return err
+	}
+
+	user, err := ss.UserRepository.FindByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.Id == accountId {
+		return ErrMemberIsOwner
+	}
+	if user.DeactivatedAt != nil {
+		return nil
+	}
+
+	now := time.Now()
+	invitation := entities.AccountInvitation{AccountId: accountId, UserId: user.Id, CreatedAt: now, ExpiresAt: now.Add(invitationTtl)}
+	_, err = ss.AccountInvitationRepository.Create(ctx, invitation)
+	if err != nil {
+		return err
+	}
+	ss.AuditService.Record(ctx, AuditMemberInvited, accountId, map[string]interface{}{
+		"member_id":  user.Id,
+		"expires_at": invitation.ExpiresAt,
+	})
+
+	// The invitation is listed to the user either way, a failed email would only tell the owner the email is registered.
+	owner, err := ss.UserRepository.FindById(ctx, accountId)
+	if err == nil {
+		var mail *gomail.Message
+		mail, err = ss.EmailService.Create("internal/templates/account_invitation_template.html", []string{user.Email}, "You Are Invited",
+			templates.AccountInvitation{Name: strings.ToTitle(user.Name), OwnerName: owner.Name, OwnerEmail: owner.Email,
+				ExpiresAt: invitation.ExpiresAt.Format("January 2, 2006")}, []string{})
+		if err == nil {
+			err = ss.EmailService.Send(ctx, mail)
+		}
+	}
+	if err != nil {
+		utils.Logger(ctx).Warn("invitation email not sent", zap.String("account_id", accountId), zap.Error(err))
+	}
+	return nil
+}
+
+// Invitations TODO: 1. Return the invitations of the user that did not expire
+func (ss *SeatService) Invitations(ctx context.Context, userId string) (invitations []entities.AccountInvitation, err error) {
+	ctx, span := tracer.Start(ctx, "SeatService.Invitations")
+	defer span.End()
+
+	return ss.AccountInvitationRepository.FindByUser(ctx, userId, time.Now())
+}
+
+// AcceptInvitation TODO: 1. Find the invitation of the user, 2. Add the user to the account, 3. Drop the invitation
+func (ss *SeatService) AcceptInvitation(ctx context.Context, userId string, accountId string) (member entities.AccountMember, err error) {
+	ctx, span := tracer.Start(ctx, "SeatService.AcceptInvitation")
+	defer span.End()
+
+	_, err = ss.AccountInvitationRepository.Find(ctx, accountId, userId, time.Now())
+	if errors.Is(err, sql.ErrNoRows) {
+		return entities.AccountMember{}, ErrInvitationNotFound
+	}
+	if err != nil {
+		return entities.AccountMember{}, err
+	}
+	user, err := ss.UserRepository.FindById(ctx, userId)
+	if err != nil {
+		return entities.AccountMember{}, err
+	}
+
+	member, err = ss.addMember(ctx, accountId, user)
+	if err != nil {
+		return entities.AccountMember{}, err
+	}
+	_, err = ss.AccountInvitationRepository.Delete(ctx, accountId, userId)
+	if err != nil {
+		utils.Logger(ctx).Warn("accepted invitation not deleted", zap.String("account_id", accountId), zap.Error(err))
+	}
+	return member, nil
+}
+
+// DeclineInvitation TODO: 1. Drop the invitation of the user
+func (ss *SeatService) DeclineInvitation(ctx context.Context, userId string, accountId string) error {
+	ctx, span := tracer.Start(ctx, "SeatService.DeclineInvitation")
+	defer span.End()
+
+	deleted, err := ss.AccountInvitationRepository.Delete(ctx, accountId, userId)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrInvitationNotFound
+	}
+	return nil
+}
+
+// addMember adds the user to the account within the plan seat limit, then pays one more seat when the paid ones are
+// taken. The member is removed again when the provider refuses.
+func (ss *SeatService) addMember(ctx context.Context, accountId string, user entities.User) (member entities.AccountMember, err error) {
+	seats, billed, err := ss.seats(ctx, accountId)
+	if err != nil {
+		return entities.AccountMember{}, err
+	}
+
+	// The members are counted under the lock of the account, members added at the same time cannot pass the limit together.
+	member = entities.AccountMember{AccountId: accountId, UserId: user.Id, Email: user.Email, Name: user.Name, CreatedAt: time.Now()}
+	created, members, err := ss.AccountMemberRepository.Create(ctx, member, func(members int64) error {
+		return ss.EntitlementService.RequireLimit(ctx, accountId, LimitSeats, members+1)
+	})
+	if err != nil {
+		return entities.AccountMember{}, err
+	}
+	if !created {
+		return entities.AccountMember{}, ErrMemberExists
+	}
+
+	used := members + 1
+	if billed && used > seats.Paid {
+		_, err = ss.SubscriptionService.UpdateQuantity(ctx, accountId, used, ss.Proration)
+		if err != nil {
+			if _, deleteErr := ss.AccountMemberRepository.Delete(ctx, accountId, user.Id); deleteErr != nil {
+				return entities.AccountMember{}, deleteErr
+			}
+			return entities.AccountMember{}, err
+		}
+	}
+	ss.AuditService.Record(ctx, AuditMemberAdded, accountId, map[string]interface{}{
+		"member_id": user.Id,
+		"seats":     used,
+	})
+	return member, nil
+}
+
+// RemoveMember TODO: 1. Remove the member, 2. Stop paying the seats no longer taken
+func (ss *SeatService) RemoveMember(ctx context.Context, accountId string, userId string) error {
+	ctx, span := tracer.Start(ctx, "SeatService.RemoveMember")
+	defer span.End()
+
+	deleted, err := ss.AccountMemberRepository.Delete(ctx, accountId, userId)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrMemberNotFound
+	}
+	ss.AuditService.Record(ctx, AuditMemberRemoved, accountId, map[string]interface{}{
+		"member_id": userId,
+	})
+
+	seats, billed, err := ss.seats(ctx, accountId)
+	if err != nil {
+		return err
+	}
+	if billed && seats.Paid > seats.Used {
+		// The member is gone either way, the paid seats follow on the next change when the provider fails now.
+		_, err = ss.SubscriptionService.UpdateQuantity(ctx, accountId, seats.Used, ss.Proration)
+		if err != nil {
+			utils.Logger(ctx).Warn("paid seats not reduced", zap.String("account_id", accountId), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// LeaveAccount TODO: 1. Find the account the user is a member of, 2. Remove the user from it
+func (ss *SeatService) LeaveAccount(ctx context.Context, userId string) error {
+	ctx, span := tracer.Start(ctx, "SeatService.LeaveAccount")
+	defer span.End()
+
+	member, err := ss.AccountMemberRepository.FindByUser(ctx, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrMemberNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return ss.RemoveMember(ctx, member.AccountId, userId)
+}
+
+// seats reports the seats of the account and whether they are billed by a live subscription.
+func (ss *SeatService) seats(ctx context.Context, accountId string) (seats Seats, billed bool, err error) {
+	members, err := ss.AccountMemberRepository.CountByAccount(ctx, accountId)
+	if err != nil {
+		return Seats{}, false, err
+	}
+	limit, err := ss.EntitlementService.Limit(ctx, accountId, LimitSeats)
+	if err != nil {
+		return Seats{}, false, err
+	}
+	seats = Seats{Used: members + 1, Paid: limit, Limit: limit}
+
+	subscription, err := ss.SubscriptionService.liveSubscription(ctx, accountId)
+	if errors.Is(err, ErrSubscriptionNotFound) {
+		return seats, false, nil
+	}
+	if err != nil {
+		return Seats{}, false, err
+	}
+	seats.Paid = subscription.Quantity
+	return seats, true, nil
+}
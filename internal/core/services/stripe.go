@@ -1,13 +0,0 @@
-package services
-
-type IStripeService interface {
-	CreateCustomer()
-	CreateSubscription()
-}
-
-type StripeService struct {
-}
-
-func NewStripeService() *StripeService {
-	return &StripeService{}
-}
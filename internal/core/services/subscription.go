@@ -0,0 +1,411 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/Lenstack/lensaas-app/internal/core/billing"
+	"github.com/Lenstack/lensaas-app/internal/core/entities"
+	"github.com/Lenstack/lensaas-app/internal/core/repositories"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"github.com/Masterminds/squirrel"
+	"time"
+)
+
+const (
+	AuditSubscriptionCreated  = "subscription.created"
+	AuditSubscriptionChanged  = "subscription.changed"
+	AuditSubscriptionCanceled = "subscription.canceled"
+	AuditSubscriptionResumed  = "subscription.resumed"
+	AuditSubscriptionSeats    = "subscription.seats"
+	AuditTrialConverted       = "trial.converted"
+)
+
+var (
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+	ErrSubscriptionExists   = errors.New("user already has a subscription")
+	ErrUnknownPrice         = errors.New("price is not part of any plan")
+)
+
+type ISubscriptionService interface {
+	CreateSubscription(ctx context.Context, userId string, priceId string) (subscription entities.Subscription, clientSecret string, err error)
+	GetSubscription(ctx context.Context, userId string) (subscription entities.Subscription, err error)
+	PreviewChange(ctx context.Context, userId string, priceId string) (preview SubscriptionPreview, err error)
+	ChangePlan(ctx context.Context, userId string, priceId string, prorationDate int64) (subscription entities.Subscription, err error)
+	UpdateQuantity(ctx context.Context, userId string, quantity int64, proration string) (subscription entities.Subscription, err error)
+	CancelSubscription(ctx context.Context, userId string, immediately bool) (subscription entities.Subscription, err error)
+	ResumeSubscription(ctx context.Context, userId string) (subscription entities.Subscription, err error)
+	SyncSubscription(ctx context.Context, provider string, userId string, providerSubscription billing.Subscription) (subscription entities.Subscription, err error)
+	RefreshSubscription(ctx context.Context, provider string, subscriptionId string) (subscription entities.Subscription, err error)
+}
+
+type SubscriptionService struct {
+	SubscriptionRepository repositories.SubscriptionRepository
+	TrialRepository        repositories.TrialRepository
+	BillingService         BillingService
+	EntitlementService     EntitlementService
+	AuditService           AuditService
+	// MeteredPriceId is added to every new subscription to bill usage, empty when usage is not billed.
+	MeteredPriceId string
+}
+
+// SubscriptionPreview is the upcoming invoice of a plan change. ProrationDate must be sent back to ChangePlan
+// so the charged amount matches the previewed one.
+type SubscriptionPreview struct {
+	AmountDue       int64
+	ProrationAmount int64
+	Currency        string
+	ProrationDate   int64
+}
+
+func NewSubscriptionService(database squirrel.StatementBuilderType, billingService BillingService, entitlementService EntitlementService, auditService AuditService, meteredPriceId string) *SubscriptionService {
+	return &SubscriptionService{
+		SubscriptionRepository: repositories.SubscriptionRepository{
+			Database: database,
+		},
+		TrialRepository: repositories.TrialRepository{
+			Database: database,
+		},
+		BillingService:     billingService,
+		EntitlementService: entitlementService,
+		AuditService:       auditService,
+		MeteredPriceId:     meteredPriceId,
+	}
+}
+
+// CreateSubscription TODO: 1. Create the customer if needed, 2. Reject users with a live subscription, 3. Create the subscription waiting for the first payment, 4. Mirror it and return the client secret to confirm the payment
+func (ss *SubscriptionService) CreateSubscription(ctx context.Context, userId string, priceId string) (subscription entities.Subscription, clientSecret string, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.CreateSubscription")
+	defer span.End()
+
+	if _, ok := ss.EntitlementService.PlanByPrice(priceId); !ok {
+		return entities.Subscription{}, "", ErrUnknownPrice
+	}
+
+	provider, customerId, err := ss.BillingService.CreateCustomer(ctx, userId, "")
+	if err != nil {
+		return entities.Subscription{}, "", err
+	}
+
+	current, err := ss.GetSubscription(ctx, userId)
+	if err == nil && current.Live() {
+		return entities.Subscription{}, "", ErrSubscriptionExists
+	}
+	if err != nil && !errors.Is(err, ErrSubscriptionNotFound) {
+		return entities.Subscription{}, "", err
+	}
+
+	params := billing.SubscriptionParams{
+		UserId:         userId,
+		CustomerId:     customerId,
+		PriceId:        priceId,
+		MeteredPriceId: ss.MeteredPriceId,
+	}
+	// A retried request must not open a second subscription.
+	if requestId := utils.RequestId(ctx); requestId != "" {
+		params.IdempotencyKey = "subscription-create-" + userId + "-" + requestId
+	}
+
+	providerSubscription, err := provider.CreateSubscription(ctx, params)
+	if err != nil {
+		return entities.Subscription{}, "", err
+	}
+
+	subscription, err = ss.SyncSubscription(ctx, provider.Name(), userId, providerSubscription)
+	if err != nil {
+		return entities.Subscription{}, "", err
+	}
+	ss.AuditService.Record(ctx, AuditSubscriptionCreated, userId, map[string]interface{}{
+		"subscription_id": subscription.Id,
+		"price_id":        subscription.PriceId,
+	})
+	return subscription, providerSubscription.ClientSecret, nil
+}
+
+// GetSubscription TODO: 1. Read the mirrored subscription of the user, the provider is not called
+func (ss *SubscriptionService) GetSubscription(ctx context.Context, userId string) (subscription entities.Subscription, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.GetSubscription")
+	defer span.End()
+
+	subscription, err = ss.SubscriptionRepository.FindCurrentByUser(ctx, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entities.Subscription{}, ErrSubscriptionNotFound
+	}
+	return subscription, err
+}
+
+// PreviewChange TODO: 1. Find the live subscription, 2. Ask the provider for the upcoming invoice with the new price prorated from now, 3. Return amounts and the proration date
+func (ss *SubscriptionService) PreviewChange(ctx context.Context, userId string, priceId string) (preview SubscriptionPreview, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.PreviewChange")
+	defer span.End()
+
+	if _, ok := ss.EntitlementService.PlanByPrice(priceId); !ok {
+		return SubscriptionPreview{}, ErrUnknownPrice
+	}
+
+	subscription, err := ss.liveSubscription(ctx, userId)
+	if err != nil {
+		return SubscriptionPreview{}, err
+	}
+	provider, err := ss.BillingService.Provider(subscription.Provider)
+	if err != nil {
+		return SubscriptionPreview{}, err
+	}
+
+	providerPreview, err := provider.PreviewChange(ctx, billing.ChangeParams{
+		SubscriptionId: subscription.Id,
+		CustomerId:     subscription.CustomerId,
+		ItemId:         subscription.ItemId,
+		PriceId:        priceId,
+		ProrationDate:  time.Now().Unix(),
+	})
+	if err != nil {
+		return SubscriptionPreview{}, err
+	}
+	return SubscriptionPreview(providerPreview), nil
+}
+
+// ChangePlan TODO: 1. Find the live subscription, 2. Swap the price of its item with prorations, at the previewed date when given, 3. Mirror and return the subscription
+func (ss *SubscriptionService) ChangePlan(ctx context.Context, userId string, priceId string, prorationDate int64) (subscription entities.Subscription, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.ChangePlan")
+	defer span.End()
+
+	if _, ok := ss.EntitlementService.PlanByPrice(priceId); !ok {
+		return entities.Subscription{}, ErrUnknownPrice
+	}
+
+	subscription, err = ss.liveSubscription(ctx, userId)
+	if err != nil {
+		return entities.Subscription{}, err
+	}
+	if subscription.PriceId == priceId {
+		return entities.Subscription{}, errors.New("subscription is already on this price")
+	}
+	provider, err := ss.BillingService.Provider(subscription.Provider)
+	if err != nil {
+		return entities.Subscription{}, err
+	}
+
+	providerSubscription, err := provider.ChangeSubscription(ctx, billing.ChangeParams{
+		SubscriptionId: subscription.Id,
+		CustomerId:     subscription.CustomerId,
+		ItemId:         subscription.ItemId,
+		PriceId:        priceId,
+		ProrationDate:  prorationDate,
+	})
+	if err != nil {
+		return entities.Subscription{}, err
+	}
+
+	previousPriceId := subscription.PriceId
+	subscription, err = ss.SyncSubscription(ctx, provider.Name(), userId, providerSubscription)
+	if err != nil {
+		return entities.Subscription{}, err
+	}
+	ss.AuditService.Record(ctx, AuditSubscriptionChanged, userId, map[string]interface{}{
+		"subscription_id":   subscription.Id,
+		"previous_price_id": previousPriceId,
+		"price_id":          subscription.PriceId,
+	})
+	return subscription, nil
+}
+
+// UpdateQuantity TODO: 1. Find the live subscription, 2. Set the quantity of its plan item with the proration behaviour, 3. Mirror and return the subscription
+func (ss *SubscriptionService) UpdateQuantity(ctx context.Context, userId string, quantity int64, proration string) (subscription entities.Subscription, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.UpdateQuantity")
+	defer span.End()
+
+	subscription, err = ss.liveSubscription(ctx, userId)
+	if err != nil {
+		return entities.Subscription{}, err
+	}
+	if subscription.Quantity == quantity {
+		return subscription, nil
+	}
+	provider, err := ss.BillingService.Provider(subscription.Provider)
+	if err != nil {
+		return entities.Subscription{}, err
+	}
+
+	providerSubscription, err := provider.UpdateQuantity(ctx, billing.QuantityParams{
+		SubscriptionId: subscription.Id,
+		ItemId:         subscription.ItemId,
+		Quantity:       quantity,
+		Proration:      proration,
+	})
+	if err != nil {
+		return entities.Subscription{}, err
+	}
+
+	previousQuantity := subscription.Quantity
+	subscription, err = ss.SyncSubscription(ctx, provider.Name(), userId, providerSubscription)
+	if err != nil {
+		return entities.Subscription{}, err
+	}
+	ss.AuditService.Record(ctx, AuditSubscriptionSeats, userId, map[string]interface{}{
+		"subscription_id":   subscription.Id,
+		"previous_quantity": previousQuantity,
+		"quantity":          subscription.Quantity,
+		"proration":         proration,
+	})
+	return subscription, nil
+}
+
+// CancelSubscription TODO: 1. Find the live subscription, 2. Cancel it now or at the end of the paid period, 3. Mirror and return the subscription
+func (ss *SubscriptionService) CancelSubscription(ctx context.Context, userId string, immediately bool) (subscription entities.Subscription, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.CancelSubscription")
+	defer span.End()
+
+	subscription, err = ss.liveSubscription(ctx, userId)
+	if err != nil {
+		return entities.Subscription{}, err
+	}
+	provider, err := ss.BillingService.Provider(subscription.Provider)
+	if err != nil {
+		return entities.Subscription{}, err
+	}
+
+	providerSubscription, err := provider.CancelSubscription(ctx, subscription.Id, immediately)
+	if err != nil {
+		return entities.Subscription{}, err
+	}
+
+	subscription, err = ss.SyncSubscription(ctx, provider.Name(), userId, providerSubscription)
+	if err != nil {
+		return entities.Subscription{}, err
+	}
+	ss.AuditService.Record(ctx, AuditSubscriptionCanceled, userId, map[string]interface{}{
+		"subscription_id": subscription.Id,
+		"immediately":     immediately,
+	})
+	return subscription, nil
+}
+
+// ResumeSubscription TODO: 1. Find the live subscription scheduled for cancellation, 2. Keep it renewing, 3. Mirror and return the subscription
+func (ss *SubscriptionService) ResumeSubscription(ctx context.Context, userId string) (subscription entities.Subscription, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.ResumeSubscription")
+	defer span.End()
+
+	subscription, err = ss.liveSubscription(ctx, userId)
+	if err != nil {
+		return entities.Subscription{}, err
+	}
+	if !subscription.CancelAtPeriodEnd {
+		return entities.Subscription{}, errors.New("subscription is not scheduled for cancellation")
+	}
+	provider, err := ss.BillingService.Provider(subscription.Provider)
+	if err != nil {
+		return entities.Subscription{}, err
+	}
+
+	providerSubscription, err := provider.ResumeSubscription(ctx, subscription.Id)
+	if err != nil {
+		return entities.Subscription{}, err
+	}
+
+	subscription, err = ss.SyncSubscription(ctx, provider.Name(), userId, providerSubscription)
+	if err != nil {
+		return entities.Subscription{}, err
+	}
+	ss.AuditService.Record(ctx, AuditSubscriptionResumed, userId, map[string]interface{}{
+		"subscription_id": subscription.Id,
+	})
+	return subscription, nil
+}
+
+// SyncSubscription TODO: 1. Copy the state of the provider subscription into the local mirror, 2. Convert the running trial once a subscription grants a plan, 3. Invalidate the cached entitlements, 4. Return the mirrored subscription
+func (ss *SubscriptionService) SyncSubscription(ctx context.Context, provider string, userId string, providerSubscription billing.Subscription) (subscription entities.Subscription, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.SyncSubscription")
+	defer span.End()
+
+	subscription = entities.Subscription{
+		Id:                 providerSubscription.Id,
+		Provider:           provider,
+		UserId:             userId,
+		CustomerId:         providerSubscription.CustomerId,
+		Status:             providerSubscription.Status,
+		CancelAtPeriodEnd:  providerSubscription.CancelAtPeriodEnd,
+		CurrentPeriodStart: providerSubscription.CurrentPeriodStart,
+		CurrentPeriodEnd:   providerSubscription.CurrentPeriodEnd,
+		CanceledAt:         providerSubscription.CanceledAt,
+		TrialEnd:           providerSubscription.TrialEnd,
+		CreatedAt:          providerSubscription.CreatedAt,
+		UpdatedAt:          time.Now(),
+	}
+	// Subscriptions hold the plan price and, when usage is billed, the metered price.
+	for _, item := range providerSubscription.Items {
+		if item.PriceId == ss.MeteredPriceId && ss.MeteredPriceId != "" {
+			subscription.MeteredItemId = item.Id
+			continue
+		}
+		if subscription.ItemId == "" {
+			subscription.ItemId = item.Id
+			subscription.PriceId = item.PriceId
+			subscription.Quantity = item.Quantity
+		}
+	}
+
+	_, err = ss.SubscriptionRepository.Upsert(ctx, subscription)
+	if err != nil {
+		return entities.Subscription{}, err
+	}
+	if grantsPlan(subscription) {
+		converted, err := ss.TrialRepository.Convert(ctx, userId, time.Now())
+		if err != nil {
+			return entities.Subscription{}, err
+		}
+		if converted {
+			ss.AuditService.Record(ctx, AuditTrialConverted, userId, map[string]interface{}{
+				"subscription_id": subscription.Id,
+			})
+		}
+	}
+	// The plan may have changed, entitlements are derived again on the next check.
+	err = ss.EntitlementService.Invalidate(ctx, userId)
+	if err != nil {
+		return entities.Subscription{}, err
+	}
+	return subscription, nil
+}
+
+// RefreshSubscription TODO: 1. Fetch the current state of the subscription from its provider, events can arrive out of order, 2. Find its user by metadata, mirror or customer, 3. Mirror and return the subscription
+func (ss *SubscriptionService) RefreshSubscription(ctx context.Context, providerName string, subscriptionId string) (subscription entities.Subscription, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.RefreshSubscription")
+	defer span.End()
+
+	provider, err := ss.BillingService.Provider(providerName)
+	if err != nil {
+		return entities.Subscription{}, err
+	}
+	providerSubscription, err := provider.GetSubscription(ctx, subscriptionId)
+	if err != nil {
+		return entities.Subscription{}, err
+	}
+
+	userId := providerSubscription.UserId
+	if userId == "" {
+		if mirrored, err := ss.SubscriptionRepository.FindById(ctx, subscriptionId); err == nil {
+			userId = mirrored.UserId
+		}
+	}
+	if userId == "" && providerSubscription.CustomerId != "" {
+		if user, err := ss.BillingService.UserRepository.FindByBillingCustomerId(ctx, provider.Name(), providerSubscription.CustomerId); err == nil {
+			userId = user.Id
+		}
+	}
+	if userId == "" {
+		return entities.Subscription{}, errors.New("subscription " + subscriptionId + " does not belong to any user")
+	}
+	return ss.SyncSubscription(ctx, provider.Name(), userId, providerSubscription)
+}
+
+func (ss *SubscriptionService) liveSubscription(ctx context.Context, userId string) (subscription entities.Subscription, err error) {
+	subscription, err = ss.GetSubscription(ctx, userId)
+	if err != nil {
+		return entities.Subscription{}, err
+	}
+	if !subscription.Live() {
+		return entities.Subscription{}, ErrSubscriptionNotFound
+	}
+	return subscription, nil
+}
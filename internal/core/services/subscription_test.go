@@ -0,0 +1,192 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Lenstack/lensaas-app/internal/core/billing"
+	"github.com/Lenstack/lensaas-app/internal/core/entities"
+	"testing"
+	"time"
+)
+
+func TestCreateSubscription(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	now := time.Now()
+	user := entities.User{Id: testUserId, Name: "ada", Email: "ada@example.com", Verified: true, Role: entities.RoleUser,
+		CreatedAt: now, UpdatedAt: now}
+	f.cacheEntitlements(t, testUserId)
+
+	f.expectUser(user)
+	f.Database.ExpectQuery(query("UPDATE users SET BillingProvider = $1, BillingCustomerId = $2")).
+		WithArgs(billing.ProviderFake, sqlmock.AnyArg(), sqlmock.AnyArg(), testUserId).
+		WillReturnRows(sqlmock.NewRows([]string{"Id"}).AddRow(testUserId))
+	f.expectCurrentSubscription(testUserId, nil)
+	f.expectSync("sub_fake_2", testProPrice, entities.SubscriptionActive, false)
+	f.expectAudit(AuditSubscriptionCreated, testUserId)
+
+	subscription, _, err := f.SubscriptionService.CreateSubscription(ctx, testUserId, testProPrice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subscription.Id != "sub_fake_2" || subscription.PriceId != testProPrice || subscription.Status != entities.SubscriptionActive {
+		t.Errorf("unexpected subscription %+v", subscription)
+	}
+	if subscription.CustomerId != "cus_fake_1" {
+		t.Errorf("subscription customer = %q, want the created customer", subscription.CustomerId)
+	}
+	f.assertEntitlementsInvalidated(t, testUserId)
+}
+
+func TestCreateSubscriptionRejectsLiveSubscription(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	user := verifiedCustomer(t, f)
+	current := subscribed(t, f, user.BillingCustomerId, testProPrice)
+
+	f.expectUser(user)
+	f.expectCurrentSubscription(testUserId, mirror(current))
+
+	_, _, err := f.SubscriptionService.CreateSubscription(ctx, testUserId, testEntPrice)
+	if !errors.Is(err, ErrSubscriptionExists) {
+		t.Fatalf("err = %v, want %v", err, ErrSubscriptionExists)
+	}
+}
+
+func TestCreateSubscriptionRejectsUnknownPrice(t *testing.T) {
+	f := newFixture(t)
+
+	_, _, err := f.SubscriptionService.CreateSubscription(context.Background(), testUserId, "price_unknown")
+	if !errors.Is(err, ErrUnknownPrice) {
+		t.Fatalf("err = %v, want %v", err, ErrUnknownPrice)
+	}
+}
+
+func TestChangePlan(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	user := verifiedCustomer(t, f)
+	current := subscribed(t, f, user.BillingCustomerId, testProPrice)
+	f.cacheEntitlements(t, testUserId)
+
+	f.expectCurrentSubscription(testUserId, mirror(current))
+	f.expectSync(current.Id, testEntPrice, entities.SubscriptionActive, false)
+	f.expectAudit(AuditSubscriptionChanged, testUserId)
+
+	subscription, err := f.SubscriptionService.ChangePlan(ctx, testUserId, testEntPrice, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subscription.PriceId != testEntPrice || subscription.ItemId != current.Items[0].Id {
+		t.Errorf("unexpected subscription %+v", subscription)
+	}
+	providerSubscription, err := f.Provider.GetSubscription(ctx, current.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if providerSubscription.Items[0].PriceId != testEntPrice {
+		t.Errorf("provider price = %q, want %q", providerSubscription.Items[0].PriceId, testEntPrice)
+	}
+	f.assertEntitlementsInvalidated(t, testUserId)
+}
+
+func TestChangePlanRejectsSamePrice(t *testing.T) {
+	f := newFixture(t)
+	user := verifiedCustomer(t, f)
+	current := subscribed(t, f, user.BillingCustomerId, testProPrice)
+
+	f.expectCurrentSubscription(testUserId, mirror(current))
+
+	_, err := f.SubscriptionService.ChangePlan(context.Background(), testUserId, testProPrice, 0)
+	if err == nil {
+		t.Fatal("changing to the current price succeeded")
+	}
+}
+
+func TestCancelSubscription(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	user := verifiedCustomer(t, f)
+	current := subscribed(t, f, user.BillingCustomerId, testProPrice)
+
+	f.expectCurrentSubscription(testUserId, mirror(current))
+	f.expectSync(current.Id, testProPrice, entities.SubscriptionActive, true)
+	f.expectAudit(AuditSubscriptionCanceled, testUserId)
+
+	subscription, err := f.SubscriptionService.CancelSubscription(ctx, testUserId, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !subscription.CancelAtPeriodEnd || subscription.Status != entities.SubscriptionActive {
+		t.Errorf("subscription must renew no more but stay active, got %+v", subscription)
+	}
+}
+
+func TestCancelSubscriptionImmediately(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	user := verifiedCustomer(t, f)
+	current := subscribed(t, f, user.BillingCustomerId, testProPrice)
+	f.cacheEntitlements(t, testUserId)
+
+	f.expectCurrentSubscription(testUserId, mirror(current))
+	f.expectSync(current.Id, testProPrice, entities.SubscriptionCanceled, false)
+	f.expectAudit(AuditSubscriptionCanceled, testUserId)
+
+	subscription, err := f.SubscriptionService.CancelSubscription(ctx, testUserId, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subscription.Status != entities.SubscriptionCanceled || subscription.CanceledAt == nil {
+		t.Errorf("subscription must be canceled, got %+v", subscription)
+	}
+	f.assertEntitlementsInvalidated(t, testUserId)
+}
+
+func TestCancelSubscriptionWithoutSubscription(t *testing.T) {
+	f := newFixture(t)
+
+	f.expectCurrentSubscription(testUserId, nil)
+
+	_, err := f.SubscriptionService.CancelSubscription(context.Background(), testUserId, false)
+	if !errors.Is(err, ErrSubscriptionNotFound) {
+		t.Fatalf("err = %v, want %v", err, ErrSubscriptionNotFound)
+	}
+}
+
+func TestResumeSubscription(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	user := verifiedCustomer(t, f)
+	current := subscribed(t, f, user.BillingCustomerId, testProPrice)
+	current, err := f.Provider.CancelSubscription(ctx, current.Id, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.expectCurrentSubscription(testUserId, mirror(current))
+	f.expectSync(current.Id, testProPrice, entities.SubscriptionActive, false)
+	f.expectAudit(AuditSubscriptionResumed, testUserId)
+
+	subscription, err := f.SubscriptionService.ResumeSubscription(ctx, testUserId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subscription.CancelAtPeriodEnd {
+		t.Errorf("subscription is still scheduled for cancellation")
+	}
+}
+
+func TestResumeSubscriptionNotScheduledForCancellation(t *testing.T) {
+	f := newFixture(t)
+	user := verifiedCustomer(t, f)
+	current := subscribed(t, f, user.BillingCustomerId, testProPrice)
+
+	f.expectCurrentSubscription(testUserId, mirror(current))
+
+	_, err := f.SubscriptionService.ResumeSubscription(context.Background(), testUserId)
+	if err == nil {
+		t.Fatal("resuming a renewing subscription succeeded")
+	}
+}
@@ -2,24 +2,40 @@ package services
 
 import (
 	"encoding/base64"
+	"errors"
+	"github.com/Lenstack/lensaas-app/internal/utils"
 	"github.com/golang-jwt/jwt/v4"
 	"math/rand"
+	"strings"
 	"time"
 )
 
 type ITokenService interface {
 	GenerateToken(userId string, expiration time.Duration) (string, error)
 	ValidateToken(token string) (string, error)
+	GenerateAccessToken(userId string, authentication utils.AuthenticationInfo, expiration time.Duration) (string, error)
+	ValidateAccessToken(token string) (string, utils.AuthenticationInfo, error)
+	GenerateImpersonationToken(userId string, actorId string, expiration time.Duration) (string, error)
+	GenerateClientToken(clientId string, scopes []string, expiration time.Duration) (string, error)
+	ValidateClientToken(token string) (string, []string, error)
+	GeneratePurposeToken(userId string, purpose string, expiration time.Duration) (string, error)
+	ValidatePurposeToken(token string, purpose string) (string, error)
 	NewRefreshToken() (string, error)
 }
 
+// AuthMethodPassword is the amr value (RFC 8176) of a password authentication.
+const AuthMethodPassword = "pwd"
+
 type TokenService struct {
 	secret                string
 	ExpirationTimeAccess  time.Duration
 	ExpirationTimeRefresh time.Duration
+	ExpirationTimeReauth  time.Duration
+	// ExpirationTimeImpersonation bounds impersonation sessions, they can not be refreshed.
+	ExpirationTimeImpersonation time.Duration
 }
 
-func NewTokenService(secret string, expirationAccess string, expirationRefresh string) *TokenService {
+func NewTokenService(secret string, expirationAccess string, expirationRefresh string, expirationReauth string, expirationImpersonation string) *TokenService {
 	expirationTimeAccess, err := time.ParseDuration(expirationAccess)
 	if err != nil {
 		panic(err)
@@ -28,7 +44,15 @@ func NewTokenService(secret string, expirationAccess string, expirationRefresh s
 	if err != nil {
 		panic(err)
 	}
-	return &TokenService{secret, expirationTimeAccess, expirationTimeRefresh}
+	expirationTimeReauth, err := time.ParseDuration(expirationReauth)
+	if err != nil {
+		panic(err)
+	}
+	expirationTimeImpersonation, err := time.ParseDuration(expirationImpersonation)
+	if err != nil {
+		panic(err)
+	}
+	return &TokenService{secret, expirationTimeAccess, expirationTimeRefresh, expirationTimeReauth, expirationTimeImpersonation}
 }
 
 func (ts *TokenService) GenerateToken(userId string, expiration time.Duration) (string, error) {
@@ -40,18 +64,136 @@ func (ts *TokenService) GenerateToken(userId string, expiration time.Duration) (
 }
 
 func (ts *TokenService) ValidateToken(token string) (string, error) {
+	userId, _, err := ts.ValidateAccessToken(token)
+	return userId, err
+}
+
+// GenerateAccessToken TODO: 1. Generate a token carrying when (auth_time) and how (amr) the user authenticated
+func (ts *TokenService) GenerateAccessToken(userId string, authentication utils.AuthenticationInfo, expiration time.Duration) (string, error) {
+	claims := jwt.MapClaims{
+		"id":        userId,
+		"exp":       time.Now().Add(expiration).Unix(),
+		"auth_time": authentication.Time.Unix(),
+		"amr":       authentication.Methods,
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(ts.secret))
+}
+
+// ValidateAccessToken TODO: 1. Validate the token, 2. Return user id and authentication info, tokens without auth_time are never considered recent
+func (ts *TokenService) ValidateAccessToken(token string) (string, utils.AuthenticationInfo, error) {
+	claims, err := ts.parse(token)
+	if err != nil {
+		return "", utils.AuthenticationInfo{}, err
+	}
+	// Single purpose tokens (account unlock, password reset...) must never be accepted as credentials.
+	if _, ok := claims["purpose"]; ok {
+		return "", utils.AuthenticationInfo{}, errors.New("invalid token claims")
+	}
+	if principal, ok := claims["principal"]; ok && principal != utils.PrincipalUser {
+		return "", utils.AuthenticationInfo{}, errors.New("invalid token claims")
+	}
+	userId, ok := claims["id"].(string)
+	if !ok || userId == "" {
+		return "", utils.AuthenticationInfo{}, errors.New("invalid token claims")
+	}
+
+	var authentication utils.AuthenticationInfo
+	if authTime, ok := claims["auth_time"].(float64); ok {
+		authentication.Time = time.Unix(int64(authTime), 0)
+	}
+	if methods, ok := claims["amr"].([]interface{}); ok {
+		for _, method := range methods {
+			if method, ok := method.(string); ok {
+				authentication.Methods = append(authentication.Methods, method)
+			}
+		}
+	}
+	if actor, ok := claims["act"].(map[string]interface{}); ok {
+		authentication.ActorId, _ = actor["sub"].(string)
+		if authentication.ActorId == "" {
+			return "", utils.AuthenticationInfo{}, errors.New("invalid token claims")
+		}
+	}
+	return userId, authentication, nil
+}
+
+// GenerateImpersonationToken TODO: 1. Generate a token for the user carrying the real actor (RFC 8693 act claim), without auth_time so it never counts as a recent authentication
+func (ts *TokenService) GenerateImpersonationToken(userId string, actorId string, expiration time.Duration) (string, error) {
+	claims := jwt.MapClaims{
+		"id":  userId,
+		"act": map[string]interface{}{"sub": actorId},
+		"exp": time.Now().Add(expiration).Unix(),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(ts.secret))
+}
+
+// GenerateClientToken TODO: 1. Generate a token whose subject is an OAuth client, restricted to the granted scopes
+func (ts *TokenService) GenerateClientToken(clientId string, scopes []string, expiration time.Duration) (string, error) {
+	claims := jwt.MapClaims{
+		"id":        clientId,
+		"principal": utils.PrincipalClient,
+		"scope":     strings.Join(scopes, " "),
+		"exp":       time.Now().Add(expiration).Unix(),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(ts.secret))
+}
+
+// ValidateClientToken TODO: 1. Validate the token, 2. Check its subject is an OAuth client, 3. Return client id and scopes
+func (ts *TokenService) ValidateClientToken(token string) (string, []string, error) {
+	claims, err := ts.parse(token)
+	if err != nil {
+		return "", nil, err
+	}
+	if principal, _ := claims["principal"].(string); principal != utils.PrincipalClient {
+		return "", nil, errors.New("invalid token claims")
+	}
+	clientId, ok := claims["id"].(string)
+	if !ok || clientId == "" {
+		return "", nil, errors.New("invalid token claims")
+	}
+	scope, _ := claims["scope"].(string)
+	return clientId, strings.Fields(scope), nil
+}
+
+// GeneratePurposeToken TODO: 1. Generate a token bound to a single purpose (e.g. unlock_account)
+func (ts *TokenService) GeneratePurposeToken(userId string, purpose string, expiration time.Duration) (string, error) {
+	claims := jwt.MapClaims{
+		"id":      userId,
+		"purpose": purpose,
+		"exp":     time.Now().Add(expiration).Unix(),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(ts.secret))
+}
+
+// ValidatePurposeToken TODO: 1. Validate the token, 2. Check it was issued for the given purpose, 3. Return user id
+func (ts *TokenService) ValidatePurposeToken(token string, purpose string) (string, error) {
+	claims, err := ts.parse(token)
+	if err != nil {
+		return "", err
+	}
+	if tokenPurpose, _ := claims["purpose"].(string); tokenPurpose != purpose {
+		return "", errors.New("invalid token purpose")
+	}
+	userId, ok := claims["id"].(string)
+	if !ok || userId == "" {
+		return "", errors.New("invalid token claims")
+	}
+	return userId, nil
+}
+
+func (ts *TokenService) parse(token string) (jwt.MapClaims, error) {
 	parser := jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 	parsedToken, err := parser.Parse(token, func(token *jwt.Token) (interface{}, error) {
 		return []byte(ts.secret), nil
 	})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	claims, ok := parsedToken.Claims.(jwt.MapClaims)
 	if !ok {
-		return "", err
+		return nil, errors.New("invalid token claims")
 	}
-	return claims["id"].(string), nil
+	return claims, nil
 }
 
 func (ts *TokenService) NewRefreshToken() (string, error) {
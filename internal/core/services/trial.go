@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"github.com/Lenstack/lensaas-app/internal/core/entities"
+	"github.com/Lenstack/lensaas-app/internal/core/repositories"
+	"github.com/Lenstack/lensaas-app/internal/templates"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"github.com/Masterminds/squirrel"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"sort"
+	"time"
+)
+
+const (
+	AuditTrialStarted = "trial.started"
+	AuditTrialExpired = "trial.expired"
+
+	trialBatchSize = 500
+)
+
+type ITrialService interface {
+	StartTrial(ctx context.Context, userId string) error
+	GetTrial(ctx context.Context, userId string) (trial entities.Trial, err error)
+	ProcessDue(ctx context.Context) error
+}
+
+type TrialService struct {
+	TrialRepository    repositories.TrialRepository
+	UserRepository     repositories.UserRepository
+	EmailService       EmailService
+	EntitlementService EntitlementService
+	AuditService       AuditService
+	// Plan is granted during the trial, trials are disabled when it is empty.
+	Plan   string
+	Length time.Duration
+	// Reminders are the offsets before the end of the trial at which a reminder is sent, the earliest first.
+	Reminders []time.Duration
+}
+
+// NewTrialService TODO: 1. Check the trial plan is a paid plan of the catalog, 2. Parse the length, 3. Parse the reminder offsets (e.g. 72h,24h)
+func NewTrialService(database squirrel.StatementBuilderType, redis *redis.Client, emailService EmailService, entitlementService EntitlementService, auditService AuditService, plan string, length string, reminders string) (*TrialService, error) {
+	if plan != "" {
+		found := false
+		for _, catalogPlan := range entitlementService.Catalog {
+			if catalogPlan.Name == plan && plan != PlanFree {
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("invalid trial plan %q", plan)
+		}
+	}
+	trialLength, err := time.ParseDuration(length)
+	if err != nil || trialLength <= 0 {
+		return nil, fmt.Errorf("invalid trial length %q", length)
+	}
+	offsets, err := parseReminders(reminders)
+	if err != nil {
+		return nil, fmt.Errorf("trial: %w", err)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] > offsets[j] })
+
+	return &TrialService{
+		TrialRepository: repositories.TrialRepository{
+			Database: database,
+		},
+		UserRepository: repositories.UserRepository{
+			Database: database,
+			Redis:    redis,
+		},
+		EmailService:       emailService,
+		EntitlementService: entitlementService,
+		AuditService:       auditService,
+		Plan:               plan,
+		Length:             trialLength,
+		Reminders:          offsets,
+	}, nil
+}
+
+// StartTrial TODO: 1. Start the trial of the plan, users who had one do not get another, 2. Grant its entitlements
+func (ts *TrialService) StartTrial(ctx context.Context, userId string) error {
+	ctx, span := tracer.Start(ctx, "TrialService.StartTrial")
+	defer span.End()
+
+	if ts.Plan == "" {
+		return nil
+	}
+	now := time.Now()
+	trial := entities.Trial{UserId: userId, Plan: ts.Plan, StartedAt: now, EndsAt: now.Add(ts.Length)}
+	created, err := ts.TrialRepository.Create(ctx, trial)
+	if err != nil || !created {
+		return err
+	}
+	err = ts.EntitlementService.Invalidate(ctx, userId)
+	if err != nil {
+		return err
+	}
+	ts.AuditService.Record(ctx, AuditTrialStarted, userId, map[string]interface{}{
+		"plan":    trial.Plan,
+		"ends_at": trial.EndsAt,
+	})
+	return nil
+}
+
+// GetTrial TODO: 1. Return the trial of the user
+func (ts *TrialService) GetTrial(ctx context.Context, userId string) (trial entities.Trial, err error) {
+	ctx, span := tracer.Start(ctx, "TrialService.GetTrial")
+	defer span.End()
+
+	return ts.TrialRepository.FindByUser(ctx, userId)
+}
+
+// ProcessDue TODO: 1. Find the running trials, 2. Send the reminders that came due, 3. Downgrade the trials that ended to the free plan
+func (ts *TrialService) ProcessDue(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "TrialService.ProcessDue")
+	defer span.End()
+
+	trials, err := ts.TrialRepository.FindRunning(ctx, trialBatchSize)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, trial := range trials {
+		if err := ts.process(ctx, trial, now); err != nil {
+			utils.Logger(ctx).Warn("trial will be retried", zap.String("user_id", trial.UserId), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// process sends the latest reminder that came due before the end of the trial, then expires it once it ended.
+func (ts *TrialService) process(ctx context.Context, trial entities.Trial, now time.Time) error {
+	if trial.Running(now) {
+		due := remindersDue(ts.Reminders, now, func(offset time.Duration) time.Time { return trial.EndsAt.Add(-offset) })
+		return remind(trial.RemindersSent, due, trial.LastReminderAt, now,
+			func(previous int, remindersSent int, remindedAt *time.Time) (bool, error) {
+				return ts.TrialRepository.UpdateRemindersSent(ctx, trial.UserId, previous, remindersSent, remindedAt)
+			},
+			func() error {
+				return notify(ctx, ts.UserRepository, ts.EmailService, trial.UserId, "internal/templates/trial_ending_template.html", "Your Trial Is Ending",
+					func(name string) interface{} {
+						return templates.TrialEnding{Name: name, Plan: trial.Plan, EndsAt: trial.EndsAt.Format("January 2, 2006")}
+					})
+			})
+	}
+
+	expired, err := ts.TrialRepository.Expire(ctx, trial.UserId, now)
+	if err != nil || !expired {
+		return err
+	}
+	err = ts.EntitlementService.Invalidate(ctx, trial.UserId)
+	if err != nil {
+		return err
+	}
+	ts.AuditService.Record(ctx, AuditTrialExpired, trial.UserId, map[string]interface{}{
+		"plan": trial.Plan,
+	})
+	return notify(ctx, ts.UserRepository, ts.EmailService, trial.UserId, "internal/templates/trial_expired_template.html", "Your Trial Has Ended",
+		func(name string) interface{} {
+			return templates.TrialExpired{Name: name, Plan: trial.Plan}
+		})
+}
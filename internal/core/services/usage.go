@@ -0,0 +1,303 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Lenstack/lensaas-app/internal/core/billing"
+	"github.com/Lenstack/lensaas-app/internal/core/entities"
+	"github.com/Lenstack/lensaas-app/internal/core/repositories"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	MetricApiCalls = LimitApiCalls
+
+	// usagePendingKey holds the counters since the last aggregation, fields are <user id>:<metric>.
+	usagePendingKey = "usage:pending"
+	// usageFlushingPrefix names the counters being aggregated, leftovers of a failed run are picked up by the next one.
+	usageFlushingPrefix = "usage:flushing:"
+	// usageLockPrefix keeps other replicas off a flushing key while it is aggregated.
+	usageLockPrefix = "usage:lock:"
+	usageLockTTL    = 5 * time.Minute
+	usageBatchSize  = 500
+	// usageReportDeadline is how long after the end of a period the provider may still accept its usage.
+	usageReportDeadline = 24 * time.Hour
+)
+
+// Metrics lists every metered metric.
+var Metrics = []string{MetricApiCalls}
+
+// UsageSummary is the usage of a metric over the current period, Limit comes from the plan of the user.
+type UsageSummary struct {
+	Metric      string
+	Quantity    int64
+	Limit       int64
+	PeriodStart time.Time
+	PeriodEnd   time.Time
+}
+
+type IUsageService interface {
+	Record(ctx context.Context, userId string, metric string, quantity int64) error
+	Aggregate(ctx context.Context) error
+	Report(ctx context.Context) error
+	Summary(ctx context.Context, userId string) (summaries []UsageSummary, err error)
+	RequireQuota(ctx context.Context, userId string, metric string) error
+}
+
+type UsageService struct {
+	UsageRecordRepository  repositories.UsageRecordRepository
+	SubscriptionRepository repositories.SubscriptionRepository
+	BillingService         BillingService
+	EntitlementService     EntitlementService
+	Redis                  *redis.Client
+}
+
+func NewUsageService(database squirrel.StatementBuilderType, redis *redis.Client, billingService BillingService, entitlementService EntitlementService) *UsageService {
+	return &UsageService{
+		UsageRecordRepository: repositories.UsageRecordRepository{
+			Database: database,
+		},
+		SubscriptionRepository: repositories.SubscriptionRepository{
+			Database: database,
+		},
+		BillingService:     billingService,
+		EntitlementService: entitlementService,
+		Redis:              redis,
+	}
+}
+
+// Record TODO: 1. Add the quantity to the pending counter of the user and metric, it is cheap enough for every request
+func (us *UsageService) Record(ctx context.Context, userId string, metric string, quantity int64) error {
+	return us.Redis.HIncrBy(ctx, usagePendingKey, userId+":"+metric, quantity).Err()
+}
+
+// Aggregate TODO: 1. Move the pending counters aside, new usage keeps counting, 2. Lock every flushing key, 3. Add every counter to the usage of the current period in postgres once, 4. Drop counters once stored
+func (us *UsageService) Aggregate(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "UsageService.Aggregate")
+	defer span.End()
+
+	pending, err := us.Redis.Exists(ctx, usagePendingKey).Result()
+	if err != nil {
+		return err
+	}
+	if pending > 0 {
+		err = us.Redis.Rename(ctx, usagePendingKey, usageFlushingPrefix+uuid.New().String()).Err()
+		if err != nil {
+			return err
+		}
+	}
+
+	var keys []string
+	iterator := us.Redis.Scan(ctx, 0, usageFlushingPrefix+"*", 100).Iterator()
+	for iterator.Next(ctx) {
+		keys = append(keys, iterator.Val())
+	}
+	if err := iterator.Err(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	periods := map[string][2]time.Time{}
+	for _, key := range keys {
+		err = us.flush(ctx, key, now, periods)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flush adds the counters of the flushing key to postgres while holding its lock. The counters are marked in the same
+// statement, a counter added before a failure is only dropped by the next run, then the markers go with the drained key.
+func (us *UsageService) flush(ctx context.Context, key string, now time.Time, periods map[string][2]time.Time) error {
+	locked, err := us.Redis.SetNX(ctx, usageLockPrefix+key, "1", usageLockTTL).Result()
+	if err != nil || !locked {
+		return err
+	}
+	defer us.Redis.Del(ctx, usageLockPrefix+key)
+
+	counters, err := us.Redis.HGetAll(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	for field, value := range counters {
+		parts := strings.SplitN(field, ":", 2)
+		quantity, err := strconv.ParseInt(value, 10, 64)
+		if len(parts) != 2 || err != nil {
+			utils.Logger(ctx).Warn("invalid usage counter dropped", zap.String("field", field))
+			us.Redis.HDel(ctx, key, field)
+			continue
+		}
+
+		period, ok := periods[parts[0]]
+		if !ok {
+			periodStart, periodEnd, err := us.period(ctx, parts[0], now)
+			if err != nil {
+				return err
+			}
+			period = [2]time.Time{periodStart, periodEnd}
+			periods[parts[0]] = period
+		}
+
+		_, err = us.UsageRecordRepository.Add(ctx, key, field, entities.UsageRecord{
+			Id:          uuid.New().String(),
+			UserId:      parts[0],
+			Metric:      parts[1],
+			PeriodStart: period[0],
+			PeriodEnd:   period[1],
+			Quantity:    quantity,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		})
+		var pqError *pq.Error
+		if errors.As(err, &pqError) && pqError.Code == "23503" {
+			utils.Logger(ctx).Warn("usage of a deleted user dropped", zap.String("user_id", parts[0]))
+		} else if err != nil {
+			return err
+		}
+		err = us.Redis.HDel(ctx, key, field).Err()
+		if err != nil {
+			return err
+		}
+	}
+
+	// The last HDel removed the key, no run picks it up again.
+	_, err = us.UsageRecordRepository.DeleteFlush(ctx, key)
+	return err
+}
+
+// Report TODO: 1. Find usage not reported yet, 2. Send the difference to the metered item of the subscription with an idempotency key, 3. Usage without a metered subscription or provider is not billed
+func (us *UsageService) Report(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "UsageService.Report")
+	defer span.End()
+
+	usageRecords, err := us.UsageRecordRepository.FindUnreported(ctx, usageBatchSize)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, usageRecord := range usageRecords {
+		subscription, err := us.SubscriptionRepository.FindCurrentByUser(ctx, usageRecord.UserId)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if err != nil || subscription.MeteredItemId == "" || !grantsPlan(subscription) {
+			_, err = us.UsageRecordRepository.UpdateReportedQuantity(ctx, usageRecord.Id, usageRecord.Quantity, now)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		provider, err := us.BillingService.Provider(subscription.Provider)
+		if err != nil {
+			return err
+		}
+		// Providers only accept usage inside the period it belongs to.
+		timestamp := now
+		if !timestamp.Before(usageRecord.PeriodEnd) {
+			timestamp = usageRecord.PeriodEnd.Add(-time.Second)
+		}
+		err = provider.ReportUsage(ctx, billing.UsageParams{
+			ItemId:    subscription.MeteredItemId,
+			Quantity:  usageRecord.Quantity - usageRecord.ReportedQuantity,
+			Timestamp: timestamp,
+			// The key changes with the quantity, a retry of the same report is never counted twice.
+			IdempotencyKey: fmt.Sprintf("usage-%s-%d", usageRecord.Id, usageRecord.Quantity),
+		})
+		if err != nil && !errors.Is(err, billing.ErrNotSupported) {
+			if now.Sub(usageRecord.PeriodEnd) < usageReportDeadline {
+				utils.Logger(ctx).Warn("usage report will be retried", zap.String("usage_record_id", usageRecord.Id), zap.Error(err))
+				continue
+			}
+			utils.Logger(ctx).Error("usage could not be reported", zap.String("usage_record_id", usageRecord.Id),
+				zap.Int64("quantity", usageRecord.Quantity-usageRecord.ReportedQuantity), zap.Error(err))
+		}
+
+		_, err = us.UsageRecordRepository.UpdateReportedQuantity(ctx, usageRecord.Id, usageRecord.Quantity, now)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Summary TODO: 1. Find the current period of the user, 2. Add the stored usage and the pending counters of every metric, 3. Return them with the limits of the plan
+func (us *UsageService) Summary(ctx context.Context, userId string) (summaries []UsageSummary, err error) {
+	ctx, span := tracer.Start(ctx, "UsageService.Summary")
+	defer span.End()
+
+	periodStart, periodEnd, err := us.period(ctx, userId, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	usageRecords, err := us.UsageRecordRepository.FindByPeriod(ctx, userId, periodStart)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, metric := range Metrics {
+		summary := UsageSummary{Metric: metric, PeriodStart: periodStart, PeriodEnd: periodEnd}
+		for _, usageRecord := range usageRecords {
+			if usageRecord.Metric == metric {
+				summary.Quantity += usageRecord.Quantity
+			}
+		}
+		pending, err := us.Redis.HGet(ctx, usagePendingKey, userId+":"+metric).Int64()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return nil, err
+		}
+		summary.Quantity += pending
+
+		summary.Limit, err = us.EntitlementService.Limit(ctx, userId, metric)
+		if err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+// RequireQuota TODO: 1. Read the usage of the metric over the current period, 2. Return an EntitlementError with the upgrade hint once the plan limit is used up
+func (us *UsageService) RequireQuota(ctx context.Context, userId string, metric string) error {
+	ctx, span := tracer.Start(ctx, "UsageService.RequireQuota")
+	defer span.End()
+
+	summaries, err := us.Summary(ctx, userId)
+	if err != nil {
+		return err
+	}
+	for _, summary := range summaries {
+		if summary.Metric == metric && summary.Limit != Unlimited && summary.Quantity >= summary.Limit {
+			return us.EntitlementService.RequireLimit(ctx, userId, metric, summary.Quantity)
+		}
+	}
+	return nil
+}
+
+// period returns the billing period of the subscription of the user at the given time, the calendar month without one.
+func (us *UsageService) period(ctx context.Context, userId string, at time.Time) (periodStart time.Time, periodEnd time.Time, err error) {
+	subscription, err := us.SubscriptionRepository.FindCurrentByUser(ctx, userId)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, time.Time{}, err
+	}
+	if err == nil && grantsPlan(subscription) && subscription.CurrentPeriodStart != nil && subscription.CurrentPeriodEnd != nil &&
+		!at.Before(*subscription.CurrentPeriodStart) && at.Before(*subscription.CurrentPeriodEnd) {
+		return subscription.CurrentPeriodStart.UTC(), subscription.CurrentPeriodEnd.UTC(), nil
+	}
+
+	at = at.UTC()
+	periodStart = time.Date(at.Year(), at.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return periodStart, periodStart.AddDate(0, 1, 0), nil
+}
@@ -1,91 +1,335 @@
 package services
 
 import (
+	"context"
+	"database/sql"
 	"errors"
-	"fmt"
 	"github.com/Lenstack/lensaas-app/internal/core/entities"
 	"github.com/Lenstack/lensaas-app/internal/core/repositories"
 	"github.com/Lenstack/lensaas-app/internal/templates"
 	"github.com/Lenstack/lensaas-app/internal/utils"
 	"github.com/Masterminds/squirrel"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
 	"strings"
 	"time"
 )
 
 type IUserService interface {
-	SignIn(email string, password string) (accessToken string, refreshToken string, expiresIn time.Duration, err error)
-	SignUp(user entities.User) (message string, err error)
-	SignOut(token string) (message string, err error)
-	SendVerificationCode(name, email string) (message string, err error)
-	SendVerificationEmail(name, email string) (message string, err error)
-	VerifyEmail(token string) (message string, err error)
-	VerifyCode(token string, code string) (message string, err error)
-	RefreshToken(refreshToken string) (token string, expiresIn time.Duration, err error)
-	RevokeToken(token string) (message string, err error)
+	SignIn(ctx context.Context, email string, password string) (accessToken string, refreshToken string, expiresIn time.Duration, err error)
+	SignUp(ctx context.Context, user entities.User) (message string, err error)
+	SignOut(ctx context.Context, token string) (message string, err error)
+	SendVerificationCode(ctx context.Context, name, email string) (message string, err error)
+	SendVerificationEmail(ctx context.Context, name, email string) (message string, err error)
+	VerifyEmail(ctx context.Context, token string) (message string, err error)
+	VerifyCode(ctx context.Context, token string, code string) (message string, err error)
+	RefreshToken(ctx context.Context, refreshToken string) (token string, expiresIn time.Duration, err error)
+	RevokeToken(ctx context.Context, token string) (message string, err error)
+	UnlockAccount(ctx context.Context, token string) (message string, err error)
+	UnlockUser(ctx context.Context, userId string) (message string, err error)
+	HasRole(ctx context.Context, userId string, role string) (bool, error)
+	PasswordForgot(ctx context.Context, email string) (message string, err error)
+	PasswordReset(ctx context.Context, token string, password string) (message string, err error)
+	ChangePassword(ctx context.Context, userId string, currentPassword string, newPassword string) (accessToken string, refreshToken string, expiresIn time.Duration, err error)
+	ChangeEmail(ctx context.Context, userId string, password string, email string) (message string, err error)
+	ConfirmEmailChange(ctx context.Context, token string) (message string, err error)
+	Reauthenticate(ctx context.Context, userId string, password string) (token string, expiresIn time.Duration, err error)
+	Impersonate(ctx context.Context, userId string, reason string) (token string, expiresIn time.Duration, err error)
 }
 
+const (
+	PurposeUnlockAccount = "unlock_account"
+	PurposePasswordReset = "password_reset"
+	PurposeChangeEmail   = "change_email"
+	PurposeVerifyEmail   = "verify_email"
+)
+
+var ErrInvalidCredentials = errors.New("invalid email or password")
+
 type UserService struct {
 	UserRepository repositories.UserRepository
 	TokenService   TokenService
 	EmailService   EmailService
-	bcrypt         *utils.Bcrypt
+	Metrics        MetricsService
+	Lockout        LockoutPolicy
+	PasswordPolicy PasswordPolicyService
+	Hasher         utils.PasswordHasher
+	AuditService   AuditService
+	BillingService BillingService
+	TrialService   TrialService
+	dummyPassword  string
 }
 
-func NewUserService(database squirrel.StatementBuilderType, redis *redis.Client, tokenService TokenService, emailService EmailService) *UserService {
+func NewUserService(database squirrel.StatementBuilderType, redis *redis.Client, tokenService TokenService, emailService EmailService, metricsService MetricsService, lockoutPolicy LockoutPolicy, passwordPolicyService PasswordPolicyService, passwordHasher utils.PasswordHasher, auditService AuditService, billingService BillingService, trialService TrialService) *UserService {
+	dummyPassword, err := passwordHasher.HashPassword(uuid.New().String())
+	if err != nil {
+		panic(err)
+	}
 	return &UserService{
 		UserRepository: repositories.UserRepository{
 			Database: database,
 			Redis:    redis,
 		},
-		TokenService: tokenService,
-		EmailService: emailService,
+		TokenService:   tokenService,
+		EmailService:   emailService,
+		Metrics:        metricsService,
+		Lockout:        lockoutPolicy,
+		PasswordPolicy: passwordPolicyService,
+		Hasher:         passwordHasher,
+		AuditService:   auditService,
+		BillingService: billingService,
+		TrialService:   trialService,
+		dummyPassword:  dummyPassword,
 	}
 }
 
-// SignIn TODO: 1. Check if user exists, 2. If user exists, check if password is correct, 3. If password is correct, generate token, 4. Return token
-func (us *UserService) SignIn(email string, password string) (accessToken string, refreshToken string, expiresIn time.Duration, err error) {
-	user, err := us.UserRepository.FindByEmail(email)
+// SignIn TODO: 1. Check if user exists, 2. Check the account is not locked, 3. Check the password and track failures, 4. Generate token, 5. Return token
+func (us *UserService) SignIn(ctx context.Context, email string, password string) (accessToken string, refreshToken string, expiresIn time.Duration, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.SignIn")
+	defer span.End()
+
+	user, err := us.UserRepository.FindByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Compare against a dummy hash so unknown emails take as long as registered ones.
+		_, _ = us.Hasher.VerifyPassword(us.dummyPassword, password)
+		us.Metrics.IncSignIn("user_not_found")
+		us.AuditService.Record(ctx, AuditSignInFailed, "", map[string]interface{}{"reason": "user_not_found"})
+		return "", "", 0, ErrInvalidCredentials
+	}
+	if err != nil {
+		us.Metrics.IncSignIn("error")
+		return "", "", 0, err
+	}
+
+	err = us.checkSignInLock(ctx, user)
 	if err != nil {
+		us.Metrics.IncSignIn("locked")
+		us.AuditService.Record(ctx, AuditSignInFailed, user.Id, map[string]interface{}{"reason": "locked"})
 		return "", "", 0, err
 	}
 
+	needsRehash, err := us.Hasher.VerifyPassword(user.Password, password)
+	if err != nil {
+		us.Metrics.IncSignIn("invalid_password")
+		us.AuditService.Record(ctx, AuditSignInFailed, user.Id, map[string]interface{}{"reason": "invalid_password"})
+		err = us.registerSignInFailure(ctx, user)
+		if err != nil {
+			return "", "", 0, err
+		}
+		return "", "", 0, ErrInvalidCredentials
+	}
+
 	if !user.Verified {
+		us.Metrics.IncSignIn("not_verified")
+		us.AuditService.Record(ctx, AuditSignInFailed, user.Id, map[string]interface{}{"reason": "not_verified"})
 		return "", "", 0, errors.New("user is not verified")
 	}
 
-	err = us.bcrypt.ComparePassword(user.Password, password)
+	if user.DeactivatedAt != nil {
+		us.Metrics.IncSignIn("deactivated")
+		us.AuditService.Record(ctx, AuditSignInFailed, user.Id, map[string]interface{}{"reason": "deactivated"})
+		return "", "", 0, errors.New("account is scheduled for deletion, check your email to restore it")
+	}
+
+	_, err = us.UserRepository.DeleteSignInFailures(ctx, user.Id)
 	if err != nil {
+		us.Metrics.IncSignIn("error")
 		return "", "", 0, err
 	}
 
-	accessToken, err = us.TokenService.GenerateToken(user.Id, us.TokenService.ExpirationTimeAccess)
+	if needsRehash {
+		us.rehashPassword(ctx, user.Id, password)
+	}
+
+	accessToken, refreshToken, expiresIn, err = us.issueTokens(ctx, user.Id, utils.AuthenticationInfo{Time: time.Now(), Methods: []string{AuthMethodPassword}})
 	if err != nil {
+		us.Metrics.IncSignIn("error")
 		return "", "", 0, err
 	}
 
-	refreshToken, err = us.TokenService.GenerateToken(user.Id, us.TokenService.ExpirationTimeRefresh)
+	us.Metrics.IncSignIn("success")
+	us.AuditService.Record(ctx, AuditSignInSucceeded, user.Id, map[string]interface{}{"amr": []string{AuthMethodPassword}})
+	return accessToken, refreshToken, expiresIn, nil
+}
+
+// issueTokens TODO: 1. Generate access and refresh token, 2. Save refresh token, 3. Return tokens
+func (us *UserService) issueTokens(ctx context.Context, userId string, authentication utils.AuthenticationInfo) (accessToken string, refreshToken string, expiresIn time.Duration, err error) {
+	accessToken, err = us.TokenService.GenerateAccessToken(userId, authentication, us.TokenService.ExpirationTimeAccess)
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	// The refresh token carries the original auth_time, refreshing must not count as a new authentication.
+	refreshToken, err = us.TokenService.GenerateAccessToken(userId, authentication, us.TokenService.ExpirationTimeRefresh)
 	if err != nil {
 		return "", "", 0, err
 	}
 
-	_, err = us.UserRepository.SaveRefreshToken(user.Id, refreshToken, us.TokenService.ExpirationTimeRefresh)
+	_, err = us.UserRepository.SaveRefreshToken(ctx, userId, refreshToken, us.TokenService.ExpirationTimeRefresh)
 	if err != nil {
 		return "", "", 0, err
 	}
 
+	us.Metrics.IncToken("issued")
 	return accessToken, refreshToken, us.TokenService.ExpirationTimeAccess, nil
 }
 
+// rehashPassword TODO: 1. Hash the password with the current algorithm and parameters, 2. Store it, failures only delay the upgrade
+func (us *UserService) rehashPassword(ctx context.Context, userId string, password string) {
+	hashedPassword, err := us.Hasher.HashPassword(password)
+	if err == nil {
+		_, err = us.UserRepository.UpdatePassword(ctx, userId, hashedPassword)
+	}
+	if err != nil {
+		utils.Logger(ctx).Warn("password rehash failed", zap.Error(err))
+		return
+	}
+	utils.Logger(ctx).Info("password hash upgraded", zap.String("algorithm", us.Hasher.Algorithm))
+}
+
+// checkSignInLock TODO: 1. Reject while the account is locked, 2. Reject while the exponential back-off is running
+func (us *UserService) checkSignInLock(ctx context.Context, user entities.User) error {
+	lockExpiresIn, err := us.UserRepository.FindSignInLock(ctx, user.Id)
+	if err != nil {
+		return err
+	}
+	if lockExpiresIn > 0 {
+		return &LockoutError{Locked: true, RetryAfter: lockExpiresIn}
+	}
+
+	failures, lastFailure, err := us.UserRepository.FindSignInFailures(ctx, user.Id)
+	if err != nil {
+		return err
+	}
+	if wait := us.Lockout.Delay(failures) - time.Since(lastFailure); wait > 0 {
+		return &LockoutError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// registerSignInFailure TODO: 1. Increment the failure counter, 2. Lock the account and send the unlock email once the limit is reached
+func (us *UserService) registerSignInFailure(ctx context.Context, user entities.User) error {
+	failures, err := us.UserRepository.IncrementSignInFailures(ctx, user.Id, us.Lockout.Duration)
+	if err != nil {
+		return err
+	}
+	if failures < us.Lockout.MaxAttempts {
+		return nil
+	}
+
+	_, err = us.UserRepository.SaveSignInLock(ctx, user.Id, us.Lockout.Duration)
+	if err != nil {
+		return err
+	}
+	utils.Logger(ctx).Warn("account locked after failed sign-in attempts",
+		zap.String("user_id", user.Id), zap.Int("failures", failures))
+	us.AuditService.Record(ctx, AuditAccountLocked, user.Id, map[string]interface{}{"failures": failures, "duration": us.Lockout.Duration.String()})
+
+	token, err := us.TokenService.GeneratePurposeToken(user.Id, PurposeUnlockAccount, us.Lockout.Duration)
+	if err != nil {
+		return err
+	}
+
+	mail, err := us.EmailService.Create("internal/templates/unlock_account_template.html", []string{user.Email},
+		"Unlock Your Account", templates.UnlockAccount{Name: strings.ToTitle(user.Name), Token: token}, []string{})
+	if err != nil {
+		return err
+	}
+
+	err = us.EmailService.Send(ctx, mail)
+	if err != nil {
+		return err
+	}
+
+	return &LockoutError{Locked: true, RetryAfter: us.Lockout.Duration}
+}
+
+// VerifyCurrentPassword TODO: 1. Check the sign-in lockout, 2. Verify the password, failures count towards the lockout, a stolen access token must not allow guessing it, 3. Reset the failures
+func (us *UserService) VerifyCurrentPassword(ctx context.Context, user entities.User, password string) error {
+	err := us.checkSignInLock(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	_, err = us.Hasher.VerifyPassword(user.Password, password)
+	if err != nil {
+		err = us.registerSignInFailure(ctx, user)
+		if err != nil {
+			return err
+		}
+		return errors.New("current password is incorrect")
+	}
+
+	_, err = us.UserRepository.DeleteSignInFailures(ctx, user.Id)
+	return err
+}
+
+// UnlockAccount TODO: 1. Validate the unlock token sent by email, 2. Remove the lock, 3. Return success message
+func (us *UserService) UnlockAccount(ctx context.Context, token string) (message string, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.UnlockAccount")
+	defer span.End()
+
+	userId, err := us.TokenService.ValidatePurposeToken(token, PurposeUnlockAccount)
+	if err != nil {
+		return "", errors.New("invalid token")
+	}
+
+	_, err = us.UserRepository.DeleteSignInLock(ctx, userId)
+	if err != nil {
+		return "", err
+	}
+
+	us.AuditService.Record(ctx, AuditAccountUnlocked, userId, nil)
+	return "your account has been unlocked successfully", nil
+}
+
+// UnlockUser TODO: 1. Check the user exists, 2. Remove the lock on behalf of an administrator, 3. Return success message
+func (us *UserService) UnlockUser(ctx context.Context, userId string) (message string, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.UnlockUser")
+	defer span.End()
+
+	user, err := us.UserRepository.FindById(ctx, userId)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = us.UserRepository.DeleteSignInLock(ctx, user.Id)
+	if err != nil {
+		return "", err
+	}
+
+	utils.Logger(ctx).Info("account unlocked by administrator", zap.String("target_user_id", user.Id))
+	us.AuditService.Record(ctx, AuditUserUnlocked, user.Id, nil)
+	return "the account has been unlocked successfully", nil
+}
+
+// HasRole TODO: 1. Find user by id, 2. Compare the user role
+func (us *UserService) HasRole(ctx context.Context, userId string, role string) (bool, error) {
+	user, err := us.UserRepository.FindById(ctx, userId)
+	if err != nil {
+		return false, err
+	}
+	return user.Role == role, nil
+}
+
 // SignUp TODO: 1. Check if user already exists, 2. If user does not exist, create user, 3. Send email to user, 4. Return success message
-func (us *UserService) SignUp(user entities.User) (message string, err error) {
-	isFounded, err := us.UserRepository.FindByEmail(user.Email)
+func (us *UserService) SignUp(ctx context.Context, user entities.User) (message string, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.SignUp")
+	defer span.End()
+
+	isFounded, err := us.UserRepository.FindByEmail(ctx, user.Email)
 	if isFounded.Id != "" {
 		return "", errors.New("user already exists")
 	}
 
-	hashedPassword, err := us.bcrypt.HashPassword(user.Password)
+	err = us.PasswordPolicy.Validate(ctx, user.Password, user.Name, user.Email)
+	if err != nil {
+		return "", err
+	}
+
+	hashedPassword, err := us.Hasher.HashPassword(user.Password)
 	if err != nil {
 		return "", err
 	}
@@ -95,14 +339,16 @@ func (us *UserService) SignUp(user entities.User) (message string, err error) {
 		Email:    user.Email,
 		Name:     user.Name,
 		Password: hashedPassword,
+		Role:     entities.RoleUser,
 	}
 
-	userId, err := us.UserRepository.Create(newUser)
+	userId, err := us.UserRepository.Create(ctx, newUser)
 	if err != nil {
 		return "", err
 	}
+	us.AuditService.Record(ctx, AuditSignedUp, newUser.Id, nil)
 
-	_, err = us.SendVerificationEmail(user.Name, user.Email)
+	_, err = us.SendVerificationEmail(ctx, user.Name, user.Email)
 	if err != nil {
 		return "", err
 	}
@@ -111,22 +357,28 @@ func (us *UserService) SignUp(user entities.User) (message string, err error) {
 }
 
 // SignOut TODO: 1. Check if user exists, 2. If user exists, delete token, 3. Return success message
-func (us *UserService) SignOut(token string) (message string, err error) {
+func (us *UserService) SignOut(ctx context.Context, token string) (message string, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.SignOut")
+	defer span.End()
+
 	userId, err := us.TokenService.ValidateToken(token)
 	if err != nil {
 		return "", err
 	}
 
-	fmt.Println("revoke token for user: ", userId)
+	utils.Logger(ctx).Debug("revoke token for user", zap.String("user_id", userId))
 	return "", nil
 }
 
 // SendVerificationCode TODO: 1. Generate verification code, 2. Send email to user, 3. Return success message
-func (us *UserService) SendVerificationCode(name, email string) (message string, err error) {
+func (us *UserService) SendVerificationCode(ctx context.Context, name, email string) (message string, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.SendVerificationCode")
+	defer span.End()
+
 	code := utils.NewCode()
 	sendExpiresAt := time.Now().Add(time.Minute * 5)
 
-	message, err = us.UserRepository.UpdateVerificationCode(email, code, sendExpiresAt)
+	message, err = us.UserRepository.UpdateVerificationCode(ctx, email, code, sendExpiresAt)
 	if err != nil {
 		return "", err
 	}
@@ -137,7 +389,7 @@ func (us *UserService) SendVerificationCode(name, email string) (message string,
 		return "", err
 	}
 
-	err = us.EmailService.Send(mail)
+	err = us.EmailService.Send(ctx, mail)
 	if err != nil {
 		return "", err
 	}
@@ -146,16 +398,19 @@ func (us *UserService) SendVerificationCode(name, email string) (message string,
 }
 
 // SendVerificationEmail TODO: 1. Generate verification token, 2. Send email to user, 3. Return success message
-func (us *UserService) SendVerificationEmail(name, email string) (message string, err error) {
+func (us *UserService) SendVerificationEmail(ctx context.Context, name, email string) (message string, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.SendVerificationEmail")
+	defer span.End()
+
 	inFiveMinutes := time.Now().Add(time.Minute * 5)
 	expiration := inFiveMinutes.Sub(time.Now())
 
-	user, err := us.UserRepository.FindByEmail(email)
+	user, err := us.UserRepository.FindByEmail(ctx, email)
 	if err != nil {
 		return "", err
 	}
 
-	token, err := us.TokenService.GenerateToken(user.Id, expiration)
+	token, err := us.TokenService.GeneratePurposeToken(user.Id, PurposeVerifyEmail, expiration)
 	if err != nil {
 		return "", err
 	}
@@ -166,7 +421,7 @@ func (us *UserService) SendVerificationEmail(name, email string) (message string
 		return "", err
 	}
 
-	err = us.EmailService.Send(mail)
+	err = us.EmailService.Send(ctx, mail)
 	if err != nil {
 		return "", err
 	}
@@ -175,13 +430,16 @@ func (us *UserService) SendVerificationEmail(name, email string) (message string
 }
 
 // VerifyEmail TODO: 1. Get token from request, 2. Validate token, 3. Call EmailVerification method from UserService, 4. Return success message
-func (us *UserService) VerifyEmail(token string) (message string, err error) {
-	userId, err := us.TokenService.ValidateToken(token)
+func (us *UserService) VerifyEmail(ctx context.Context, token string) (message string, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.VerifyEmail")
+	defer span.End()
+
+	userId, err := us.TokenService.ValidatePurposeToken(token, PurposeVerifyEmail)
 	if err != nil {
 		return "", errors.New("invalid token")
 	}
 
-	user, err := us.UserRepository.FindById(userId)
+	user, err := us.UserRepository.FindById(ctx, userId)
 	if err != nil {
 		return "", err
 	}
@@ -190,22 +448,38 @@ func (us *UserService) VerifyEmail(token string) (message string, err error) {
 		return "", errors.New("user is already verified")
 	}
 
-	_, err = us.UserRepository.UpdateVerified(user.Email, true)
+	_, err = us.UserRepository.UpdateVerified(ctx, user.Email, true)
 	if err != nil {
 		return "", err
 	}
 
+	us.AuditService.Record(ctx, AuditEmailVerified, user.Id, map[string]interface{}{"method": "link"})
+
+	// Billing must not block the verification, the customer is created again on the first billing request.
+	_, _, err = us.BillingService.CreateCustomer(ctx, user.Id, "")
+	if err != nil {
+		utils.Logger(ctx).Warn("billing customer creation failed", zap.Error(err))
+	}
+	// The trial needs no payment method, it starts with the verified email.
+	err = us.TrialService.StartTrial(ctx, user.Id)
+	if err != nil {
+		utils.Logger(ctx).Warn("trial start failed", zap.Error(err))
+	}
+
 	return "your email has been verified successfully", nil
 }
 
 // VerifyCode TODO: 1. Get code from request, 2. Validate code, 3. Call EmailVerification method from UserService, 4. Return success message
-func (us *UserService) VerifyCode(token string, code string) (message string, err error) {
-	userId, err := us.TokenService.ValidateToken(token)
+func (us *UserService) VerifyCode(ctx context.Context, token string, code string) (message string, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.VerifyCode")
+	defer span.End()
+
+	userId, err := us.TokenService.ValidatePurposeToken(token, PurposeVerifyEmail)
 	if err != nil {
 		return "", errors.New("invalid token")
 	}
 
-	user, err := us.UserRepository.FindById(userId)
+	user, err := us.UserRepository.FindById(ctx, userId)
 	if err != nil {
 		return "", err
 	}
@@ -223,13 +497,16 @@ func (us *UserService) VerifyCode(token string, code string) (message string, er
 }
 
 // RefreshToken TODO: 1. Get refresh token from request, 2. Validate refresh token, 3. Generate new token, 4. Return new token
-func (us *UserService) RefreshToken(refreshToken string) (token string, expiresIn time.Duration, err error) {
-	userId, err := us.TokenService.ValidateToken(refreshToken)
+func (us *UserService) RefreshToken(ctx context.Context, refreshToken string) (token string, expiresIn time.Duration, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.RefreshToken")
+	defer span.End()
+
+	userId, authentication, err := us.TokenService.ValidateAccessToken(refreshToken)
 	if err != nil {
 		return "", 0, errors.New("invalid refresh token")
 	}
 
-	refreshTokenList, err := us.UserRepository.FindRefreshToken(userId)
+	refreshTokenList, err := us.UserRepository.FindRefreshToken(ctx, userId)
 	if err != nil {
 		return "", 0, err
 	}
@@ -249,25 +526,353 @@ func (us *UserService) RefreshToken(refreshToken string) (token string, expiresI
 		return "", 0, errors.New("invalid refresh token")
 	}
 
-	token, err = us.TokenService.GenerateToken(userId, us.TokenService.ExpirationTimeAccess)
+	token, err = us.TokenService.GenerateAccessToken(userId, authentication, us.TokenService.ExpirationTimeAccess)
 	if err != nil {
 		return "", 0, err
 	}
 
+	us.Metrics.IncToken("refreshed")
+	us.AuditService.Record(ctx, AuditTokenRefreshed, userId, nil)
 	return token, us.TokenService.ExpirationTimeAccess, nil
 }
 
 // RevokeToken TODO: 1. Get refresh token from request, 2. Validate refresh token, 3. Block refresh token, 4. Return success message
-func (us *UserService) RevokeToken(refreshToken string) (message string, err error) {
+func (us *UserService) RevokeToken(ctx context.Context, refreshToken string) (message string, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.RevokeToken")
+	defer span.End()
+
 	userId, err := us.TokenService.ValidateToken(refreshToken)
 	if err != nil {
 		return "", errors.New("invalid refresh token")
 	}
 
-	message, err = us.UserRepository.BlockRefreshToken(userId, refreshToken)
+	message, err = us.UserRepository.BlockRefreshToken(ctx, userId, refreshToken)
 	if err != nil {
 		return "", err
 	}
 
+	us.Metrics.IncToken("revoked")
+	us.AuditService.Record(ctx, AuditTokenRevoked, userId, nil)
 	return message, nil
 }
+
+// PasswordForgot TODO: 1. Find user by email, 2. Generate a single use reset token, 3. Send email to user, 4. Return the same message whether the user exists or not
+func (us *UserService) PasswordForgot(ctx context.Context, email string) (message string, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.PasswordForgot")
+	defer span.End()
+
+	message = "if the email is registered you will receive a link to reset your password"
+	user, err := us.UserRepository.FindByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return message, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	expiration := time.Minute * 15
+	token, err := us.TokenService.GeneratePurposeToken(user.Id, PurposePasswordReset, expiration)
+	if err != nil {
+		return "", err
+	}
+
+	// Only the last issued token is kept, which makes every link single use.
+	_, err = us.UserRepository.SavePasswordResetToken(ctx, user.Id, token, expiration)
+	if err != nil {
+		return "", err
+	}
+
+	mail, err := us.EmailService.Create("internal/templates/password_reset_template.html", []string{user.Email},
+		"Reset Your Password", templates.PasswordReset{Name: strings.ToTitle(user.Name), Token: token}, []string{})
+	if err != nil {
+		return "", err
+	}
+
+	err = us.EmailService.Send(ctx, mail)
+	if err != nil {
+		return "", err
+	}
+
+	us.AuditService.Record(ctx, AuditPasswordResetRequested, user.Id, nil)
+	return message, nil
+}
+
+// PasswordReset TODO: 1. Validate the reset token, 2. Validate the new password against the policy, 3. Update the password, 4. Revoke sessions and return success message
+func (us *UserService) PasswordReset(ctx context.Context, token string, password string) (message string, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.PasswordReset")
+	defer span.End()
+
+	userId, err := us.TokenService.ValidatePurposeToken(token, PurposePasswordReset)
+	if err != nil {
+		return "", errors.New("invalid token")
+	}
+
+	pendingToken, err := us.UserRepository.FindPasswordResetToken(ctx, userId)
+	if err != nil || pendingToken != token {
+		return "", errors.New("invalid token")
+	}
+
+	user, err := us.UserRepository.FindById(ctx, userId)
+	if err != nil {
+		return "", err
+	}
+
+	err = us.PasswordPolicy.Validate(ctx, password, user.Name, user.Email)
+	if err != nil {
+		return "", err
+	}
+
+	hashedPassword, err := us.Hasher.HashPassword(password)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = us.UserRepository.UpdatePassword(ctx, user.Id, hashedPassword)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = us.UserRepository.DeletePasswordResetToken(ctx, user.Id)
+	if err != nil {
+		return "", err
+	}
+
+	// A password reset ends every session and lifts any lockout caused by the forgotten password.
+	_, err = us.UserRepository.DeleteRefreshTokens(ctx, user.Id)
+	if err != nil {
+		return "", err
+	}
+	_, err = us.UserRepository.DeleteSignInLock(ctx, user.Id)
+	if err != nil {
+		return "", err
+	}
+
+	us.AuditService.Record(ctx, AuditPasswordReset, user.Id, nil)
+	return "your password has been reset successfully", nil
+}
+
+// ChangePassword TODO: 1. Check the current password, 2. Validate the new password against the policy, 3. Update the password, 4. Revoke every session and issue new tokens, 5. Notify the user
+func (us *UserService) ChangePassword(ctx context.Context, userId string, currentPassword string, newPassword string) (accessToken string, refreshToken string, expiresIn time.Duration, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.ChangePassword")
+	defer span.End()
+
+	user, err := us.UserRepository.FindById(ctx, userId)
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	err = us.VerifyCurrentPassword(ctx, user, currentPassword)
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	err = us.PasswordPolicy.Validate(ctx, newPassword, user.Name, user.Email)
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	hashedPassword, err := us.Hasher.HashPassword(newPassword)
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	_, err = us.UserRepository.UpdatePassword(ctx, user.Id, hashedPassword)
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	// Every other session is signed out, the caller keeps working with the tokens issued below.
+	_, err = us.UserRepository.DeleteRefreshTokens(ctx, user.Id)
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	accessToken, refreshToken, expiresIn, err = us.issueTokens(ctx, user.Id, utils.AuthenticationInfo{Time: time.Now(), Methods: []string{AuthMethodPassword}})
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	us.AuditService.Record(ctx, AuditPasswordChanged, user.Id, nil)
+	us.notify(ctx, "internal/templates/password_changed_template.html", user.Email, "Your Password Has Been Changed",
+		templates.AccountNotice{Name: strings.ToTitle(user.Name), Email: user.Email})
+
+	return accessToken, refreshToken, expiresIn, nil
+}
+
+// ChangeEmail TODO: 1. Check the password, 2. Check the new email is not in use, 3. Send a confirmation to the new email and a notice to the old one, 4. Return success message
+func (us *UserService) ChangeEmail(ctx context.Context, userId string, password string, email string) (message string, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.ChangeEmail")
+	defer span.End()
+
+	user, err := us.UserRepository.FindById(ctx, userId)
+	if err != nil {
+		return "", err
+	}
+
+	err = us.VerifyCurrentPassword(ctx, user, password)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.EqualFold(user.Email, email) {
+		return "", errors.New("the new email must be different from the current one")
+	}
+
+	isFounded, err := us.UserRepository.FindByEmail(ctx, email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+	if isFounded.Id != "" {
+		return "", errors.New("email is already in use")
+	}
+
+	expiration := time.Hour * 24
+	token, err := us.TokenService.GeneratePurposeToken(user.Id, PurposeChangeEmail, expiration)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = us.UserRepository.SaveEmailChange(ctx, user.Id, email, token, expiration)
+	if err != nil {
+		return "", err
+	}
+
+	mail, err := us.EmailService.Create("internal/templates/email_change_template.html", []string{email},
+		"Confirm Your New Email", templates.EmailChange{Name: strings.ToTitle(user.Name), Email: email, Token: token}, []string{})
+	if err != nil {
+		return "", err
+	}
+
+	err = us.EmailService.Send(ctx, mail)
+	if err != nil {
+		return "", err
+	}
+
+	us.AuditService.Record(ctx, AuditEmailChangeRequested, user.Id, map[string]interface{}{"new_email": email})
+	us.notify(ctx, "internal/templates/email_change_notice_template.html", user.Email, "Email Change Requested",
+		templates.AccountNotice{Name: strings.ToTitle(user.Name), Email: email})
+
+	return "check your new email to confirm the change", nil
+}
+
+// ConfirmEmailChange TODO: 1. Validate the confirmation token, 2. Check the new email is still free, 3. Update the email, 4. Return success message
+func (us *UserService) ConfirmEmailChange(ctx context.Context, token string) (message string, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.ConfirmEmailChange")
+	defer span.End()
+
+	userId, err := us.TokenService.ValidatePurposeToken(token, PurposeChangeEmail)
+	if err != nil {
+		return "", errors.New("invalid token")
+	}
+
+	email, pendingToken, err := us.UserRepository.FindEmailChange(ctx, userId)
+	if err != nil || pendingToken != token {
+		return "", errors.New("invalid token")
+	}
+
+	user, err := us.UserRepository.FindById(ctx, userId)
+	if err != nil {
+		return "", err
+	}
+
+	isFounded, err := us.UserRepository.FindByEmail(ctx, email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+	if isFounded.Id != "" {
+		return "", errors.New("email is already in use")
+	}
+
+	// The unique index still rejects an email taken since the check.
+	_, err = us.UserRepository.UpdateEmail(ctx, user.Id, email)
+	var pqError *pq.Error
+	if errors.As(err, &pqError) && pqError.Code == "23505" {
+		return "", errors.New("email is already in use")
+	}
+	if err != nil {
+		return "", err
+	}
+
+	_, err = us.UserRepository.DeleteEmailChange(ctx, user.Id)
+	if err != nil {
+		return "", err
+	}
+
+	us.AuditService.Record(ctx, AuditEmailChanged, user.Id, map[string]interface{}{"old_email": user.Email, "new_email": email})
+
+	err = us.BillingService.UpdateCustomer(ctx, user.Id)
+	if err != nil {
+		utils.Logger(ctx).Warn("billing customer update failed", zap.Error(err))
+	}
+	return "your email has been changed successfully", nil
+}
+
+// Reauthenticate TODO: 1. Check the password behind the sign-in lockout, 2. Issue a short-lived access token with a fresh auth_time, 3. Return token
+func (us *UserService) Reauthenticate(ctx context.Context, userId string, password string) (token string, expiresIn time.Duration, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.Reauthenticate")
+	defer span.End()
+
+	user, err := us.UserRepository.FindById(ctx, userId)
+	if err != nil {
+		return "", 0, err
+	}
+
+	err = us.VerifyCurrentPassword(ctx, user, password)
+	if err != nil {
+		return "", 0, err
+	}
+
+	token, err = us.TokenService.GenerateAccessToken(user.Id, utils.AuthenticationInfo{Time: time.Now(), Methods: []string{AuthMethodPassword}}, us.TokenService.ExpirationTimeReauth)
+	if err != nil {
+		return "", 0, err
+	}
+
+	us.Metrics.IncToken("elevated")
+	us.AuditService.Record(ctx, AuditReauthenticated, user.Id, nil)
+	return token, us.TokenService.ExpirationTimeReauth, nil
+}
+
+// Impersonate TODO: 1. Check the target can be impersonated, 2. Issue a time-boxed token carrying the administrator as actor, 3. Audit the reason, 4. Return token
+func (us *UserService) Impersonate(ctx context.Context, userId string, reason string) (token string, expiresIn time.Duration, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.Impersonate")
+	defer span.End()
+
+	actorId := utils.UserId(ctx)
+	if actorId == userId {
+		return "", 0, errors.New("you can not impersonate yourself")
+	}
+
+	user, err := us.UserRepository.FindById(ctx, userId)
+	if err != nil {
+		return "", 0, err
+	}
+	// Impersonating an administrator would hand out admin permissions without their credentials.
+	if user.Role == entities.RoleAdmin {
+		return "", 0, errors.New("administrators can not be impersonated")
+	}
+	if user.DeactivatedAt != nil {
+		return "", 0, errors.New("account is scheduled for deletion")
+	}
+
+	expiresIn = us.TokenService.ExpirationTimeImpersonation
+	token, err = us.TokenService.GenerateImpersonationToken(user.Id, actorId, expiresIn)
+	if err != nil {
+		return "", 0, err
+	}
+
+	us.Metrics.IncToken("impersonation")
+	us.AuditService.Record(ctx, AuditImpersonationStarted, user.Id, map[string]interface{}{"reason": reason, "expires_at": time.Now().Add(expiresIn)})
+	utils.Logger(ctx).Warn("impersonation started", zap.String("target_user_id", user.Id))
+	return token, expiresIn, nil
+}
+
+// notify TODO: 1. Render and send a notification email, failures are logged because the action already happened
+func (us *UserService) notify(ctx context.Context, template string, to string, subject string, body interface{}) {
+	mail, err := us.EmailService.Create(template, []string{to}, subject, body, []string{})
+	if err == nil {
+		err = us.EmailService.Send(ctx, mail)
+	}
+	if err != nil {
+		utils.Logger(ctx).Error("notification email failed", zap.String("subject", subject), zap.Error(err))
+	}
+}
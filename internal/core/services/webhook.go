@@ -0,0 +1,215 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/Lenstack/lensaas-app/internal/core/billing"
+	"github.com/Lenstack/lensaas-app/internal/core/entities"
+	"github.com/Lenstack/lensaas-app/internal/core/repositories"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"github.com/Masterminds/squirrel"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+const (
+	// webhookMaxAttempts is the number of tries before an event is left for a manual replay.
+	webhookMaxAttempts = 8
+	// webhookRetryDelay doubles after every failed attempt, up to webhookMaxRetryDelay.
+	webhookRetryDelay    = 30 * time.Second
+	webhookMaxRetryDelay = 6 * time.Hour
+	// webhookLease is how long a worker owns an event before another one may take it over.
+	webhookLease     = 5 * time.Minute
+	webhookBatchSize = 100
+)
+
+var ErrInvalidWebhookSignature = billing.ErrInvalidSignature
+
+type IWebhookService interface {
+	Receive(ctx context.Context, providerName string, payload []byte, header http.Header) (eventId string, err error)
+	ProcessEvent(ctx context.Context, eventId string) error
+	ProcessDue(ctx context.Context) error
+	Replay(ctx context.Context, eventId string) error
+	ReplayFailed(ctx context.Context) (replayed int, err error)
+}
+
+type WebhookService struct {
+	WebhookEventRepository repositories.WebhookEventRepository
+	SubscriptionService    SubscriptionService
+	DunningService         DunningService
+}
+
+func NewWebhookService(database squirrel.StatementBuilderType, subscriptionService SubscriptionService, dunningService DunningService) *WebhookService {
+	return &WebhookService{
+		WebhookEventRepository: repositories.WebhookEventRepository{
+			Database: database,
+		},
+		SubscriptionService: subscriptionService,
+		DunningService:      dunningService,
+	}
+}
+
+// Receive TODO: 1. Let the provider verify the delivery, 2. Store the event, deliveries of a known event are acknowledged without work, 3. Process it in the background
+func (ws *WebhookService) Receive(ctx context.Context, providerName string, payload []byte, header http.Header) (eventId string, err error) {
+	ctx, span := tracer.Start(ctx, "WebhookService.Receive")
+	defer span.End()
+
+	provider, err := ws.SubscriptionService.BillingService.Provider(providerName)
+	if err != nil {
+		return "", err
+	}
+	event, err := provider.VerifyWebhook(ctx, payload, header)
+	if errors.Is(err, billing.ErrInvalidSignature) {
+		utils.Logger(ctx).Warn("webhook rejected", zap.String("provider", provider.Name()))
+		return "", ErrInvalidWebhookSignature
+	}
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	created, err := ws.WebhookEventRepository.Create(ctx, entities.WebhookEvent{
+		Id:            event.Id,
+		Provider:      provider.Name(),
+		Type:          event.Type,
+		Payload:       string(payload),
+		Status:        entities.WebhookEventPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	})
+	if err != nil {
+		return "", err
+	}
+	if !created {
+		utils.Logger(ctx).Debug("duplicate webhook event", zap.String("event_id", event.Id))
+		return event.Id, nil
+	}
+
+	// The request context ends with the response, processing keeps the logger and the trace.
+	detached := trace.ContextWithSpanContext(utils.WithLogger(context.Background(), utils.Logger(ctx)), span.SpanContext())
+	go func() {
+		if err := ws.ProcessEvent(detached, event.Id); err != nil {
+			utils.Logger(detached).Warn("webhook event will be retried", zap.String("event_id", event.Id), zap.Error(err))
+		}
+	}()
+	return event.Id, nil
+}
+
+// ProcessEvent TODO: 1. Claim the event, events owned by another worker are skipped, 2. Apply it, 3. Mark it processed or schedule a retry with back-off
+func (ws *WebhookService) ProcessEvent(ctx context.Context, eventId string) error {
+	ctx, span := tracer.Start(ctx, "WebhookService.ProcessEvent")
+	defer span.End()
+
+	now := time.Now()
+	event, err := ws.WebhookEventRepository.Claim(ctx, eventId, now, now.Add(webhookLease))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = ws.apply(ctx, event)
+	if err == nil {
+		_, err = ws.WebhookEventRepository.MarkProcessed(ctx, event.Id, time.Now())
+		return err
+	}
+
+	status := entities.WebhookEventPending
+	if event.Attempts >= webhookMaxAttempts {
+		status = entities.WebhookEventFailed
+		utils.Logger(ctx).Error("webhook event failed", zap.String("event_id", event.Id),
+			zap.String("type", event.Type), zap.Int("attempts", event.Attempts), zap.Error(err))
+	}
+	delay := webhookRetryDelay << (event.Attempts - 1)
+	if delay > webhookMaxRetryDelay || delay <= 0 {
+		delay = webhookMaxRetryDelay
+	}
+	if _, markErr := ws.WebhookEventRepository.MarkFailed(ctx, event.Id, status, err.Error(), time.Now().Add(delay)); markErr != nil {
+		return markErr
+	}
+	return err
+}
+
+// ProcessDue TODO: 1. Find the events whose attempt is due, 2. Process them one by one, failures are retried later
+func (ws *WebhookService) ProcessDue(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "WebhookService.ProcessDue")
+	defer span.End()
+
+	eventIds, err := ws.WebhookEventRepository.FindDue(ctx, time.Now(), webhookBatchSize)
+	if err != nil {
+		return err
+	}
+	for _, eventId := range eventIds {
+		if err := ws.ProcessEvent(ctx, eventId); err != nil {
+			utils.Logger(ctx).Warn("webhook event will be retried", zap.String("event_id", eventId), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// Replay TODO: 1. Make a stored event due again, whatever its status, 2. Process it now
+func (ws *WebhookService) Replay(ctx context.Context, eventId string) error {
+	ctx, span := tracer.Start(ctx, "WebhookService.Replay")
+	defer span.End()
+
+	_, err := ws.WebhookEventRepository.Reset(ctx, eventId)
+	if err != nil {
+		return err
+	}
+	return ws.ProcessEvent(ctx, eventId)
+}
+
+// ReplayFailed TODO: 1. Replay every event that ran out of attempts, 2. Return how many were processed
+func (ws *WebhookService) ReplayFailed(ctx context.Context) (replayed int, err error) {
+	ctx, span := tracer.Start(ctx, "WebhookService.ReplayFailed")
+	defer span.End()
+
+	eventIds, err := ws.WebhookEventRepository.FindByStatus(ctx, entities.WebhookEventFailed, webhookBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	for _, eventId := range eventIds {
+		if err := ws.Replay(ctx, eventId); err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+	return replayed, nil
+}
+
+// apply refreshes the subscription the event is about and follows up failed and paid invoices with dunning, other
+// events are acknowledged without work.
+func (ws *WebhookService) apply(ctx context.Context, webhookEvent entities.WebhookEvent) error {
+	provider, err := ws.SubscriptionService.BillingService.Provider(webhookEvent.Provider)
+	if err != nil {
+		return err
+	}
+	event, err := provider.DecodeEvent([]byte(webhookEvent.Payload))
+	if err != nil {
+		return err
+	}
+	if event.Kind == billing.EventIgnored || event.SubscriptionId == "" {
+		return nil
+	}
+
+	subscription, err := ws.SubscriptionService.RefreshSubscription(ctx, provider.Name(), event.SubscriptionId)
+	if err != nil {
+		return err
+	}
+
+	occurredAt := event.CreatedAt
+	if occurredAt.IsZero() {
+		occurredAt = time.Now()
+	}
+	switch event.Kind {
+	case billing.EventPaymentFailed:
+		return ws.DunningService.PaymentFailed(ctx, subscription, occurredAt)
+	case billing.EventPaymentSucceeded:
+		return ws.DunningService.PaymentSucceeded(ctx, subscription, occurredAt)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Lenstack/lensaas-app/internal/core/billing"
+	"github.com/Lenstack/lensaas-app/internal/core/entities"
+	"net/http"
+	"testing"
+	"time"
+)
+
+var testWebhookEventColumns = []string{"id", "provider", "type", "payload", "status", "attempts", "last_error",
+	"next_attempt_at", "processed_at", "created_at"}
+
+// after matches a time argument within a second of now plus the delay.
+type after time.Duration
+
+func (a after) Match(value driver.Value) bool {
+	at, ok := value.(time.Time)
+	expected := time.Now().Add(time.Duration(a))
+	return ok && at.After(expected.Add(-time.Second)) && at.Before(expected.Add(time.Second))
+}
+
+func fakeEvent(t *testing.T, id string, kind string, subscriptionId string) []byte {
+	t.Helper()
+	payload, err := json.Marshal(billing.Event{Id: id, Type: "test." + kind, Kind: kind, SubscriptionId: subscriptionId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return payload
+}
+
+func fakeHeader(secret string) http.Header {
+	header := http.Header{}
+	header.Set(billing.FakeWebhookHeader, secret)
+	return header
+}
+
+// expectClaim hands out the event to the worker after the given previous attempts, none when payload is nil.
+func (f *fixture) expectClaim(eventId string, payload []byte, attempts int) {
+	expectation := f.Database.ExpectQuery(query("UPDATE webhook_events SET Status = $1, Attempts = Attempts + 1")).
+		WithArgs(entities.WebhookEventProcessing, sqlmock.AnyArg(), eventId, entities.WebhookEventPending,
+			entities.WebhookEventProcessing, sqlmock.AnyArg())
+	if payload == nil {
+		expectation.WillReturnError(sql.ErrNoRows)
+		return
+	}
+	expectation.WillReturnRows(sqlmock.NewRows(testWebhookEventColumns).AddRow(eventId, billing.ProviderFake, "test", string(payload),
+		entities.WebhookEventProcessing, attempts+1, nil, time.Now().Add(webhookLease), nil, time.Now()))
+}
+
+// waitFor waits for the background processing of a delivery to meet the expectations.
+func waitFor(t *testing.T, database sqlmock.Sqlmock) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for database.ExpectationsWereMet() != nil {
+		if time.Now().After(deadline) {
+			t.Fatal(database.ExpectationsWereMet())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestReceiveDeduplicatesDeliveries(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	payload := fakeEvent(t, "evt_1", billing.EventSubscriptionChanged, "sub_fake_1")
+
+	f.Database.ExpectQuery(query("INSERT INTO webhook_events")).
+		WithArgs("evt_1", billing.ProviderFake, "test."+billing.EventSubscriptionChanged, string(payload),
+			entities.WebhookEventPending, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"Id"}).AddRow("evt_1"))
+	// Another worker owns the event, the background processing stops there.
+	f.expectClaim("evt_1", nil, 0)
+
+	eventId, err := f.WebhookService.Receive(ctx, billing.ProviderFake, payload, fakeHeader("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eventId != "evt_1" {
+		t.Errorf("event id = %q, want evt_1", eventId)
+	}
+	waitFor(t, f.Database)
+
+	// The redelivery conflicts with the stored event and is acknowledged without processing.
+	f.Database.ExpectQuery(query("INSERT INTO webhook_events")).
+		WithArgs("evt_1", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"Id"}))
+
+	eventId, err = f.WebhookService.Receive(ctx, billing.ProviderFake, payload, fakeHeader("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eventId != "evt_1" {
+		t.Errorf("event id = %q, want evt_1", eventId)
+	}
+}
+
+func TestReceiveRejectsInvalidSignature(t *testing.T) {
+	f := newFixture(t)
+	payload := fakeEvent(t, "evt_1", billing.EventSubscriptionChanged, "sub_fake_1")
+
+	_, err := f.WebhookService.Receive(context.Background(), billing.ProviderFake, payload, fakeHeader("forged"))
+	if !errors.Is(err, ErrInvalidWebhookSignature) {
+		t.Fatalf("err = %v, want %v", err, ErrInvalidWebhookSignature)
+	}
+}
+
+func TestProcessEventAppliesSubscriptionChange(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	user := verifiedCustomer(t, f)
+	current := subscribed(t, f, user.BillingCustomerId, testProPrice)
+	f.Provider.SetStatus(current.Id, entities.SubscriptionPastDue)
+	f.cacheEntitlements(t, testUserId)
+
+	f.expectClaim("evt_1", fakeEvent(t, "evt_1", billing.EventSubscriptionChanged, current.Id), 0)
+	f.expectSync(current.Id, testProPrice, entities.SubscriptionPastDue, false)
+	f.Database.ExpectExec(query("UPDATE webhook_events SET Status = $1, LastError = $2, ProcessedAt = $3 WHERE Id = $4")).
+		WithArgs(entities.WebhookEventProcessed, sqlmock.AnyArg(), sqlmock.AnyArg(), "evt_1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := f.WebhookService.ProcessEvent(ctx, "evt_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.assertEntitlementsInvalidated(t, testUserId)
+}
+
+func TestProcessEventSkipsEventsClaimedElsewhere(t *testing.T) {
+	f := newFixture(t)
+
+	f.expectClaim("evt_1", nil, 0)
+
+	err := f.WebhookService.ProcessEvent(context.Background(), "evt_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProcessEventRetriesWithBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts int
+		status   string
+		delay    time.Duration
+	}{
+		{name: "first failure", attempts: 0, status: entities.WebhookEventPending, delay: webhookRetryDelay},
+		{name: "third failure", attempts: 2, status: entities.WebhookEventPending, delay: 4 * webhookRetryDelay},
+		{name: "last attempt", attempts: webhookMaxAttempts - 1, status: entities.WebhookEventFailed, delay: webhookRetryDelay << (webhookMaxAttempts - 1)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := newFixture(t)
+
+			// The fake provider does not know the subscription, refreshing it fails.
+			f.expectClaim("evt_1", fakeEvent(t, "evt_1", billing.EventPaymentFailed, "sub_missing"), test.attempts)
+			f.Database.ExpectExec(query("UPDATE webhook_events SET Status = $1, LastError = $2, NextAttemptAt = $3 WHERE Id = $4")).
+				WithArgs(test.status, billing.ErrNotFound.Error(), after(test.delay), "evt_1").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			err := f.WebhookService.ProcessEvent(context.Background(), "evt_1")
+			if !errors.Is(err, billing.ErrNotFound) {
+				t.Fatalf("err = %v, want %v", err, billing.ErrNotFound)
+			}
+		})
+	}
+}
+
+func TestProcessEventIgnoresUnknownKinds(t *testing.T) {
+	f := newFixture(t)
+
+	f.expectClaim("evt_1", fakeEvent(t, "evt_1", "", ""), 0)
+	f.Database.ExpectExec(query("UPDATE webhook_events SET Status = $1")).
+		WithArgs(entities.WebhookEventProcessed, sqlmock.AnyArg(), sqlmock.AnyArg(), "evt_1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := f.WebhookService.ProcessEvent(context.Background(), "evt_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,55 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"github.com/Lenstack/lensaas-app/internal/core/services"
+	"github.com/Lenstack/lensaas-app/internal/utils"
+	"go.uber.org/zap"
+	"strconv"
+)
+
+const commandUsage = "usage: app webhooks replay [--failed] [event_id ...]"
+
+type Command struct {
+	WebhookService services.WebhookService
+	logger         *zap.Logger
+}
+
+func NewCommand(webhookService services.WebhookService, logger *zap.Logger) *Command {
+	return &Command{WebhookService: webhookService, logger: logger}
+}
+
+// Run TODO: 1. Dispatch the maintenance command given on the command line, 2. Return its error
+func (c *Command) Run(args []string) error {
+	ctx := utils.WithLogger(context.Background(), c.logger)
+
+	if len(args) < 2 || args[0] != "webhooks" || args[1] != "replay" {
+		return errors.New(commandUsage)
+	}
+
+	flags := flag.NewFlagSet("webhooks replay", flag.ContinueOnError)
+	failed := flags.Bool("failed", false, "replay every event that ran out of attempts")
+	if err := flags.Parse(args[2:]); err != nil {
+		return err
+	}
+	if !*failed && flags.NArg() == 0 {
+		return errors.New(commandUsage)
+	}
+
+	if *failed {
+		replayed, err := c.WebhookService.ReplayFailed(ctx)
+		c.logger.Sugar().Info("Replayed failed webhook events: " + strconv.Itoa(replayed))
+		if err != nil {
+			return err
+		}
+	}
+	for _, eventId := range flags.Args() {
+		if err := c.WebhookService.Replay(ctx, eventId); err != nil {
+			return err
+		}
+		c.logger.Sugar().Info("Replayed webhook event: " + eventId)
+	}
+	return nil
+}
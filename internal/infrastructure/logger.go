@@ -2,20 +2,88 @@ package infrastructure
 
 import (
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 	"strings"
 )
 
+const redacted = "[REDACTED]"
+
+// secretFields are dropped entirely, emailFields are masked so support can still correlate them.
+var (
+	secretFields = map[string]bool{
+		"password": true, "new_password": true, "current_password": true,
+		"token": true, "access_token": true, "refresh_token": true,
+		"authorization": true, "secret": true, "code": true,
+	}
+	emailFields = map[string]bool{"email": true, "to": true, "new_email": true}
+)
+
 type Logger struct {
 	environment string
 	Log         *zap.Logger
 }
 
 func NewLogger(environment string) *Logger {
+	var logger *zap.Logger
 	if strings.ToLower(environment) == "production" {
-		logger, _ := zap.NewProduction()
-		return &Logger{environment, logger}
+		logger, _ = zap.NewProduction(zap.WrapCore(newRedactCore))
+	} else {
+		logger, _ = zap.NewDevelopment(zap.WrapCore(newRedactCore))
+	}
+	zap.ReplaceGlobals(logger)
+	return &Logger{environment, logger}
+}
+
+type redactCore struct {
+	zapcore.Core
+}
+
+func newRedactCore(core zapcore.Core) zapcore.Core {
+	return &redactCore{core}
+}
+
+func (rc *redactCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactCore{rc.Core.With(redactFields(fields))}
+}
+
+func (rc *redactCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if rc.Enabled(entry.Level) {
+		return checked.AddCore(entry, rc)
+	}
+	return checked
+}
+
+func (rc *redactCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	return rc.Core.Write(entry, redactFields(fields))
+}
+
+func redactFields(fields []zapcore.Field) []zapcore.Field {
+	redactedFields := make([]zapcore.Field, len(fields))
+	for i, field := range fields {
+		key := strings.ToLower(field.Key)
+		switch {
+		case secretFields[key]:
+			redactedFields[i] = zap.String(field.Key, redacted)
+		case emailFields[key] && field.Type == zapcore.StringType:
+			redactedFields[i] = zap.String(field.Key, MaskEmail(field.String))
+		default:
+			redactedFields[i] = field
+		}
 	}
+	return redactedFields
+}
 
-	logger, _ := zap.NewDevelopment()
-	return &Logger{Log: logger}
+// MaskEmail TODO: 1. Keep the first character of the local part and the domain, e.g. j***@example.com
+func MaskEmail(value string) string {
+	addresses := strings.Split(value, ",")
+	for i, address := range addresses {
+		address = strings.TrimSpace(address)
+		at := strings.LastIndex(address, "@")
+		if at < 1 {
+			addresses[i] = redacted
+			continue
+		}
+		addresses[i] = address[:1] + "***" + address[at:]
+	}
+	return strings.Join(addresses, ",")
 }
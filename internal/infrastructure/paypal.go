@@ -1 +1,462 @@
 package infrastructure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Lenstack/lensaas-app/internal/core/billing"
+	"github.com/Lenstack/lensaas-app/internal/core/entities"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	payPalLiveUrl        = "https://api-m.paypal.com"
+	payPalSandboxUrl     = "https://api-m.sandbox.paypal.com"
+	payPalLivePortal     = "https://www.paypal.com/myaccount/autopay/"
+	payPalSandboxPortal  = "https://www.sandbox.paypal.com/myaccount/autopay/"
+	payPalCustomerPrefix = "paypal-"
+)
+
+// PayPal is the PayPal Subscriptions billing provider. Prices are PayPal plan ids, trials are part of the plans.
+// PayPal has no customers, metered usage, promotion codes, plan change previews or cancellation at period end.
+type PayPal struct {
+	Client    *http.Client
+	ApiUrl    string
+	PortalUrl string
+	ClientId  string
+	Secret    string
+	WebhookId string
+
+	mutex       sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// NewPayPal TODO: 1. Use the sandbox outside production unless apiUrl is set, 2. Trace the api calls
+func NewPayPal(environment string, clientId string, secret string, webhookId string, apiUrl string) *PayPal {
+	portalUrl := payPalSandboxPortal
+	if environment == "production" {
+		portalUrl = payPalLivePortal
+	}
+	if apiUrl == "" {
+		apiUrl = payPalSandboxUrl
+		if environment == "production" {
+			apiUrl = payPalLiveUrl
+		}
+	}
+	return &PayPal{
+		Client:    &http.Client{Timeout: 30 * time.Second, Transport: otelhttp.NewTransport(http.DefaultTransport)},
+		ApiUrl:    strings.TrimSuffix(apiUrl, "/"),
+		PortalUrl: portalUrl,
+		ClientId:  clientId,
+		Secret:    secret,
+		WebhookId: webhookId,
+	}
+}
+
+type payPalLink struct {
+	Href string `json:"href"`
+	Rel  string `json:"rel"`
+}
+
+type payPalSubscription struct {
+	Id         string       `json:"id"`
+	PlanId     string       `json:"plan_id"`
+	Status     string       `json:"status"`
+	CustomId   string       `json:"custom_id"`
+	Quantity   string       `json:"quantity"`
+	StartTime  *time.Time   `json:"start_time"`
+	CreateTime time.Time    `json:"create_time"`
+	UpdateTime *time.Time   `json:"status_update_time"`
+	Links      []payPalLink `json:"links"`
+	Subscriber struct {
+		PayerId string `json:"payer_id"`
+	} `json:"subscriber"`
+	BillingInfo struct {
+		NextBillingTime *time.Time `json:"next_billing_time"`
+		LastPayment     struct {
+			Time *time.Time `json:"time"`
+		} `json:"last_payment"`
+	} `json:"billing_info"`
+}
+
+type payPalEvent struct {
+	Id         string          `json:"id"`
+	EventType  string          `json:"event_type"`
+	CreateTime time.Time       `json:"create_time"`
+	Resource   json.RawMessage `json:"resource"`
+}
+
+type payPalError struct {
+	Status  int
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+func (e *payPalError) Error() string {
+	return fmt.Sprintf("paypal: %s: %s (%d)", e.Name, e.Message, e.Status)
+}
+
+func (p *PayPal) Name() string {
+	return billing.ProviderPayPal
+}
+
+// CreateCustomer TODO: 1. PayPal has no customers, the payer is known once a subscription is approved, the user id is used instead
+func (p *PayPal) CreateCustomer(ctx context.Context, customer billing.Customer) (customerId string, err error) {
+	return payPalCustomerPrefix + customer.UserId, nil
+}
+
+// UpdateCustomer TODO: 1. Nothing to update, payers manage their details on PayPal
+func (p *PayPal) UpdateCustomer(ctx context.Context, customerId string, customer billing.Customer) error {
+	return nil
+}
+
+// DeleteCustomer TODO: 1. Nothing to delete, subscriptions are canceled one by one
+func (p *PayPal) DeleteCustomer(ctx context.Context, customerId string) error {
+	return nil
+}
+
+// CreateSubscription TODO: 1. PayPal subscriptions must be approved by the payer, they are created through checkout
+func (p *PayPal) CreateSubscription(ctx context.Context, params billing.SubscriptionParams) (subscription billing.Subscription, err error) {
+	return billing.Subscription{}, billing.ErrNotSupported
+}
+
+// GetSubscription TODO: 1. Fetch the current state of the subscription
+func (p *PayPal) GetSubscription(ctx context.Context, subscriptionId string) (subscription billing.Subscription, err error) {
+	payPalSubscription := payPalSubscription{}
+	err = p.do(ctx, http.MethodGet, "/v1/billing/subscriptions/"+url.PathEscape(subscriptionId), nil, "", &payPalSubscription)
+	if err != nil {
+		return billing.Subscription{}, err
+	}
+	return toPayPalSubscription(payPalSubscription), nil
+}
+
+// PreviewChange TODO: 1. PayPal does not preview revisions
+func (p *PayPal) PreviewChange(ctx context.Context, params billing.ChangeParams) (preview billing.Preview, err error) {
+	return billing.Preview{}, billing.ErrNotSupported
+}
+
+// ChangeSubscription TODO: 1. PayPal revisions need a new approval of the payer, plans are changed by canceling and checking out again
+func (p *PayPal) ChangeSubscription(ctx context.Context, params billing.ChangeParams) (subscription billing.Subscription, err error) {
+	return billing.Subscription{}, billing.ErrNotSupported
+}
+
+// UpdateQuantity TODO: 1. PayPal revisions need a new approval of the payer, seats can not follow the members
+func (p *PayPal) UpdateQuantity(ctx context.Context, params billing.QuantityParams) (subscription billing.Subscription, err error) {
+	return billing.Subscription{}, billing.ErrNotSupported
+}
+
+// CancelSubscription TODO: 1. Cancel the subscription, PayPal can only cancel immediately, 2. Return its new state
+func (p *PayPal) CancelSubscription(ctx context.Context, subscriptionId string, immediately bool) (subscription billing.Subscription, err error) {
+	if !immediately {
+		return billing.Subscription{}, billing.ErrNotSupported
+	}
+	body := map[string]string{"reason": "Canceled by the subscriber"}
+	err = p.do(ctx, http.MethodPost, "/v1/billing/subscriptions/"+url.PathEscape(subscriptionId)+"/cancel", body, "", nil)
+	if err != nil {
+		return billing.Subscription{}, err
+	}
+	return p.GetSubscription(ctx, subscriptionId)
+}
+
+// ResumeSubscription TODO: 1. Nothing is scheduled for cancellation on PayPal
+func (p *PayPal) ResumeSubscription(ctx context.Context, subscriptionId string) (subscription billing.Subscription, err error) {
+	return billing.Subscription{}, billing.ErrNotSupported
+}
+
+// ReportUsage TODO: 1. PayPal plans are not metered
+func (p *PayPal) ReportUsage(ctx context.Context, params billing.UsageParams) error {
+	return billing.ErrNotSupported
+}
+
+// CreateCheckoutSession TODO: 1. Create the subscription waiting for approval with the user as custom id, 2. Return the approval url, the subscription id is the session id
+func (p *PayPal) CreateCheckoutSession(ctx context.Context, params billing.CheckoutParams) (session billing.CheckoutSession, err error) {
+	if params.PromotionCode != "" {
+		return billing.CheckoutSession{}, billing.ErrNotSupported
+	}
+	body := map[string]interface{}{
+		"plan_id":   params.PriceId,
+		"custom_id": params.UserId,
+		"application_context": map[string]string{
+			"user_action":         "SUBSCRIBE_NOW",
+			"shipping_preference": "NO_SHIPPING",
+			// PayPal appends subscription_id to the return url.
+			"return_url": params.SuccessUrl,
+			"cancel_url": params.CancelUrl,
+		},
+	}
+	payPalSubscription := payPalSubscription{}
+	err = p.do(ctx, http.MethodPost, "/v1/billing/subscriptions", body, params.IdempotencyKey, &payPalSubscription)
+	if err != nil {
+		return billing.CheckoutSession{}, err
+	}
+
+	session = toPayPalCheckoutSession(payPalSubscription)
+	for _, link := range payPalSubscription.Links {
+		if link.Rel == "approve" {
+			session.Url = link.Href
+		}
+	}
+	if session.Url == "" {
+		return billing.CheckoutSession{}, errors.New("paypal did not return an approval url")
+	}
+	return session, nil
+}
+
+// GetCheckoutSession TODO: 1. Fetch the subscription behind the session, it completes once approved
+func (p *PayPal) GetCheckoutSession(ctx context.Context, sessionId string) (session billing.CheckoutSession, err error) {
+	payPalSubscription := payPalSubscription{}
+	err = p.do(ctx, http.MethodGet, "/v1/billing/subscriptions/"+url.PathEscape(sessionId), nil, "", &payPalSubscription)
+	if err != nil {
+		return billing.CheckoutSession{}, err
+	}
+	return toPayPalCheckoutSession(payPalSubscription), nil
+}
+
+// CreatePortalSession TODO: 1. Payers manage their PayPal subscriptions on the automatic payments page
+func (p *PayPal) CreatePortalSession(ctx context.Context, customerId string, returnUrl string) (url string, err error) {
+	return p.PortalUrl, nil
+}
+
+// VerifyWebhook TODO: 1. Ask PayPal to verify the transmission headers against the configured webhook, 2. Decode the event
+func (p *PayPal) VerifyWebhook(ctx context.Context, payload []byte, header http.Header) (event billing.Event, err error) {
+	if !json.Valid(payload) {
+		return billing.Event{}, billing.ErrInvalidSignature
+	}
+	body := map[string]interface{}{
+		"auth_algo":         header.Get("Paypal-Auth-Algo"),
+		"cert_url":          header.Get("Paypal-Cert-Url"),
+		"transmission_id":   header.Get("Paypal-Transmission-Id"),
+		"transmission_sig":  header.Get("Paypal-Transmission-Sig"),
+		"transmission_time": header.Get("Paypal-Transmission-Time"),
+		"webhook_id":        p.WebhookId,
+		"webhook_event":     json.RawMessage(payload),
+	}
+	verification := struct {
+		VerificationStatus string `json:"verification_status"`
+	}{}
+	err = p.do(ctx, http.MethodPost, "/v1/notifications/verify-webhook-signature", body, "", &verification)
+	if err != nil {
+		return billing.Event{}, err
+	}
+	if verification.VerificationStatus != "SUCCESS" {
+		return billing.Event{}, billing.ErrInvalidSignature
+	}
+	return p.DecodeEvent(payload)
+}
+
+// DecodeEvent TODO: 1. Read the event type and the subscription it is about
+func (p *PayPal) DecodeEvent(payload []byte) (event billing.Event, err error) {
+	payPalEvent := payPalEvent{}
+	if err := json.Unmarshal(payload, &payPalEvent); err != nil {
+		return billing.Event{}, err
+	}
+
+	event = billing.Event{Id: payPalEvent.Id, Type: payPalEvent.EventType, Kind: billing.EventIgnored, CreatedAt: payPalEvent.CreateTime}
+	switch {
+	case payPalEvent.EventType == "PAYMENT.SALE.COMPLETED":
+		sale := struct {
+			BillingAgreementId string `json:"billing_agreement_id"`
+		}{}
+		if err := json.Unmarshal(payPalEvent.Resource, &sale); err != nil {
+			return billing.Event{}, err
+		}
+		event.Kind = billing.EventPaymentSucceeded
+		event.SubscriptionId = sale.BillingAgreementId
+	case strings.HasPrefix(payPalEvent.EventType, "BILLING.SUBSCRIPTION."):
+		subscription := payPalSubscription{}
+		if err := json.Unmarshal(payPalEvent.Resource, &subscription); err != nil {
+			return billing.Event{}, err
+		}
+		switch payPalEvent.EventType {
+		case "BILLING.SUBSCRIPTION.PAYMENT.FAILED":
+			event.Kind = billing.EventPaymentFailed
+		case "BILLING.SUBSCRIPTION.ACTIVATED":
+			event.Kind = billing.EventCheckoutCompleted
+		default:
+			event.Kind = billing.EventSubscriptionChanged
+		}
+		event.SubscriptionId = subscription.Id
+		if subscription.CustomId != "" {
+			event.CustomerId = payPalCustomerPrefix + subscription.CustomId
+		}
+	}
+	return event, nil
+}
+
+// Refund TODO: 1. Refund a subscription payment (sale), all of it when no amount is given
+func (p *PayPal) Refund(ctx context.Context, params billing.RefundParams) (refund billing.Refund, err error) {
+	body := map[string]interface{}{}
+	if params.Amount > 0 {
+		if params.Currency == "" {
+			return billing.Refund{}, errors.New("paypal partial refunds need a currency")
+		}
+		body["amount"] = map[string]string{
+			"total":    fmt.Sprintf("%d.%02d", params.Amount/100, params.Amount%100),
+			"currency": strings.ToUpper(params.Currency),
+		}
+	}
+	if params.Reason != "" {
+		body["description"] = params.Reason
+	}
+
+	payPalRefund := struct {
+		Id     string `json:"id"`
+		State  string `json:"state"`
+		Amount struct {
+			Total    string `json:"total"`
+			Currency string `json:"currency"`
+		} `json:"amount"`
+	}{}
+	err = p.do(ctx, http.MethodPost, "/v1/payments/sale/"+url.PathEscape(params.PaymentId)+"/refund", body, params.IdempotencyKey, &payPalRefund)
+	if err != nil {
+		return billing.Refund{}, err
+	}
+	amount, _ := strconv.ParseFloat(payPalRefund.Amount.Total, 64)
+	return billing.Refund{
+		Id:        payPalRefund.Id,
+		PaymentId: params.PaymentId,
+		Amount:    int64(amount*100 + 0.5),
+		Currency:  strings.ToLower(payPalRefund.Amount.Currency),
+		Status:    payPalRefund.State,
+	}, nil
+}
+
+// do sends an authenticated json request, requestId makes a POST idempotent.
+func (p *PayPal) do(ctx context.Context, method string, path string, body interface{}, requestId string, out interface{}) error {
+	token, err := p.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, p.ApiUrl+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	if requestId != "" {
+		req.Header.Set("PayPal-Request-Id", requestId)
+	}
+	return p.send(req, out)
+}
+
+// accessToken returns the cached client credentials token, a new one is requested a minute before it expires.
+func (p *PayPal) accessToken(ctx context.Context) (token string, err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.token != "" && time.Now().Before(p.tokenExpiry) {
+		return p.token, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.ApiUrl+"/v1/oauth2/token", strings.NewReader("grant_type=client_credentials"))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(p.ClientId, p.Secret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	response := struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}{}
+	if err := p.send(req, &response); err != nil {
+		return "", err
+	}
+	p.token = response.AccessToken
+	p.tokenExpiry = time.Now().Add(time.Duration(response.ExpiresIn)*time.Second - time.Minute)
+	return p.token, nil
+}
+
+func (p *PayPal) send(req *http.Request, out interface{}) error {
+	res, err := p.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return billing.ErrNotFound
+	}
+	if res.StatusCode >= 300 {
+		payPalErr := &payPalError{Status: res.StatusCode}
+		_ = json.NewDecoder(io.LimitReader(res.Body, 1<<16)).Decode(payPalErr)
+		return payPalErr
+	}
+	if out == nil || res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+func toPayPalSubscription(payPalSubscription payPalSubscription) billing.Subscription {
+	quantity, err := strconv.ParseInt(payPalSubscription.Quantity, 10, 64)
+	if err != nil {
+		quantity = 1
+	}
+	subscription := billing.Subscription{
+		Id:               payPalSubscription.Id,
+		UserId:           payPalSubscription.CustomId,
+		Items:            []billing.SubscriptionItem{{Id: payPalSubscription.Id, PriceId: payPalSubscription.PlanId, Quantity: quantity}},
+		CurrentPeriodEnd: payPalSubscription.BillingInfo.NextBillingTime,
+		CreatedAt:        payPalSubscription.CreateTime,
+	}
+	if payPalSubscription.CustomId != "" {
+		subscription.CustomerId = payPalCustomerPrefix + payPalSubscription.CustomId
+	}
+	subscription.CurrentPeriodStart = payPalSubscription.BillingInfo.LastPayment.Time
+	if subscription.CurrentPeriodStart == nil {
+		subscription.CurrentPeriodStart = payPalSubscription.StartTime
+	}
+
+	switch payPalSubscription.Status {
+	case "ACTIVE":
+		subscription.Status = entities.SubscriptionActive
+	case "SUSPENDED":
+		subscription.Status = entities.SubscriptionPastDue
+	case "CANCELLED", "EXPIRED":
+		subscription.Status = entities.SubscriptionCanceled
+		subscription.CanceledAt = payPalSubscription.UpdateTime
+		subscription.CurrentPeriodEnd = nil
+	default:
+		subscription.Status = entities.SubscriptionIncomplete
+	}
+	return subscription
+}
+
+func toPayPalCheckoutSession(payPalSubscription payPalSubscription) billing.CheckoutSession {
+	session := billing.CheckoutSession{
+		Id:            payPalSubscription.Id,
+		UserId:        payPalSubscription.CustomId,
+		Status:        billing.CheckoutOpen,
+		PaymentStatus: "unpaid",
+	}
+	switch payPalSubscription.Status {
+	case "APPROVED", "ACTIVE", "SUSPENDED":
+		session.Status = billing.CheckoutComplete
+		session.SubscriptionId = payPalSubscription.Id
+		if payPalSubscription.Status == "ACTIVE" {
+			session.PaymentStatus = "paid"
+		}
+	case "CANCELLED", "EXPIRED":
+		session.Status = billing.CheckoutExpired
+	}
+	return session
+}
@@ -4,11 +4,14 @@ import (
 	"database/sql"
 	"fmt"
 	"github.com/Masterminds/squirrel"
+	"github.com/XSAM/otelsql"
 	_ "github.com/lib/pq"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
 	"go.uber.org/zap"
 )
 
 type Postgres struct {
+	DB       *sql.DB
 	Database squirrel.StatementBuilderType
 }
 
@@ -16,7 +19,7 @@ func NewPostgres(host, port, user, password, dbName string, logger *zap.Logger)
 	datasource := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=America/Bogota",
 		host, user, password, dbName, port)
 
-	database, err := sql.Open("postgres", datasource)
+	database, err := otelsql.Open("postgres", datasource, otelsql.WithAttributes(semconv.DBSystemPostgreSQL))
 	if err != nil {
 		logger.Sugar().Error(err)
 		return nil
@@ -29,5 +32,5 @@ func NewPostgres(host, port, user, password, dbName string, logger *zap.Logger)
 	}
 
 	logger.Sugar().Info("Database connection successful")
-	return &Postgres{Database: squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).RunWith(database)}
+	return &Postgres{DB: database, Database: squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).RunWith(database)}
 }
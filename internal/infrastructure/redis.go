@@ -2,6 +2,7 @@ package infrastructure
 
 import (
 	"context"
+	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 	"strconv"
@@ -24,6 +25,12 @@ func NewRedis(host, port, password string, db string, logger *zap.Logger) *Redis
 		DB:       dbName,
 	})
 
+	err = redisotel.InstrumentTracing(redisClient)
+	if err != nil {
+		logger.Sugar().Error(err)
+		return nil
+	}
+
 	_, err = redisClient.Ping(context.Background()).Result()
 	if err != nil {
 		logger.Sugar().Error(err)
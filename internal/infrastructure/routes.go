@@ -2,9 +2,13 @@ package infrastructure
 
 import (
 	"github.com/Lenstack/lensaas-app/internal/core/applications"
+	"github.com/Lenstack/lensaas-app/internal/core/entities"
+	"github.com/Lenstack/lensaas-app/internal/core/services"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"net/http"
+	"time"
 )
 
 type Routes struct {
@@ -13,33 +17,124 @@ type Routes struct {
 
 func NewRoutes(microservice applications.Microservice) *Routes {
 	router := chi.NewRouter()
-	router.Use(middleware.AllowContentType("application/json"))
-	router.Use(middleware.CleanPath)
+	router.Use(microservice.MiddlewareRequestId)
 	router.Use(microservice.MiddlewareLogger)
+	router.Use(microservice.MiddlewareTracing)
+	router.Use(microservice.MiddlewareMetrics)
+	router.Use(microservice.MiddlewareRecovery)
+	// Form bodies are only read by the OAuth token endpoint, as required by RFC 6749.
+	router.Use(middleware.AllowContentType("application/json", "application/x-www-form-urlencoded"))
+	router.Use(middleware.CleanPath)
 	router.Use(microservice.MiddlewareCORS)
 
+	router.Get("/metrics", microservice.Metrics)
+	router.With(microservice.MiddlewareRateLimit("oauth_token")).Post("/oauth/token", microservice.OAuthToken)
+	// Authenticated by the signature of each provider, e.g. the Stripe-Signature header on /v1/webhooks/stripe.
+	router.Post("/v1/webhooks/{provider}", microservice.BillingWebhook)
+	router.Get("/v1/billing/plans", microservice.GetPlans)
+
 	// Protected Routes
 	router.Group(func(router chi.Router) {
 		router.Use(microservice.MiddlewareAuth)
-		router.Get("/v1/users", microservice.GetUsers)           //TODO: not implemented
-		router.Get("/v1/users/{id}", microservice.GetUser)       //TODO: not implemented
-		router.Post("/v1/users", microservice.CreateUser)        //TODO: not implemented
-		router.Put("/v1/users/{id}", microservice.UpdateUser)    //TODO: not implemented
-		router.Delete("/v1/users/{id}", microservice.DeleteUser) //TODO: not implemented
+		router.Use(microservice.MiddlewareRateLimit("api"))
+		router.Use(microservice.MiddlewareUsage(services.MetricApiCalls))
+		// Accounts restricted for a failed payment keep reading, billing routes stay open to settle it.
+		// The api calls of the plan are capped on the api routes only, account and billing routes stay open to upgrade.
+		router.Group(func(router chi.Router) {
+			router.Use(microservice.MiddlewareQuota(services.MetricApiCalls))
+			router.With(microservice.MiddlewareScope(services.ScopeUsersRead)).Get("/v1/users", microservice.GetUsers)                                               //TODO: not implemented
+			router.With(microservice.MiddlewareScope(services.ScopeUsersRead)).Get("/v1/users/{id}", microservice.GetUser)                                           //TODO: not implemented
+			router.With(microservice.MiddlewareScope(services.ScopeUsersWrite), microservice.MiddlewareWritable()).Post("/v1/users", microservice.CreateUser)        //TODO: not implemented
+			router.With(microservice.MiddlewareScope(services.ScopeUsersWrite), microservice.MiddlewareWritable()).Put("/v1/users/{id}", microservice.UpdateUser)    //TODO: not implemented
+			router.With(microservice.MiddlewareScope(services.ScopeUsersWrite), microservice.MiddlewareWritable()).Delete("/v1/users/{id}", microservice.DeleteUser) //TODO: not implemented
+		})
+
+		router.With(microservice.MiddlewarePermission(entities.RoleAdmin), microservice.MiddlewareScope(services.ScopeUsersWrite)).Post("/v1/users/{id}/unlock", microservice.UnlockUser)
+		router.With(microservice.MiddlewarePermission(entities.RoleAdmin), microservice.MiddlewareScope(services.ScopeAccount),
+			microservice.MiddlewareRecentAuth(5*time.Minute)).Post("/v1/users/{id}/impersonate", microservice.Impersonate)
+
+		router.Group(func(router chi.Router) {
+			router.Use(microservice.MiddlewarePermission(entities.RoleAdmin))
+			router.Use(microservice.MiddlewareScope(services.ScopeAccount))
+			router.With(microservice.MiddlewareRecentAuth(5*time.Minute)).Post("/v1/oauth/clients", microservice.CreateOAuthClient)
+			router.Get("/v1/oauth/clients", microservice.GetOAuthClients)
+			router.Delete("/v1/oauth/clients/{id}", microservice.RevokeOAuthClient)
+		})
+
+		router.Group(func(router chi.Router) {
+			router.Use(microservice.MiddlewarePermission(entities.RoleAdmin))
+			router.Use(microservice.MiddlewareScope(services.ScopeAuditRead))
+			router.Get("/v1/audit_logs", microservice.GetAuditLogs)
+			router.Get("/v1/audit_logs/verify", microservice.VerifyAuditLogs)
+		})
+
+		router.With(microservice.MiddlewarePermission(entities.RoleAdmin), microservice.MiddlewareScope(services.ScopeAccount),
+			microservice.MiddlewareRecentAuth(5*time.Minute)).Post("/v1/billing/refunds", microservice.RefundPayment)
+		router.With(microservice.MiddlewarePermission(entities.RoleAdmin), microservice.MiddlewareScope(services.ScopeAccount)).Get("/v1/accounts/{id}/seats", microservice.GetAccountSeats)
+
+		router.Group(func(router chi.Router) {
+			router.Use(microservice.MiddlewareScope(services.ScopeAccount))
+
+			// The account stays readable while impersonating so administrators can reproduce issues.
+			router.Get("/v1/me/api_keys", microservice.GetApiKeys)
+			router.Get("/v1/me/entitlements", microservice.GetEntitlements)
+			router.Get("/v1/me/usage", microservice.GetUsage)
+			router.Get("/v1/me/billing/subscription", microservice.GetSubscription)
+			router.Post("/v1/me/billing/subscription/preview", microservice.PreviewSubscription)
+			router.Get("/v1/me/billing/status", microservice.GetBillingStatus)
+			router.Get("/v1/me/billing/trial", microservice.GetTrial)
+			router.Get("/v1/me/members", microservice.GetMembers)
+			router.Get("/v1/me/invitations", microservice.GetInvitations)
+
+			// Credentials, keys, billing, members and the account data are off limits while impersonating.
+			router.Group(func(router chi.Router) {
+				router.Use(microservice.MiddlewareNoImpersonation)
+				router.Put("/v1/me/password", microservice.ChangePassword)
+				router.Post("/v1/me/reauthenticate", microservice.Reauthenticate)
+				router.With(microservice.MiddlewareRecentAuth(5*time.Minute)).Put("/v1/me/email", microservice.ChangeEmail)
+				router.With(microservice.MiddlewareRecentAuth(5*time.Minute)).Delete("/v1/me", microservice.DeleteAccount)
+				router.Get("/v1/me/export", microservice.ExportAccount)
+
+				// Api keys can not mint other keys, creating one needs a recent password authentication.
+				router.With(microservice.MiddlewareRecentAuth(5*time.Minute), microservice.MiddlewareWritable(), microservice.MiddlewareEntitlement(services.FeatureApiKeys)).Post("/v1/me/api_keys", microservice.CreateApiKey)
+				router.With(microservice.MiddlewareWritable()).Delete("/v1/me/api_keys/{id}", microservice.RevokeApiKey)
+
+				router.Post("/v1/me/billing/customer", microservice.CreateCustomer)
+				router.Post("/v1/me/billing/subscription", microservice.CreateSubscription)
+				router.Put("/v1/me/billing/subscription", microservice.ChangeSubscription)
+				router.Post("/v1/me/billing/subscription/cancel", microservice.CancelSubscription)
+				router.Post("/v1/me/billing/subscription/resume", microservice.ResumeSubscription)
+				router.Post("/v1/me/billing/checkout", microservice.CreateCheckoutSession)
+				router.Post("/v1/me/billing/checkout/reconcile", microservice.ReconcileCheckout)
+				router.Post("/v1/me/billing/portal", microservice.CreatePortalSession)
+
+				// Members take the seats of the account once they accept the invitation, the paid seats follow them.
+				router.With(microservice.MiddlewareWritable()).Post("/v1/me/members", microservice.InviteMember)
+				router.With(microservice.MiddlewareWritable()).Delete("/v1/me/members/{id}", microservice.RemoveMember)
+				router.Post("/v1/me/invitations/{id}/accept", microservice.AcceptInvitation)
+				router.Delete("/v1/me/invitations/{id}", microservice.DeclineInvitation)
+				router.Delete("/v1/me/membership", microservice.LeaveAccount)
+			})
+		})
 	})
 
 	router.Group(func(router chi.Router) {
-		router.Post("/v1/authentication/sign_up", microservice.SignUp)             //TODO: implemented ok
-		router.Post("/v1/authentication/sign_in", microservice.SignIn)             //TODO: implemented ok
-		router.Post("/v1/authentication/sign_out", microservice.SignOut)           //TODO: implemented ok
-		router.Post("/v1/authentication/refresh_token", microservice.RefreshToken) //TODO: implemented ok
+		router.With(microservice.MiddlewareRateLimit("sign_up")).Post("/v1/authentication/sign_up", microservice.SignUp) //TODO: implemented ok
+		router.With(microservice.MiddlewareRateLimit("sign_in")).Post("/v1/authentication/sign_in", microservice.SignIn) //TODO: implemented ok
+		router.Post("/v1/authentication/sign_out", microservice.SignOut)                                                 //TODO: implemented ok
+		router.Post("/v1/authentication/refresh_token", microservice.RefreshToken)                                       //TODO: implemented ok
+
+		router.With(microservice.MiddlewareRateLimit("verification_email")).Post("/v1/authentication/verification_email", microservice.VerificationEmail) //TODO: implemented ok
+		router.Post("/v1/authentication/verification_code", microservice.VerificationCode)                                                                //TODO: in progress
 
-		router.Post("/v1/authentication/verification_email", microservice.VerificationEmail) //TODO: implemented ok
-		router.Post("/v1/authentication/verification_code", microservice.VerificationCode)   //TODO: in progress
+		router.With(microservice.MiddlewareRateLimit("password_forgot")).Post("/v1/authentication/password_forgot", microservice.PasswordForgot) //TODO: implemented ok
+		router.Post("/v1/authentication/password_reset", microservice.PasswordReset)                                                             //TODO: implemented ok
 
-		router.Post("/v1/authentication/password_forgot", microservice.PasswordForgot) //TODO: not implemented
-		router.Post("/v1/authentication/password_reset", microservice.PasswordReset)   //TODO: not implemented
+		router.Post("/v1/authentication/unlock_account", microservice.UnlockAccount)
+		router.Post("/v1/authentication/confirm_email", microservice.ConfirmEmailChange)
+		router.Post("/v1/authentication/restore_account", microservice.RestoreAccount)
 	})
 
-	return &Routes{Handlers: router}
+	// otelhttp extracts the incoming W3C trace context and opens the server span for every request.
+	return &Routes{Handlers: otelhttp.NewHandler(router, "http.server")}
 }
@@ -0,0 +1,52 @@
+package infrastructure
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+type Scheduler struct {
+	logger *zap.Logger
+	ctx    context.Context
+	cancel context.CancelFunc
+	wait   sync.WaitGroup
+}
+
+func NewScheduler(logger *zap.Logger) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{logger: logger, ctx: ctx, cancel: cancel}
+}
+
+// Every TODO: 1. Run the job on every tick until the scheduler stops, 2. Log failures without stopping the job
+func (s *Scheduler) Every(name string, interval time.Duration, job func(ctx context.Context) error) {
+	s.wait.Add(1)
+	go func() {
+		defer s.wait.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C:
+				start := time.Now()
+				err := job(s.ctx)
+				if err != nil {
+					s.logger.Error("scheduled job failed", zap.String("job", name), zap.Error(err))
+					continue
+				}
+				s.logger.Debug("scheduled job finished", zap.String("job", name), zap.Duration("latency", time.Since(start)))
+			}
+		}
+	}()
+	s.logger.Sugar().Info("Scheduled job registered: " + name)
+}
+
+// Stop TODO: 1. Cancel running jobs, 2. Wait for them to return
+func (s *Scheduler) Stop() {
+	s.cancel()
+	s.wait.Wait()
+}
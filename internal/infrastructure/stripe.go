@@ -1,11 +1,28 @@
 package infrastructure
 
-import "github.com/stripe/stripe-go/v74"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Lenstack/lensaas-app/internal/core/billing"
+	"github.com/Lenstack/lensaas-app/internal/core/entities"
+	"github.com/stripe/stripe-go/v74"
+	"github.com/stripe/stripe-go/v74/client"
+	"github.com/stripe/stripe-go/v74/webhook"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"net/http"
+	"strings"
+	"time"
+)
 
+// Stripe is the stripe billing provider.
 type Stripe struct {
+	API           *client.API
+	WebhookSecret string
 }
 
-func NewStripe(environment string, stripeKey string) *Stripe {
+// NewStripe TODO: 1. Configure the secret key, 2. Point every backend to apiUrl when set (e.g. stripe-mock on http://localhost:12111)
+func NewStripe(environment string, stripeKey string, apiUrl string, webhookSecret string) *Stripe {
 	if environment == "development" {
 		stripeAppInfo := &stripe.AppInfo{
 			Name:    "Lenstack",
@@ -14,5 +31,476 @@ func NewStripe(environment string, stripeKey string) *Stripe {
 		}
 		stripe.SetAppInfo(stripeAppInfo)
 	}
-	return &Stripe{}
+	stripe.Key = stripeKey
+
+	config := &stripe.BackendConfig{
+		HTTPClient: &http.Client{Timeout: 30 * time.Second, Transport: otelhttp.NewTransport(http.DefaultTransport)},
+	}
+	if apiUrl != "" {
+		config.URL = stripe.String(apiUrl)
+	}
+	backends := &stripe.Backends{
+		API:     stripe.GetBackendWithConfig(stripe.APIBackend, config),
+		Connect: stripe.GetBackendWithConfig(stripe.ConnectBackend, config),
+		Uploads: stripe.GetBackendWithConfig(stripe.UploadsBackend, config),
+	}
+	return &Stripe{API: client.New(stripeKey, backends), WebhookSecret: webhookSecret}
+}
+
+func (s *Stripe) Name() string {
+	return billing.ProviderStripe
+}
+
+// CreateCustomer TODO: 1. Create the customer with an idempotency key so retries never duplicate it, 2. Return the customer id
+func (s *Stripe) CreateCustomer(ctx context.Context, customer billing.Customer) (customerId string, err error) {
+	params := &stripe.CustomerParams{
+		Name:  stripe.String(customer.Name),
+		Email: stripe.String(customer.Email),
+	}
+	params.Context = ctx
+	params.SetIdempotencyKey("customer-create-" + customer.UserId)
+	params.AddMetadata("user_id", customer.UserId)
+
+	stripeCustomer, err := s.API.Customers.New(params)
+	if err != nil {
+		return "", err
+	}
+	return stripeCustomer.ID, nil
+}
+
+// UpdateCustomer TODO: 1. Push the name and email to the customer
+func (s *Stripe) UpdateCustomer(ctx context.Context, customerId string, customer billing.Customer) error {
+	params := &stripe.CustomerParams{
+		Name:  stripe.String(customer.Name),
+		Email: stripe.String(customer.Email),
+	}
+	params.Context = ctx
+	_, err := s.API.Customers.Update(customerId, params)
+	return stripeError(err)
+}
+
+// DeleteCustomer TODO: 1. Delete the customer, which also cancels its subscriptions, an already deleted customer is not an error
+func (s *Stripe) DeleteCustomer(ctx context.Context, customerId string) error {
+	params := &stripe.CustomerParams{}
+	params.Context = ctx
+	_, err := s.API.Customers.Del(customerId, params)
+	if errors.Is(stripeError(err), billing.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// CreateSubscription TODO: 1. Create the subscription waiting for the first payment, with the metered price when usage is billed, 2. Return it with the client secret to confirm the payment
+func (s *Stripe) CreateSubscription(ctx context.Context, params billing.SubscriptionParams) (subscription billing.Subscription, err error) {
+	subscriptionParams := &stripe.SubscriptionParams{
+		Customer:        stripe.String(params.CustomerId),
+		Items:           []*stripe.SubscriptionItemsParams{{Price: stripe.String(params.PriceId)}},
+		PaymentBehavior: stripe.String("default_incomplete"),
+	}
+	if params.MeteredPriceId != "" {
+		subscriptionParams.Items = append(subscriptionParams.Items, &stripe.SubscriptionItemsParams{Price: stripe.String(params.MeteredPriceId)})
+	}
+	subscriptionParams.Context = ctx
+	subscriptionParams.AddMetadata("user_id", params.UserId)
+	subscriptionParams.AddExpand("latest_invoice.payment_intent")
+	if params.IdempotencyKey != "" {
+		subscriptionParams.SetIdempotencyKey(params.IdempotencyKey)
+	}
+
+	stripeSubscription, err := s.API.Subscriptions.New(subscriptionParams)
+	if err != nil {
+		return billing.Subscription{}, err
+	}
+	return toBillingSubscription(stripeSubscription), nil
+}
+
+// GetSubscription TODO: 1. Fetch the current state of the subscription
+func (s *Stripe) GetSubscription(ctx context.Context, subscriptionId string) (subscription billing.Subscription, err error) {
+	params := &stripe.SubscriptionParams{}
+	params.Context = ctx
+	stripeSubscription, err := s.API.Subscriptions.Get(subscriptionId, params)
+	if err != nil {
+		return billing.Subscription{}, stripeError(err)
+	}
+	return toBillingSubscription(stripeSubscription), nil
+}
+
+// PreviewChange TODO: 1. Ask for the upcoming invoice with the new price prorated from now, 2. Return amounts and the proration date
+func (s *Stripe) PreviewChange(ctx context.Context, params billing.ChangeParams) (preview billing.Preview, err error) {
+	prorationDate := params.ProrationDate
+	if prorationDate == 0 {
+		prorationDate = time.Now().Unix()
+	}
+	invoiceParams := &stripe.InvoiceUpcomingParams{
+		Customer:     stripe.String(params.CustomerId),
+		Subscription: stripe.String(params.SubscriptionId),
+		SubscriptionItems: []*stripe.SubscriptionItemsParams{
+			{ID: stripe.String(params.ItemId), Price: stripe.String(params.PriceId)},
+		},
+		SubscriptionProrationBehavior: stripe.String("create_prorations"),
+		SubscriptionProrationDate:     stripe.Int64(prorationDate),
+	}
+	invoiceParams.Context = ctx
+
+	invoice, err := s.API.Invoices.Upcoming(invoiceParams)
+	if err != nil {
+		return billing.Preview{}, err
+	}
+
+	preview = billing.Preview{
+		AmountDue:     invoice.AmountDue,
+		Currency:      string(invoice.Currency),
+		ProrationDate: prorationDate,
+	}
+	if invoice.Lines != nil {
+		for _, line := range invoice.Lines.Data {
+			if line.Proration {
+				preview.ProrationAmount += line.Amount
+			}
+		}
+	}
+	return preview, nil
+}
+
+// ChangeSubscription TODO: 1. Swap the price of the item with prorations, at the previewed date when given
+func (s *Stripe) ChangeSubscription(ctx context.Context, params billing.ChangeParams) (subscription billing.Subscription, err error) {
+	subscriptionParams := &stripe.SubscriptionParams{
+		Items: []*stripe.SubscriptionItemsParams{
+			{ID: stripe.String(params.ItemId), Price: stripe.String(params.PriceId)},
+		},
+		ProrationBehavior: stripe.String("create_prorations"),
+	}
+	if params.ProrationDate != 0 {
+		subscriptionParams.ProrationDate = stripe.Int64(params.ProrationDate)
+	}
+	subscriptionParams.Context = ctx
+
+	stripeSubscription, err := s.API.Subscriptions.Update(params.SubscriptionId, subscriptionParams)
+	if err != nil {
+		return billing.Subscription{}, err
+	}
+	return toBillingSubscription(stripeSubscription), nil
+}
+
+// UpdateQuantity TODO: 1. Set the quantity of the plan item with the configured proration behaviour
+func (s *Stripe) UpdateQuantity(ctx context.Context, params billing.QuantityParams) (subscription billing.Subscription, err error) {
+	subscriptionParams := &stripe.SubscriptionParams{
+		Items: []*stripe.SubscriptionItemsParams{
+			{ID: stripe.String(params.ItemId), Quantity: stripe.Int64(params.Quantity)},
+		},
+		ProrationBehavior: stripe.String(params.Proration),
+	}
+	subscriptionParams.Context = ctx
+	if params.IdempotencyKey != "" {
+		subscriptionParams.SetIdempotencyKey(params.IdempotencyKey)
+	}
+
+	stripeSubscription, err := s.API.Subscriptions.Update(params.SubscriptionId, subscriptionParams)
+	if err != nil {
+		return billing.Subscription{}, err
+	}
+	return toBillingSubscription(stripeSubscription), nil
+}
+
+// CancelSubscription TODO: 1. Cancel the subscription now or at the end of the paid period
+func (s *Stripe) CancelSubscription(ctx context.Context, subscriptionId string, immediately bool) (subscription billing.Subscription, err error) {
+	var stripeSubscription *stripe.Subscription
+	if immediately {
+		params := &stripe.SubscriptionCancelParams{}
+		params.Context = ctx
+		stripeSubscription, err = s.API.Subscriptions.Cancel(subscriptionId, params)
+	} else {
+		params := &stripe.SubscriptionParams{CancelAtPeriodEnd: stripe.Bool(true)}
+		params.Context = ctx
+		stripeSubscription, err = s.API.Subscriptions.Update(subscriptionId, params)
+	}
+	if err != nil {
+		return billing.Subscription{}, err
+	}
+	return toBillingSubscription(stripeSubscription), nil
+}
+
+// ResumeSubscription TODO: 1. Keep renewing a subscription scheduled for cancellation
+func (s *Stripe) ResumeSubscription(ctx context.Context, subscriptionId string) (subscription billing.Subscription, err error) {
+	params := &stripe.SubscriptionParams{CancelAtPeriodEnd: stripe.Bool(false)}
+	params.Context = ctx
+	stripeSubscription, err := s.API.Subscriptions.Update(subscriptionId, params)
+	if err != nil {
+		return billing.Subscription{}, err
+	}
+	return toBillingSubscription(stripeSubscription), nil
+}
+
+// ReportUsage TODO: 1. Increment the usage of the metered item with the idempotency key
+func (s *Stripe) ReportUsage(ctx context.Context, params billing.UsageParams) error {
+	usageParams := &stripe.UsageRecordParams{
+		SubscriptionItem: stripe.String(params.ItemId),
+		Quantity:         stripe.Int64(params.Quantity),
+		Timestamp:        stripe.Int64(params.Timestamp.Unix()),
+		Action:           stripe.String("increment"),
+	}
+	usageParams.Context = ctx
+	if params.IdempotencyKey != "" {
+		usageParams.SetIdempotencyKey(params.IdempotencyKey)
+	}
+	_, err := s.API.UsageRecords.New(usageParams)
+	return err
+}
+
+// CreateCheckoutSession TODO: 1. Build the subscription session with the user in the metadata, 2. Grant the trial, 3. Apply the promotion code or let the user enter one
+func (s *Stripe) CreateCheckoutSession(ctx context.Context, params billing.CheckoutParams) (session billing.CheckoutSession, err error) {
+	sessionParams := &stripe.CheckoutSessionParams{
+		Mode:              stripe.String(string(stripe.CheckoutSessionModeSubscription)),
+		Customer:          stripe.String(params.CustomerId),
+		ClientReferenceID: stripe.String(params.UserId),
+		LineItems:         []*stripe.CheckoutSessionLineItemParams{{Price: stripe.String(params.PriceId), Quantity: stripe.Int64(1)}},
+		SubscriptionData: &stripe.CheckoutSessionSubscriptionDataParams{
+			Metadata: map[string]string{"user_id": params.UserId},
+		},
+		SuccessURL: stripe.String(withQuery(params.SuccessUrl, "session_id={CHECKOUT_SESSION_ID}")),
+		CancelURL:  stripe.String(params.CancelUrl),
+	}
+	if params.MeteredPriceId != "" {
+		sessionParams.LineItems = append(sessionParams.LineItems, &stripe.CheckoutSessionLineItemParams{Price: stripe.String(params.MeteredPriceId)})
+	}
+	if params.TrialDays > 0 {
+		sessionParams.SubscriptionData.TrialPeriodDays = stripe.Int64(params.TrialDays)
+	}
+	if params.PromotionCode != "" {
+		promotionCodeId, err := s.promotionCode(ctx, params.PromotionCode)
+		if err != nil {
+			return billing.CheckoutSession{}, err
+		}
+		sessionParams.Discounts = []*stripe.CheckoutSessionDiscountParams{{PromotionCode: stripe.String(promotionCodeId)}}
+	} else {
+		sessionParams.AllowPromotionCodes = stripe.Bool(true)
+	}
+	sessionParams.Context = ctx
+	if params.IdempotencyKey != "" {
+		sessionParams.SetIdempotencyKey(params.IdempotencyKey)
+	}
+
+	stripeSession, err := s.API.CheckoutSessions.New(sessionParams)
+	if err != nil {
+		return billing.CheckoutSession{}, err
+	}
+	return toBillingCheckoutSession(stripeSession), nil
+}
+
+// GetCheckoutSession TODO: 1. Fetch the session, the redirect to the success url proves nothing
+func (s *Stripe) GetCheckoutSession(ctx context.Context, sessionId string) (session billing.CheckoutSession, err error) {
+	params := &stripe.CheckoutSessionParams{}
+	params.Context = ctx
+	stripeSession, err := s.API.CheckoutSessions.Get(sessionId, params)
+	if err != nil {
+		return billing.CheckoutSession{}, stripeError(err)
+	}
+	return toBillingCheckoutSession(stripeSession), nil
+}
+
+// CreatePortalSession TODO: 1. Return the customer portal url for cards, invoices and cancellation
+func (s *Stripe) CreatePortalSession(ctx context.Context, customerId string, returnUrl string) (url string, err error) {
+	params := &stripe.BillingPortalSessionParams{
+		Customer:  stripe.String(customerId),
+		ReturnURL: stripe.String(returnUrl),
+	}
+	params.Context = ctx
+	session, err := s.API.BillingPortalSessions.New(params)
+	if err != nil {
+		return "", err
+	}
+	return session.URL, nil
+}
+
+// VerifyWebhook TODO: 1. Verify the Stripe-Signature header, 2. Decode the event
+func (s *Stripe) VerifyWebhook(ctx context.Context, payload []byte, header http.Header) (event billing.Event, err error) {
+	// Objects are fetched again while processing, only ids are read from the payload.
+	_, err = webhook.ConstructEventWithOptions(payload, header.Get("Stripe-Signature"), s.WebhookSecret, webhook.ConstructEventOptions{
+		IgnoreAPIVersionMismatch: true,
+	})
+	if err != nil {
+		return billing.Event{}, billing.ErrInvalidSignature
+	}
+	return s.DecodeEvent(payload)
+}
+
+// DecodeEvent TODO: 1. Read the event type and the subscription it is about
+func (s *Stripe) DecodeEvent(payload []byte) (event billing.Event, err error) {
+	stripeEvent := stripe.Event{}
+	if err := json.Unmarshal(payload, &stripeEvent); err != nil {
+		return billing.Event{}, err
+	}
+	if stripeEvent.Data == nil {
+		return billing.Event{}, errors.New("webhook event has no data")
+	}
+
+	event = billing.Event{Id: stripeEvent.ID, Type: stripeEvent.Type, Kind: billing.EventIgnored, CreatedAt: time.Unix(stripeEvent.Created, 0)}
+	switch {
+	case strings.HasPrefix(stripeEvent.Type, "customer.subscription."):
+		subscription := stripe.Subscription{}
+		if err := json.Unmarshal(stripeEvent.Data.Raw, &subscription); err != nil {
+			return billing.Event{}, err
+		}
+		event.Kind = billing.EventSubscriptionChanged
+		event.SubscriptionId = subscription.ID
+		if subscription.Customer != nil {
+			event.CustomerId = subscription.Customer.ID
+		}
+	case strings.HasPrefix(stripeEvent.Type, "invoice."):
+		invoice := stripe.Invoice{}
+		if err := json.Unmarshal(stripeEvent.Data.Raw, &invoice); err != nil {
+			return billing.Event{}, err
+		}
+		switch stripeEvent.Type {
+		case "invoice.paid":
+			event.Kind = billing.EventPaymentSucceeded
+		case "invoice.payment_failed":
+			event.Kind = billing.EventPaymentFailed
+		default:
+			event.Kind = billing.EventSubscriptionChanged
+		}
+		if invoice.Subscription != nil {
+			event.SubscriptionId = invoice.Subscription.ID
+		}
+		if invoice.Customer != nil {
+			event.CustomerId = invoice.Customer.ID
+		}
+	case stripeEvent.Type == "checkout.session.completed":
+		session := stripe.CheckoutSession{}
+		if err := json.Unmarshal(stripeEvent.Data.Raw, &session); err != nil {
+			return billing.Event{}, err
+		}
+		event.Kind = billing.EventCheckoutCompleted
+		if session.Subscription != nil {
+			event.SubscriptionId = session.Subscription.ID
+		}
+		if session.Customer != nil {
+			event.CustomerId = session.Customer.ID
+		}
+	}
+	return event, nil
+}
+
+// Refund TODO: 1. Refund a payment intent or a charge, all of it when no amount is given
+func (s *Stripe) Refund(ctx context.Context, params billing.RefundParams) (refund billing.Refund, err error) {
+	refundParams := &stripe.RefundParams{}
+	if strings.HasPrefix(params.PaymentId, "ch_") {
+		refundParams.Charge = stripe.String(params.PaymentId)
+	} else {
+		refundParams.PaymentIntent = stripe.String(params.PaymentId)
+	}
+	if params.Amount > 0 {
+		refundParams.Amount = stripe.Int64(params.Amount)
+	}
+	if params.Reason != "" {
+		refundParams.Reason = stripe.String(params.Reason)
+	}
+	refundParams.Context = ctx
+	if params.IdempotencyKey != "" {
+		refundParams.SetIdempotencyKey(params.IdempotencyKey)
+	}
+
+	stripeRefund, err := s.API.Refunds.New(refundParams)
+	if err != nil {
+		return billing.Refund{}, stripeError(err)
+	}
+	return billing.Refund{
+		Id:        stripeRefund.ID,
+		PaymentId: params.PaymentId,
+		Amount:    stripeRefund.Amount,
+		Currency:  string(stripeRefund.Currency),
+		Status:    string(stripeRefund.Status),
+	}, nil
+}
+
+// promotionCode resolves the code typed by the user to the id of an active promotion code.
+func (s *Stripe) promotionCode(ctx context.Context, code string) (promotionCodeId string, err error) {
+	params := &stripe.PromotionCodeListParams{Code: stripe.String(code), Active: stripe.Bool(true)}
+	params.Context = ctx
+	params.Limit = stripe.Int64(1)
+
+	iterator := s.API.PromotionCodes.List(params)
+	if iterator.Next() {
+		return iterator.PromotionCode().ID, nil
+	}
+	if err := iterator.Err(); err != nil {
+		return "", err
+	}
+	return "", billing.ErrInvalidPromotionCode
+}
+
+func toBillingSubscription(stripeSubscription *stripe.Subscription) billing.Subscription {
+	subscription := billing.Subscription{
+		Id:                 stripeSubscription.ID,
+		UserId:             stripeSubscription.Metadata["user_id"],
+		Status:             string(stripeSubscription.Status),
+		CancelAtPeriodEnd:  stripeSubscription.CancelAtPeriodEnd,
+		CurrentPeriodStart: unixTime(stripeSubscription.CurrentPeriodStart),
+		CurrentPeriodEnd:   unixTime(stripeSubscription.CurrentPeriodEnd),
+		CanceledAt:         unixTime(stripeSubscription.CanceledAt),
+		TrialEnd:           unixTime(stripeSubscription.TrialEnd),
+		CreatedAt:          time.Unix(stripeSubscription.Created, 0),
+	}
+	if stripeSubscription.Customer != nil {
+		subscription.CustomerId = stripeSubscription.Customer.ID
+	}
+	if stripeSubscription.Items != nil {
+		for _, item := range stripeSubscription.Items.Data {
+			if item.Price == nil {
+				continue
+			}
+			subscription.Items = append(subscription.Items, billing.SubscriptionItem{Id: item.ID, PriceId: item.Price.ID, Quantity: item.Quantity})
+		}
+	}
+	if stripeSubscription.LatestInvoice != nil && stripeSubscription.LatestInvoice.PaymentIntent != nil {
+		subscription.ClientSecret = stripeSubscription.LatestInvoice.PaymentIntent.ClientSecret
+	}
+	// Stripe statuses are the mirrored ones, anything newer is treated as incomplete.
+	switch subscription.Status {
+	case entities.SubscriptionIncomplete, entities.SubscriptionIncompleteExpired, entities.SubscriptionTrialing, entities.SubscriptionActive,
+		entities.SubscriptionPastDue, entities.SubscriptionCanceled, entities.SubscriptionUnpaid:
+	default:
+		subscription.Status = entities.SubscriptionIncomplete
+	}
+	return subscription
+}
+
+func toBillingCheckoutSession(stripeSession *stripe.CheckoutSession) billing.CheckoutSession {
+	session := billing.CheckoutSession{
+		Id:            stripeSession.ID,
+		Url:           stripeSession.URL,
+		UserId:        stripeSession.ClientReferenceID,
+		Status:        string(stripeSession.Status),
+		PaymentStatus: string(stripeSession.PaymentStatus),
+	}
+	if stripeSession.Subscription != nil {
+		session.SubscriptionId = stripeSession.Subscription.ID
+	}
+	return session
+}
+
+// stripeError maps missing resources to billing.ErrNotFound.
+func stripeError(err error) error {
+	var stripeErr *stripe.Error
+	if errors.As(err, &stripeErr) && stripeErr.Code == stripe.ErrorCodeResourceMissing {
+		return billing.ErrNotFound
+	}
+	return err
+}
+
+// unixTime converts provider unix timestamps, where zero means unset.
+func unixTime(seconds int64) *time.Time {
+	if seconds == 0 {
+		return nil
+	}
+	value := time.Unix(seconds, 0)
+	return &value
+}
+
+// withQuery appends a query parameter to a url that may already have some.
+func withQuery(url string, parameter string) string {
+	if strings.Contains(url, "?") {
+		return url + "&" + parameter
+	}
+	return url + "?" + parameter
 }
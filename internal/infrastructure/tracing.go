@@ -0,0 +1,64 @@
+package infrastructure
+
+import (
+	"context"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.uber.org/zap"
+	"strings"
+)
+
+type Tracing struct {
+	Provider *sdktrace.TracerProvider
+}
+
+// NewTracing TODO: 1. Create the span exporter (otlp, stdout or none), 2. Register the global tracer provider, 3. Register W3C trace-context propagation
+func NewTracing(environment, serviceName, exporter, endpoint string, logger *zap.Logger) *Tracing {
+	// Propagation is always enabled so incoming trace context is forwarded even when spans are not exported.
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var spanExporter sdktrace.SpanExporter
+	var err error
+	switch strings.ToLower(exporter) {
+	case "otlp":
+		options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(endpoint)}
+		if strings.ToLower(environment) != "production" {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		spanExporter, err = otlptracehttp.New(context.Background(), options...)
+	case "stdout":
+		spanExporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	default:
+		logger.Sugar().Info("Tracing exporter disabled")
+		return &Tracing{}
+	}
+	if err != nil {
+		logger.Sugar().Error(err)
+		return &Tracing{}
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceName(serviceName),
+			semconv.DeploymentEnvironment(environment),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+
+	logger.Sugar().Info("Tracing exporter enabled: " + exporter)
+	return &Tracing{Provider: provider}
+}
+
+// Shutdown TODO: 1. Flush pending spans before the process exits
+func (t *Tracing) Shutdown(ctx context.Context) error {
+	if t.Provider == nil {
+		return nil
+	}
+	return t.Provider.Shutdown(ctx)
+}
@@ -0,0 +1,35 @@
+package templates
+
+type UnlockAccount struct {
+	Name  string
+	Token string
+}
+
+type PasswordReset struct {
+	Name  string
+	Token string
+}
+
+type AccountNotice struct {
+	Name  string
+	Email string
+}
+
+type EmailChange struct {
+	Name  string
+	Email string
+	Token string
+}
+
+type AccountDeletion struct {
+	Name      string
+	Token     string
+	DeletesAt string
+}
+
+type AccountInvitation struct {
+	Name       string
+	OwnerName  string
+	OwnerEmail string
+	ExpiresAt  string
+}
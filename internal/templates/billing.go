@@ -0,0 +1,21 @@
+package templates
+
+type PaymentReminder struct {
+	Name        string
+	GraceEndsAt string
+}
+
+type AccountRestricted struct {
+	Name string
+}
+
+type TrialEnding struct {
+	Name   string
+	Plan   string
+	EndsAt string
+}
+
+type TrialExpired struct {
+	Name string
+	Plan string
+}
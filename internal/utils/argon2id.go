@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"strings"
+)
+
+var ErrInvalidHash = errors.New("invalid password hash")
+
+// Argon2id encodes hashes in the PHC string format: $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+type Argon2id struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+func (a *Argon2id) HashPassword(password string) (string, error) {
+	salt := make([]byte, a.SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, a.Iterations, a.Memory, a.Parallelism, a.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, a.Memory, a.Iterations, a.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (a *Argon2id) ComparePassword(hashedPassword, password string) error {
+	params, salt, key, err := decodeArgon2id(hashedPassword)
+	if err != nil {
+		return err
+	}
+
+	otherKey := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, otherKey) != 1 {
+		return errors.New("argon2id: hashedPassword is not the hash of the given password")
+	}
+	return nil
+}
+
+// NeedsRehash reports whether the hash was created with different parameters than the configured ones.
+func (a *Argon2id) NeedsRehash(hashedPassword string) bool {
+	params, salt, key, err := decodeArgon2id(hashedPassword)
+	if err != nil {
+		return true
+	}
+	return params.Memory != a.Memory || params.Iterations != a.Iterations || params.Parallelism != a.Parallelism ||
+		uint32(len(salt)) != a.SaltLength || uint32(len(key)) != a.KeyLength
+}
+
+func (a *Argon2id) Matches(hashedPassword string) bool {
+	return strings.HasPrefix(hashedPassword, "$argon2id$")
+}
+
+func decodeArgon2id(hashedPassword string) (params Argon2id, salt []byte, key []byte, err error) {
+	parts := strings.Split(hashedPassword, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return Argon2id{}, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	_, err = fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return Argon2id{}, nil, nil, ErrInvalidHash
+	}
+
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil {
+		return Argon2id{}, nil, nil, ErrInvalidHash
+	}
+
+	salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2id{}, nil, nil, ErrInvalidHash
+	}
+	key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return Argon2id{}, nil, nil, ErrInvalidHash
+	}
+	return params, salt, key, nil
+}
@@ -1,6 +1,9 @@
 package utils
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
 
 type IBcrypt interface {
 	HashPassword(password string) (string, error)
@@ -8,10 +11,11 @@ type IBcrypt interface {
 }
 
 type Bcrypt struct {
+	Cost int
 }
 
 func (b *Bcrypt) HashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), b.cost())
 	if err != nil {
 		return "", err
 	}
@@ -21,3 +25,20 @@ func (b *Bcrypt) HashPassword(password string) (string, error) {
 func (b *Bcrypt) ComparePassword(hashedPassword, password string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 }
+
+// NeedsRehash reports whether the hash was created with a different cost than the configured one.
+func (b *Bcrypt) NeedsRehash(hashedPassword string) bool {
+	cost, err := bcrypt.Cost([]byte(hashedPassword))
+	return err != nil || cost != b.cost()
+}
+
+func (b *Bcrypt) Matches(hashedPassword string) bool {
+	return strings.HasPrefix(hashedPassword, "$2a$") || strings.HasPrefix(hashedPassword, "$2b$") || strings.HasPrefix(hashedPassword, "$2y$")
+}
+
+func (b *Bcrypt) cost() int {
+	if b.Cost == 0 {
+		return bcrypt.DefaultCost
+	}
+	return b.Cost
+}
@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"time"
+)
+
+type contextKey string
+
+const (
+	requestIdKey  contextKey = "requestId"
+	loggerKey     contextKey = "logger"
+	userIdKey     contextKey = "userId"
+	requestLogKey contextKey = "requestLog"
+	clientKey     contextKey = "client"
+	authKey       contextKey = "authentication"
+	scopesKey     contextKey = "scopes"
+	principalKey  contextKey = "principal"
+)
+
+const (
+	PrincipalUser   = "user"
+	PrincipalClient = "client"
+)
+
+// PrincipalInfo identifies who is calling: a user (also set through WithUserId) or an OAuth client.
+type PrincipalInfo struct {
+	Type string
+	Id   string
+}
+
+// ClientInfo describes where a request comes from, used by audit entries.
+type ClientInfo struct {
+	Ip        string
+	UserAgent string
+}
+
+// AuthenticationInfo tells when and how the caller last proved who they are (auth_time and amr claims).
+// ActorId is set when an administrator impersonates the user (act claim).
+type AuthenticationInfo struct {
+	Time    time.Time
+	Methods []string
+	ActorId string
+}
+
+// RequestLog is shared between the access logger and inner middlewares, so values discovered
+// deeper in the chain (e.g. the authenticated user) end up in the access log line.
+type RequestLog struct {
+	UserId string
+}
+
+func WithRequestId(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, requestIdKey, requestId)
+}
+
+func RequestId(ctx context.Context) string {
+	requestId, _ := ctx.Value(requestIdKey).(string)
+	return requestId
+}
+
+func WithLogger(ctx context.Context, logger *zap.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, logger)
+}
+
+// Logger returns the request-scoped logger, falling back to the global logger outside a request.
+func Logger(ctx context.Context) *zap.Logger {
+	if logger, ok := ctx.Value(loggerKey).(*zap.Logger); ok {
+		return logger
+	}
+	return zap.L()
+}
+
+func WithRequestLog(ctx context.Context, requestLog *RequestLog) context.Context {
+	return context.WithValue(ctx, requestLogKey, requestLog)
+}
+
+func WithUserId(ctx context.Context, userId string) context.Context {
+	if requestLog, ok := ctx.Value(requestLogKey).(*RequestLog); ok {
+		requestLog.UserId = userId
+	}
+	ctx = WithLogger(ctx, Logger(ctx).With(zap.String("user_id", userId)))
+	ctx = WithPrincipal(ctx, PrincipalInfo{Type: PrincipalUser, Id: userId})
+	return context.WithValue(ctx, userIdKey, userId)
+}
+
+func UserId(ctx context.Context) string {
+	userId, _ := ctx.Value(userIdKey).(string)
+	return userId
+}
+
+func WithClient(ctx context.Context, client ClientInfo) context.Context {
+	return context.WithValue(ctx, clientKey, client)
+}
+
+func Client(ctx context.Context) ClientInfo {
+	client, _ := ctx.Value(clientKey).(ClientInfo)
+	return client
+}
+
+func WithAuthentication(ctx context.Context, authentication AuthenticationInfo) context.Context {
+	return context.WithValue(ctx, authKey, authentication)
+}
+
+func Authentication(ctx context.Context) AuthenticationInfo {
+	authentication, _ := ctx.Value(authKey).(AuthenticationInfo)
+	return authentication
+}
+
+// WithScopes restricts the request to the given scopes, requests without scopes are unrestricted.
+func WithScopes(ctx context.Context, scopes []string) context.Context {
+	return context.WithValue(ctx, scopesKey, scopes)
+}
+
+func Scopes(ctx context.Context) (scopes []string, restricted bool) {
+	scopes, restricted = ctx.Value(scopesKey).([]string)
+	return scopes, restricted
+}
+
+func WithPrincipal(ctx context.Context, principal PrincipalInfo) context.Context {
+	return context.WithValue(ctx, principalKey, principal)
+}
+
+func Principal(ctx context.Context) PrincipalInfo {
+	principal, _ := ctx.Value(principalKey).(PrincipalInfo)
+	return principal
+}
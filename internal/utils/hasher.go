@@ -0,0 +1,130 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+)
+
+const (
+	HashAlgorithmArgon2id = "argon2id"
+	HashAlgorithmBcrypt   = "bcrypt"
+)
+
+type IPasswordHasher interface {
+	HashPassword(password string) (string, error)
+	// VerifyPassword returns needsRehash when the hash is valid but was created with an outdated algorithm, parameters or pepper.
+	VerifyPassword(hashedPassword, password string) (needsRehash bool, err error)
+}
+
+type hashAlgorithm interface {
+	HashPassword(password string) (string, error)
+	ComparePassword(hashedPassword, password string) error
+	NeedsRehash(hashedPassword string) bool
+	Matches(hashedPassword string) bool
+}
+
+// PasswordHasher hashes new passwords with the configured algorithm and verifies any supported one,
+// so hashes are upgraded transparently the next time their owner signs in.
+type PasswordHasher struct {
+	Algorithm string
+	Argon2id  Argon2id
+	Bcrypt    Bcrypt
+	// Pepper is a server side secret mixed into every password with HMAC-SHA256 before hashing.
+	Pepper []byte
+}
+
+func NewPasswordHasher(algorithm string, memory string, iterations string, parallelism string, bcryptCost string, pepper string) *PasswordHasher {
+	if algorithm != HashAlgorithmArgon2id && algorithm != HashAlgorithmBcrypt {
+		panic(fmt.Sprintf("unknown password hash algorithm %q", algorithm))
+	}
+	memoryInt, err := strconv.ParseUint(memory, 10, 32)
+	if err != nil {
+		panic(err)
+	}
+	iterationsInt, err := strconv.ParseUint(iterations, 10, 32)
+	if err != nil {
+		panic(err)
+	}
+	parallelismInt, err := strconv.ParseUint(parallelism, 10, 8)
+	if err != nil {
+		panic(err)
+	}
+	bcryptCostInt, err := strconv.Atoi(bcryptCost)
+	if err != nil {
+		panic(err)
+	}
+
+	return &PasswordHasher{
+		Algorithm: algorithm,
+		Argon2id: Argon2id{
+			Memory:      uint32(memoryInt),
+			Iterations:  uint32(iterationsInt),
+			Parallelism: uint8(parallelismInt),
+			SaltLength:  16,
+			KeyLength:   32,
+		},
+		Bcrypt: Bcrypt{Cost: bcryptCostInt},
+		Pepper: []byte(pepper),
+	}
+}
+
+func (ph *PasswordHasher) HashPassword(password string) (string, error) {
+	return ph.algorithm(ph.Algorithm).HashPassword(ph.prehash(password, ph.Pepper))
+}
+
+func (ph *PasswordHasher) VerifyPassword(hashedPassword, password string) (needsRehash bool, err error) {
+	algorithm := ph.detect(hashedPassword)
+	if algorithm == nil {
+		return false, ErrInvalidHash
+	}
+
+	outdated := algorithm != ph.algorithm(ph.Algorithm) || algorithm.NeedsRehash(hashedPassword)
+	err = algorithm.ComparePassword(hashedPassword, ph.prehash(password, ph.Pepper))
+	if err == nil {
+		return outdated, nil
+	}
+
+	// Hashes created before the pepper was configured, or of the raw password before every password was
+	// pre-hashed, still verify and are upgraded.
+	legacy := []string{password}
+	if len(ph.Pepper) > 0 {
+		legacy = append(legacy, ph.prehash(password, nil))
+	}
+	for _, candidate := range legacy {
+		if algorithm.ComparePassword(hashedPassword, candidate) == nil {
+			return true, nil
+		}
+	}
+	return false, err
+}
+
+// prehash returns the base64 HMAC-SHA256 of the password with the pepper, or its base64 SHA-256 without one,
+// which keeps bcrypt inputs under its 72 byte limit whatever the password length.
+func (ph *PasswordHasher) prehash(password string, pepper []byte) string {
+	if len(pepper) == 0 {
+		sum := sha256.Sum256([]byte(password))
+		return base64.RawStdEncoding.EncodeToString(sum[:])
+	}
+	mac := hmac.New(sha256.New, pepper)
+	mac.Write([]byte(password))
+	return base64.RawStdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (ph *PasswordHasher) algorithm(name string) hashAlgorithm {
+	if name == HashAlgorithmBcrypt {
+		return &ph.Bcrypt
+	}
+	return &ph.Argon2id
+}
+
+func (ph *PasswordHasher) detect(hashedPassword string) hashAlgorithm {
+	for _, algorithm := range []hashAlgorithm{&ph.Argon2id, &ph.Bcrypt} {
+		if algorithm.Matches(hashedPassword) {
+			return algorithm
+		}
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS audit_logs
+(
+    id         UUID PRIMARY KEY,
+    actor_id   VARCHAR(64)  NOT NULL DEFAULT '',
+    target_id  VARCHAR(64)  NOT NULL DEFAULT '',
+    action     VARCHAR(64)  NOT NULL,
+    ip         VARCHAR(64)  NOT NULL DEFAULT '',
+    user_agent TEXT         NOT NULL DEFAULT '',
+    request_id VARCHAR(128) NOT NULL DEFAULT '',
+    metadata   JSONB        NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS audit_logs_target_id_idx ON audit_logs (target_id, created_at);
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS api_keys
+(
+    id           UUID PRIMARY KEY,
+    user_id      UUID         NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name         VARCHAR(64)  NOT NULL,
+    prefix       VARCHAR(16)  NOT NULL,
+    hash         VARCHAR(128) NOT NULL,
+    scopes       TEXT[]       NOT NULL DEFAULT '{}',
+    expires_at   TIMESTAMPTZ  NULL,
+    last_used_at TIMESTAMPTZ  NULL,
+    revoked_at   TIMESTAMPTZ  NULL,
+    created_at   TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS api_keys_prefix_key ON api_keys (prefix);
+CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys (user_id, created_at);
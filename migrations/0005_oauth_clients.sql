@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS oauth_clients
+(
+    id          VARCHAR(64)  PRIMARY KEY,
+    name        VARCHAR(64)  NOT NULL,
+    secret_hash VARCHAR(128) NOT NULL,
+    scopes      TEXT[]       NOT NULL DEFAULT '{}',
+    created_by  VARCHAR(64)  NOT NULL DEFAULT '',
+    revoked_at  TIMESTAMPTZ  NULL,
+    created_at  TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
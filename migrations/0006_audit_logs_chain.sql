@@ -0,0 +1,24 @@
+-- seq orders the hash chain, rows written before this migration keep an empty hash and are not verified.
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS seq BIGSERIAL;
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS prev_hash VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS hash VARCHAR(64) NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX IF NOT EXISTS audit_logs_seq_key ON audit_logs (seq);
+CREATE INDEX IF NOT EXISTS audit_logs_actor_id_idx ON audit_logs (actor_id, created_at);
+CREATE INDEX IF NOT EXISTS audit_logs_action_idx ON audit_logs (action, created_at);
+CREATE INDEX IF NOT EXISTS audit_logs_created_at_idx ON audit_logs (created_at);
+
+-- The log is append-only, rows can only leave through the retention job (DELETE).
+CREATE OR REPLACE FUNCTION audit_logs_append_only() RETURNS TRIGGER AS
+$$
+BEGIN
+    RAISE EXCEPTION 'audit_logs is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_logs_append_only ON audit_logs;
+CREATE TRIGGER audit_logs_append_only
+    BEFORE UPDATE
+    ON audit_logs
+    FOR EACH ROW
+EXECUTE FUNCTION audit_logs_append_only();
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS subscriptions
+(
+    id                   VARCHAR(255) PRIMARY KEY,
+    user_id              UUID         NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    customer_id          VARCHAR(255) NOT NULL,
+    item_id              VARCHAR(255) NOT NULL,
+    price_id             VARCHAR(255) NOT NULL,
+    status               VARCHAR(32)  NOT NULL,
+    cancel_at_period_end BOOLEAN      NOT NULL DEFAULT FALSE,
+    current_period_start TIMESTAMPTZ  NULL,
+    current_period_end   TIMESTAMPTZ  NULL,
+    canceled_at          TIMESTAMPTZ  NULL,
+    trial_end            TIMESTAMPTZ  NULL,
+    created_at           TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    updated_at           TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS subscriptions_user_id_idx ON subscriptions (user_id, created_at);
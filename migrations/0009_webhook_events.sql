@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS webhook_events
+(
+    id              VARCHAR(255) PRIMARY KEY,
+    type            VARCHAR(128) NOT NULL,
+    payload         JSONB        NOT NULL,
+    status          VARCHAR(16)  NOT NULL DEFAULT 'pending',
+    attempts        INTEGER      NOT NULL DEFAULT 0,
+    last_error      TEXT         NULL,
+    next_attempt_at TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    processed_at    TIMESTAMPTZ  NULL,
+    created_at      TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS webhook_events_due_idx ON webhook_events (next_attempt_at) WHERE status IN ('pending', 'processing');
+CREATE INDEX IF NOT EXISTS webhook_events_status_idx ON webhook_events (status, created_at);
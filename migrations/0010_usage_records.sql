@@ -0,0 +1,18 @@
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS metered_item_id VARCHAR(255) NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS usage_records
+(
+    id                UUID PRIMARY KEY,
+    user_id           UUID        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    metric            VARCHAR(64) NOT NULL,
+    period_start      TIMESTAMPTZ NOT NULL,
+    period_end        TIMESTAMPTZ NOT NULL,
+    quantity          BIGINT      NOT NULL DEFAULT 0,
+    reported_quantity BIGINT      NOT NULL DEFAULT 0,
+    reported_at       TIMESTAMPTZ NULL,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at        TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS usage_records_period_key ON usage_records (user_id, metric, period_start);
+CREATE INDEX IF NOT EXISTS usage_records_unreported_idx ON usage_records (updated_at) WHERE quantity > reported_quantity;
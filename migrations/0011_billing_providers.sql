@@ -0,0 +1,9 @@
+ALTER TABLE users RENAME COLUMN stripe_customer_id TO billing_customer_id;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS billing_provider VARCHAR(32) NULL;
+UPDATE users SET billing_provider = 'stripe' WHERE billing_customer_id IS NOT NULL;
+
+DROP INDEX IF EXISTS users_stripe_customer_id_key;
+CREATE UNIQUE INDEX IF NOT EXISTS users_billing_customer_key ON users (billing_provider, billing_customer_id) WHERE billing_customer_id IS NOT NULL;
+
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS provider VARCHAR(32) NOT NULL DEFAULT 'stripe';
+ALTER TABLE webhook_events ADD COLUMN IF NOT EXISTS provider VARCHAR(32) NOT NULL DEFAULT 'stripe';
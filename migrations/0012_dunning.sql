@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS dunning
+(
+    user_id          UUID PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    provider         VARCHAR(32)  NOT NULL,
+    subscription_id  VARCHAR(255) NOT NULL,
+    status           VARCHAR(16)  NOT NULL,
+    failed_at        TIMESTAMPTZ  NOT NULL,
+    grace_ends_at    TIMESTAMPTZ  NOT NULL,
+    reminders_sent   INTEGER      NOT NULL DEFAULT 0,
+    last_reminder_at TIMESTAMPTZ  NULL,
+    restricted_at    TIMESTAMPTZ  NULL,
+    resolved_at      TIMESTAMPTZ  NULL,
+    updated_at       TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS dunning_open_idx ON dunning (failed_at) WHERE status IN ('grace', 'restricted');
@@ -0,0 +1,11 @@
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS quantity INTEGER NOT NULL DEFAULT 1;
+
+CREATE TABLE IF NOT EXISTS account_members
+(
+    account_id UUID        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    user_id    UUID        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (account_id, user_id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS account_members_user_id_key ON account_members (user_id);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS trials
+(
+    user_id          UUID PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    plan             VARCHAR(32) NOT NULL,
+    started_at       TIMESTAMPTZ NOT NULL,
+    ends_at          TIMESTAMPTZ NOT NULL,
+    reminders_sent   INTEGER     NOT NULL DEFAULT 0,
+    last_reminder_at TIMESTAMPTZ NULL,
+    converted_at     TIMESTAMPTZ NULL,
+    expired_at       TIMESTAMPTZ NULL
+);
+
+CREATE INDEX IF NOT EXISTS trials_running_idx ON trials (ends_at) WHERE converted_at IS NULL AND expired_at IS NULL;
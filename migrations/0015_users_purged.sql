@@ -0,0 +1,7 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS purged_at TIMESTAMPTZ NULL;
+
+-- Accounts anonymized before the marker existed must not be purged again.
+UPDATE users SET purged_at = updated_at WHERE deactivated_at IS NOT NULL AND email LIKE 'deleted-%@invalid';
+
+DROP INDEX IF EXISTS users_deactivated_at_idx;
+CREATE INDEX IF NOT EXISTS users_deactivated_at_idx ON users (deactivated_at) WHERE deactivated_at IS NOT NULL AND purged_at IS NULL;
@@ -0,0 +1,8 @@
+-- A counter of a flushing key is added to usage_records once, the marker goes with the key once it is drained.
+CREATE TABLE IF NOT EXISTS usage_flushes
+(
+    flush_key  VARCHAR(255) NOT NULL,
+    field      VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (flush_key, field)
+);
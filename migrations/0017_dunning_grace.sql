@@ -0,0 +1,3 @@
+-- Only cases in grace are processed, restricted cases wait for a payment.
+DROP INDEX IF EXISTS dunning_open_idx;
+CREATE INDEX IF NOT EXISTS dunning_grace_idx ON dunning (grace_ends_at) WHERE status = 'grace';
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS account_invitations
+(
+    account_id UUID        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    user_id    UUID        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (account_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS account_invitations_user_id_idx ON account_invitations (user_id);
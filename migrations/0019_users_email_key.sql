@@ -0,0 +1,2 @@
+-- Emails are unique whatever their case, lookups compare them the same way.
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_key ON users (LOWER(email));